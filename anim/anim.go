@@ -0,0 +1,154 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package anim decodes animated GIF, PNG (APNG) and WebP images into
+// whole frames, composed the way they're meant to be shown one after
+// the other.
+package anim
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"time"
+)
+
+// Frame is a whole frame of an animation, shown for Delay.
+type Frame struct {
+	Image *image.NRGBA
+	Delay time.Duration
+}
+
+// Animation is a decoded animation.
+type Animation struct {
+	Frames []Frame
+	Loops  int // times it's played, 0 for forever
+}
+
+// Duration returns how long it takes to play once.
+func (a *Animation) Duration() time.Duration {
+	var d time.Duration
+	for _, f := range a.Frames {
+		d += f.Delay
+	}
+	return d
+}
+
+// StillDecoder decodes a still image in a format the standard library
+// doesn't know, such as WebP.
+type StillDecoder func(data []byte) (image.Image, error)
+
+// MaxPixels bounds the pixels of all the frames of an animation
+// together, as they're all kept decoded.
+var MaxPixels = 32 << 20
+
+// Delays shorter than MinDelay are taken as DefaultDelay, as browsers
+// do; many GIFs leave the delay at 0.
+const (
+	MinDelay     = 20 * time.Millisecond
+	DefaultDelay = 100 * time.Millisecond
+)
+
+var (
+	ErrTooLarge = errors.New("anim: too many frames to keep decoded")
+	ErrFormat   = errors.New("anim: malformed animation")
+)
+
+// Decode returns the frames of an animated image. It returns nil, and
+// no error, for still images and unknown formats. still is used for
+// the frames of WebP animations, which aren't decoded if it's nil.
+func Decode(data []byte, still StillDecoder) (*Animation, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return decodeGIF(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return decodeAPNG(data)
+	case isWebP(data) && still != nil:
+		return decodeWebP(data, still)
+	}
+	return nil, nil
+}
+
+func delay(d time.Duration) time.Duration {
+	if d < MinDelay {
+		return DefaultDelay
+	}
+	return d
+}
+
+type disposal int
+
+const (
+	disposeNone       disposal = iota // leave the frame as it is
+	disposeBackground                 // clear its area
+	disposePrevious                   // restore its area as it was before
+)
+
+// canvas composes the frames of an animation.
+type canvas struct {
+	img    *image.NRGBA
+	anim   Animation
+	pixels int
+}
+
+func newCanvas(w, h int) (*canvas, error) {
+	if w <= 0 || h <= 0 || w > MaxPixels/h {
+		return nil, ErrFormat
+	}
+	return &canvas{img: image.NewNRGBA(image.Rect(0, 0, w, h))}, nil
+}
+
+// add draws src over the canvas at r, or in place of it if over is
+// false, adds the result as a frame, and disposes of src.
+func (c *canvas) add(src image.Image, r image.Rectangle, over bool, d disposal, dt time.Duration) error {
+	c.pixels += len(c.img.Pix) / 4
+	if c.pixels > MaxPixels {
+		return ErrTooLarge
+	}
+	r = r.Intersect(c.img.Bounds())
+
+	var saved *image.NRGBA
+	if d == disposePrevious {
+		saved = image.NewNRGBA(r)
+		draw.Draw(saved, r, c.img, r.Min, draw.Src)
+	}
+
+	op := draw.Src
+	if over {
+		op = draw.Over
+	}
+	draw.Draw(c.img, r, src, src.Bounds().Min, op)
+
+	frame := image.NewNRGBA(c.img.Rect)
+	copy(frame.Pix, c.img.Pix)
+	c.anim.Frames = append(c.anim.Frames, Frame{Image: frame, Delay: delay(dt)})
+
+	switch d {
+	case disposeBackground:
+		draw.Draw(c.img, r, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		draw.Draw(c.img, r, saved, r.Min, draw.Src)
+	}
+	return nil
+}
+
+// animation returns the result, or nil if there's a single frame.
+func (c *canvas) animation() *Animation {
+	if len(c.anim.Frames) < 2 {
+		return nil
+	}
+	return &c.anim
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package anim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+var (
+	red  = color.NRGBA{255, 0, 0, 255}
+	blue = color.NRGBA{0, 0, 255, 255}
+)
+
+func filled(r image.Rectangle, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// check tests the frames of a 4x4 animation of a red background and a
+// blue 2x2 square at the top left that's cleared after the second
+// frame.
+func check(t *testing.T, a *Animation, err error) {
+	t.Helper()
+	if err != nil || a == nil {
+		t.Fatalf("Decode = %v, %v", a, err)
+	}
+	if len(a.Frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(a.Frames))
+	}
+	for i, want := range []struct {
+		at    image.Point
+		c     color.NRGBA
+		delay time.Duration
+	}{
+		{image.Pt(0, 0), red, 200 * time.Millisecond},
+		{image.Pt(1, 1), blue, DefaultDelay},
+		{image.Pt(0, 0), color.NRGBA{}, 50 * time.Millisecond},
+	} {
+		f := a.Frames[i]
+		if got := f.Image.NRGBAAt(want.at.X, want.at.Y); got != want.c {
+			t.Errorf("frame %d at %v = %v, want %v", i, want.at, got, want.c)
+		}
+		if got := f.Image.NRGBAAt(3, 3); got != red {
+			t.Errorf("frame %d at (3,3) = %v, want %v", i, got, red)
+		}
+		if f.Delay != want.delay {
+			t.Errorf("frame %d delay = %v, want %v", i, f.Delay, want.delay)
+		}
+	}
+}
+
+func TestGIF(t *testing.T) {
+	pal := color.Palette{color.Transparent, red, blue}
+	frame := func(r image.Rectangle, c uint8) *image.Paletted {
+		img := image.NewPaletted(r, pal)
+		for i := range img.Pix {
+			img.Pix[i] = c
+		}
+		return img
+	}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			frame(image.Rect(0, 0, 4, 4), 1),
+			frame(image.Rect(0, 0, 2, 2), 2),
+			frame(image.Rect(2, 2, 3, 3), 1),
+		},
+		Delay:     []int{20, 0, 5},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 2,
+		Config:    image.Config{Width: 4, Height: 4},
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Decode(b.Bytes(), nil)
+	check(t, a, err)
+	if a.Loops != 3 {
+		t.Errorf("Loops = %d, want 3", a.Loops)
+	}
+}
+
+func TestAPNG(t *testing.T) {
+	type frame struct {
+		img     *image.NRGBA
+		delay   uint16 // in hundredths
+		dispose disposal
+	}
+	frames := []frame{
+		{filled(image.Rect(0, 0, 4, 4), red), 20, disposeNone},
+		{filled(image.Rect(0, 0, 2, 2), blue), 0, disposeBackground},
+		{filled(image.Rect(2, 2, 3, 3), red), 5, disposeNone},
+	}
+
+	var b bytes.Buffer
+	b.Write(pngSignature)
+	seq := uint32(0)
+	for i, f := range frames {
+		var enc bytes.Buffer
+		if err := png.Encode(&enc, f.img); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readChunks(enc.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			writeChunk(&b, "IHDR", chunks[0].data)
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+			writeChunk(&b, "acTL", actl)
+		}
+		r := f.img.Rect
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl, seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(r.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(r.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(r.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(r.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:], f.delay)
+		fctl[24] = byte(f.dispose)
+		fctl[25] = 1
+		writeChunk(&b, "fcTL", fctl)
+		seq++
+
+		for _, c := range chunks {
+			if c.typ != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writeChunk(&b, "IDAT", c.data)
+				continue
+			}
+			fdat := make([]byte, 4, 4+len(c.data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			writeChunk(&b, "fdAT", append(fdat, c.data...))
+			seq++
+		}
+	}
+	writeChunk(&b, "IEND", nil)
+
+	a, err := Decode(b.Bytes(), nil)
+	check(t, a, err)
+	if a.Loops != 0 {
+		t.Errorf("Loops = %d, want 0", a.Loops)
+	}
+}
+
+func TestAPNGBounds(t *testing.T) {
+	var enc bytes.Buffer
+	if err := png.Encode(&enc, filled(image.Rect(0, 0, 4, 4), red)); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := readChunks(enc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 1<<16, 1<<16),
+		image.Rect(3, 0, 5, 4),
+		image.Rect(0, 0, 0, 4),
+	} {
+		var b bytes.Buffer
+		b.Write(pngSignature)
+		writeChunk(&b, "IHDR", chunks[0].data)
+		actl := make([]byte, 8)
+		binary.BigEndian.PutUint32(actl, 2)
+		writeChunk(&b, "acTL", actl)
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(r.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(r.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(r.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(r.Min.Y))
+		writeChunk(&b, "fcTL", fctl)
+		writeChunk(&b, "IEND", nil)
+
+		if _, err := Decode(b.Bytes(), nil); err != ErrFormat {
+			t.Errorf("frame at %v: err = %v, want %v", r, err, ErrFormat)
+		}
+	}
+}
+
+func TestStill(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, filled(image.Rect(0, 0, 2, 2), red)); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := Decode(b.Bytes(), nil); a != nil || err != nil {
+		t.Errorf("Decode of a still PNG = %v, %v", a, err)
+	}
+}
+
+func TestWebP(t *testing.T) {
+	// The frames are fake VP8L chunks holding the color index and
+	// size, decoded by still.
+	colors := []color.NRGBA{red, blue}
+	still := func(data []byte) (image.Image, error) {
+		if !isWebP(data) {
+			t.Fatalf("still got a %q file", data[:4])
+		}
+		chunks, err := readRIFF(data[12:])
+		if err != nil || len(chunks) != 1 || chunks[0].typ != "VP8L" {
+			t.Fatalf("still got chunks %v, %v", chunks, err)
+		}
+		d := chunks[0].data
+		return filled(image.Rect(0, 0, int(d[1]), int(d[2])), colors[d[0]]), nil
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02
+	putUint24(vp8x[4:], 3)
+	putUint24(vp8x[7:], 3)
+	writeRIFF(&body, "VP8X", vp8x)
+	writeRIFF(&body, "ANIM", make([]byte, 6))
+	for _, f := range []struct {
+		x, y, w, h, ms int
+		flags          byte
+		c              byte
+	}{
+		{0, 0, 4, 4, 200, 0x02, 0},
+		{0, 0, 2, 2, 0, 0x01, 1},
+		{2, 2, 1, 1, 50, 0, 0},
+	} {
+		var anmf bytes.Buffer
+		hdr := make([]byte, 16)
+		putUint24(hdr, f.x/2)
+		putUint24(hdr[3:], f.y/2)
+		putUint24(hdr[6:], f.w-1)
+		putUint24(hdr[9:], f.h-1)
+		putUint24(hdr[12:], f.ms)
+		hdr[15] = f.flags
+		anmf.Write(hdr)
+		writeRIFF(&anmf, "VP8L", []byte{f.c, byte(f.w), byte(f.h)})
+		writeRIFF(&body, "ANMF", anmf.Bytes())
+	}
+	var b bytes.Buffer
+	writeRIFF(&b, "RIFF", body.Bytes())
+
+	a, err := Decode(b.Bytes(), still)
+	check(t, a, err)
+	if a, err := Decode(b.Bytes(), nil); a != nil || err != nil {
+		t.Errorf("Decode without a still decoder = %v, %v", a, err)
+	}
+}
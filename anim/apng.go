@@ -0,0 +1,190 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package anim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	for p := len(pngSignature); p < len(data); {
+		if p+8 > len(data) {
+			return nil, ErrFormat
+		}
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if n < 0 || p+12+n > len(data) {
+			return nil, ErrFormat
+		}
+		chunks = append(chunks, pngChunk{string(data[p+4 : p+8]), data[p+8 : p+8+n]})
+		p += 12 + n
+	}
+	return chunks, nil
+}
+
+func writeChunk(b *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	b.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	b.WriteString(typ)
+	b.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	b.Write(n[:])
+}
+
+// apngFrame is a frame as stored: a region, and the image data of a
+// still PNG of that size.
+type apngFrame struct {
+	r       image.Rectangle
+	delay   time.Duration
+	dispose disposal
+	over    bool
+	data    [][]byte
+}
+
+func decodeAPNG(data []byte) (*Animation, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ihdr     []byte
+		header   []pngChunk // copied into the PNG of each frame
+		animated bool
+		loops    int
+		frames   []*apngFrame
+		cur      *apngFrame
+		seenFdAT bool
+	)
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			if len(c.data) < 8 {
+				return nil, ErrFormat
+			}
+			animated = true
+			loops = int(binary.BigEndian.Uint32(c.data[4:]))
+		case "fcTL":
+			if len(c.data) < 26 {
+				return nil, ErrFormat
+			}
+			d := c.data[4:]
+			w, h := binary.BigEndian.Uint32(d), binary.BigEndian.Uint32(d[4:])
+			x, y := binary.BigEndian.Uint32(d[8:]), binary.BigEndian.Uint32(d[12:])
+			num, den := binary.BigEndian.Uint16(d[16:]), binary.BigEndian.Uint16(d[18:])
+			if den == 0 {
+				den = 100
+			}
+			// Frames are checked to lie within the canvas, which is
+			// bounded by MaxPixels, before any is decoded.
+			if len(ihdr) < 13 || w == 0 || h == 0 ||
+				uint64(x)+uint64(w) > uint64(binary.BigEndian.Uint32(ihdr)) ||
+				uint64(y)+uint64(h) > uint64(binary.BigEndian.Uint32(ihdr[4:])) {
+				return nil, ErrFormat
+			}
+			cur = &apngFrame{
+				r:       image.Rect(int(x), int(y), int(x+w), int(y+h)),
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: disposal(d[20]),
+				over:    d[21] == 1,
+			}
+			if cur.dispose > disposePrevious {
+				return nil, ErrFormat
+			}
+			frames = append(frames, cur)
+		case "IDAT":
+			// Without a fcTL first, the default image isn't part of
+			// the animation.
+			if cur != nil && !seenFdAT {
+				cur.data = append(cur.data, c.data)
+			}
+		case "fdAT":
+			seenFdAT = true
+			if cur == nil || len(c.data) < 4 {
+				return nil, ErrFormat
+			}
+			cur.data = append(cur.data, c.data[4:])
+		case "IEND":
+		default:
+			if !animated || len(frames) == 0 {
+				header = append(header, c)
+			}
+		}
+	}
+	if !animated || len(frames) < 2 || len(ihdr) < 13 {
+		return nil, nil
+	}
+
+	c, err := newCanvas(int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:])))
+	if err != nil {
+		return nil, err
+	}
+	c.anim.Loops = loops
+
+	for i, f := range frames {
+		if len(f.data) == 0 {
+			return nil, ErrFormat
+		}
+		img, err := png.Decode(bytes.NewReader(stillPNG(ihdr, header, f)))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && f.dispose == disposePrevious {
+			f.dispose = disposeBackground
+		}
+		if err := c.add(img, f.r, f.over, f.dispose, f.delay); err != nil {
+			return nil, err
+		}
+	}
+	return c.animation(), nil
+}
+
+// stillPNG makes a PNG file of a frame.
+func stillPNG(ihdr []byte, header []pngChunk, f *apngFrame) []byte {
+	var b bytes.Buffer
+	b.Write(pngSignature)
+
+	hdr := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(hdr, uint32(f.r.Dx()))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(f.r.Dy()))
+	writeChunk(&b, "IHDR", hdr)
+	for _, c := range header {
+		writeChunk(&b, c.typ, c.data)
+	}
+	for _, d := range f.data {
+		writeChunk(&b, "IDAT", d)
+	}
+	writeChunk(&b, "IEND", nil)
+	return b.Bytes()
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package anim
+
+import (
+	"bytes"
+	"image/gif"
+	"time"
+)
+
+func decodeGIF(data []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) < 2 {
+		return nil, nil
+	}
+
+	c, err := newCanvas(g.Config.Width, g.Config.Height)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case g.LoopCount < 0:
+		c.anim.Loops = 1
+	case g.LoopCount > 0:
+		c.anim.Loops = g.LoopCount + 1
+	}
+
+	for i, img := range g.Image {
+		d := disposeNone
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				d = disposeBackground
+			case gif.DisposalPrevious:
+				d = disposePrevious
+			}
+		}
+		dt := time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		if err := c.add(img, img.Bounds(), true, d, dt); err != nil {
+			return nil, err
+		}
+	}
+	return c.animation(), nil
+}
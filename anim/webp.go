@@ -0,0 +1,136 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package anim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"time"
+)
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+type riffChunk struct {
+	typ  string
+	data []byte
+}
+
+func readRIFF(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	for p := 0; p < len(data); {
+		if p+8 > len(data) {
+			return nil, ErrFormat
+		}
+		n := int(binary.LittleEndian.Uint32(data[p+4:]))
+		if n < 0 || p+8+n > len(data) {
+			return nil, ErrFormat
+		}
+		chunks = append(chunks, riffChunk{string(data[p : p+4]), data[p+8 : p+8+n]})
+		p += 8 + n + n&1
+	}
+	return chunks, nil
+}
+
+func writeRIFF(b *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(data)))
+	b.WriteString(typ)
+	b.Write(n[:])
+	b.Write(data)
+	if len(data)&1 == 1 {
+		b.WriteByte(0)
+	}
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func decodeWebP(data []byte, still StillDecoder) (*Animation, error) {
+	chunks, err := readRIFF(data[12:])
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "VP8X" || len(chunks[0].data) < 10 {
+		return nil, nil
+	}
+	vp8x := chunks[0].data
+	if vp8x[0]&0x02 == 0 {
+		return nil, nil
+	}
+
+	c, err := newCanvas(uint24(vp8x[4:])+1, uint24(vp8x[7:])+1)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range chunks[1:] {
+		switch ch.typ {
+		case "ANIM":
+			if len(ch.data) < 6 {
+				return nil, ErrFormat
+			}
+			c.anim.Loops = int(binary.LittleEndian.Uint16(ch.data[4:]))
+		case "ANMF":
+			if len(ch.data) < 16 {
+				return nil, ErrFormat
+			}
+			d := ch.data
+			x, y := uint24(d)*2, uint24(d[3:])*2
+			w, h := uint24(d[6:])+1, uint24(d[9:])+1
+			dt := time.Duration(uint24(d[12:])) * time.Millisecond
+			over := d[15]&0x02 == 0
+			dispose := disposeNone
+			if d[15]&0x01 != 0 {
+				dispose = disposeBackground
+			}
+
+			img, err := still(stillWebP(d[16:], w, h))
+			if err != nil {
+				return nil, err
+			}
+			if err := c.add(img, image.Rect(x, y, x+w, y+h), over, dispose, dt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c.animation(), nil
+}
+
+// stillWebP makes a WebP file of the image data of a frame, given as
+// ALPH, VP8 or VP8L chunks.
+func stillWebP(data []byte, w, h int) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if bytes.HasPrefix(data, []byte("ALPH")) {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10
+		putUint24(vp8x[4:], w-1)
+		putUint24(vp8x[7:], h-1)
+		writeRIFF(&body, "VP8X", vp8x)
+	}
+	body.Write(data)
+
+	var b bytes.Buffer
+	writeRIFF(&b, "RIFF", body.Bytes())
+	return b.Bytes()
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"github.com/salviati/gomics/anim"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/decode"
+	"image"
+	"io"
+	"log"
+	"time"
+)
+
+// Pages with these extensions are checked for animation frames past
+// the first, which is all gdk-pixbuf's loader gives us.
+var animatedExtensions = []string{".gif", ".png", ".webp"}
+
+const (
+	sideLeft  = iota // PixbufL
+	sideRight        // PixbufR
+)
+
+type pageAnimation struct {
+	anim   *anim.Animation
+	frame  int
+	played int // times the animation was played through
+	timer  glib.SourceHandle
+	mem    *budget.Handle // of the frames
+}
+
+type animations struct {
+	pages   [2]*pageAnimation // of PixbufL and PixbufR
+	playing bool
+	gen     int           // invalidates timers of pages that are gone
+	cancel  chan struct{} // closed when the pages being decoded are gone
+}
+
+func (a *animations) stop() {
+	a.gen++
+	for _, p := range a.pages {
+		if p != nil && p.timer != 0 {
+			glib.SourceRemove(p.timer)
+			p.timer = 0
+		}
+	}
+}
+
+func (a *animations) reset() {
+	a.stop()
+	if a.cancel != nil {
+		close(a.cancel)
+		a.cancel = nil
+	}
+	for _, p := range a.pages {
+		if p != nil {
+			p.mem.Release()
+		}
+	}
+	a.pages = [2]*pageAnimation{}
+}
+
+// decodeStill decodes the frames of animated WebP images, as the
+// standard library can't.
+func decodeStill(data []byte) (image.Image, error) {
+	img, _, err := decode.Decode(data)
+	return img, err
+}
+
+// mayBeAnimated reports whether page n is of a format that can be
+// animated.
+func (gui *GUI) mayBeAnimated(n int) bool {
+	name, err := gui.State.Archive.Name(n)
+	return err == nil && archive.ExtensionMatch(name, animatedExtensions)
+}
+
+// loadAnimation returns the frames of page n of ar, or nil if it's a
+// still.
+func loadAnimation(ar archive.Archive, n int) *anim.Animation {
+	name, err := ar.Name(n)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	r, err := ar.Open(n)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	a, err := anim.Decode(data, decodeStill)
+	if err != nil {
+		log.Println(name+":", err)
+		return nil
+	}
+	return a
+}
+
+// loadAnimations looks for animations on the pages just loaded, and
+// plays them if playback is on. Decoding every frame takes a while, so
+// it's done in the background, with the pages showing as stills in the
+// meantime. The archive is opened anew so as not to get in the way of
+// the viewer.
+func (gui *GUI) loadAnimations() {
+	pages := []int{-1, -1}
+	if gui.mayBeAnimated(gui.State.ArchivePos) {
+		pages[sideLeft] = gui.State.ArchivePos
+	}
+	if gui.State.PixbufR != nil && gui.mayBeAnimated(gui.State.ArchivePosR) {
+		pages[sideRight] = gui.State.ArchivePosR
+	}
+	if pages[sideLeft] < 0 && pages[sideRight] < 0 {
+		return
+	}
+
+	cancel := make(chan struct{})
+	gui.Anim.cancel = cancel
+	path := gui.State.ArchivePath
+	go func() {
+		ar, err := archive.NewArchive(path)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ar.Close()
+
+		for side, n := range pages {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			if n < 0 {
+				continue
+			}
+			a := loadAnimation(ar, n)
+			if a == nil {
+				continue
+			}
+			side := side
+			glib.IdleAdd(func() {
+				if gui.Anim.cancel != cancel {
+					return
+				}
+				gui.Anim.pages[side] = gui.newPageAnimation(a)
+				if gui.Anim.playing {
+					gui.playAnimation(side)
+				}
+			})
+		}
+	}()
+}
+
+func (gui *GUI) newPageAnimation(a *anim.Animation) *pageAnimation {
+	var size int64
+	for _, f := range a.Frames {
+		size += int64(len(f.Image.Pix))
+	}
+	return &pageAnimation{anim: a, mem: gui.Memory.Hold(budget.Pages, size, nil)}
+}
+
+func (gui *GUI) playAnimations() {
+	for side, p := range gui.Anim.pages {
+		if p != nil {
+			gui.playAnimation(side)
+		}
+	}
+}
+
+func (gui *GUI) playAnimation(side int) {
+	p := gui.Anim.pages[side]
+	if p.anim.Loops > 0 && p.played >= p.anim.Loops {
+		p.played = 0
+		gui.showFrame(side, 0)
+	}
+	gui.scheduleFrame(side)
+}
+
+func (gui *GUI) scheduleFrame(side int) {
+	p, gen := gui.Anim.pages[side], gui.Anim.gen
+	delay := p.anim.Frames[p.frame].Delay
+	h, err := glib.TimeoutAdd(uint(delay/time.Millisecond), func() bool {
+		if gen == gui.Anim.gen {
+			p.timer = 0
+			gui.nextFrame(side)
+		}
+		return false
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	p.timer = h
+}
+
+// nextFrame advances a playing animation, stopping on the last frame
+// once it has looped as many times as it asks for.
+func (gui *GUI) nextFrame(side int) {
+	p := gui.Anim.pages[side]
+	frame := p.frame + 1
+	if frame == len(p.anim.Frames) {
+		p.played++
+		if p.anim.Loops > 0 && p.played >= p.anim.Loops {
+			return
+		}
+		frame = 0
+	}
+	gui.showFrame(side, frame)
+	gui.scheduleFrame(side)
+}
+
+// showFrame makes frame the pixbuf of the page, and redraws it alone.
+func (gui *GUI) showFrame(side, frame int) {
+	p := gui.Anim.pages[side]
+	p.frame = frame
+	pixbuf, err := archive.ImagePixbuf(p.anim.Frames[frame].Image)
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+
+	view := &gui.ViewL
+	if side == sideLeft {
+		gui.State.PixbufL = pixbuf
+	} else {
+		gui.State.PixbufR = pixbuf
+	}
+	gui.holdPage(side, pixbuf)
+	if gui.Config.DoublePage && !gui.forceSinglePage() {
+		if (side == sideRight) != gui.Config.MangaMode {
+			view = &gui.ViewR
+		}
+	} else if side == sideRight {
+		return
+	}
+	gui.blit(view, pixbuf, gui.pageKey(side), gui.State.Scale)
+}
+
+func (gui *GUI) SetPlayAnimations(play bool) {
+	if play == gui.Anim.playing {
+		return
+	}
+	gui.Anim.playing = play
+	gui.MenuItemPlayAnimations.SetActive(play)
+	if play {
+		gui.playAnimations()
+	} else {
+		gui.Anim.stop()
+	}
+}
+
+// StepFrame pauses the animations on the page and shows the frame
+// step frames away.
+func (gui *GUI) StepFrame(step int) {
+	gui.SetPlayAnimations(false)
+	for side, p := range gui.Anim.pages {
+		if p != nil {
+			gui.showFrame(side, wrap(p.frame+step, 0, len(p.anim.Frames)))
+		}
+	}
+}
@@ -18,6 +18,7 @@ package archive
 import (
 	"errors"
 	"github.com/gotk3/gotk3/gdk"
+	"io"
 	"path/filepath"
 	"strings"
 )
@@ -28,6 +29,7 @@ var (
 
 type Archive interface {
 	Load(i int, autorotate bool) (*gdk.Pixbuf, error)
+	Open(i int) (io.ReadCloser, error) // the page's file, as stored
 	Name(i int) (string, error)
 	Len() int
 	Close() error
@@ -38,11 +40,24 @@ const (
 )
 
 func NewArchive(path string) (Archive, error) {
+	if IsPSE(path) {
+		return NewPSE(path)
+	}
+	if IsRemote(path) {
+		return NewRemote(path)
+	}
+	if IsDir(path) {
+		return NewDir(path)
+	}
 
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".zip", ".cbz":
 		return NewZip(path)
-	case ".7z", ".rar", ".tar", ".tgz", ".tbz2", ".cb7", ".cbr", ".cbt", ".lha":
+	case ".7z", ".cb7":
+		return NewSevenZip(path)
+	case ".rar", ".cbr":
+		return NewRar(path)
+	case ".tar", ".tgz", ".tbz2", ".cbt", ".lha":
 		// TODO
 	case ".gz":
 		if strings.HasSuffix(strings.ToLower(path), ".tar.gz") {
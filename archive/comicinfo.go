@@ -0,0 +1,99 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const comicInfoName = "ComicInfo.xml"
+
+// ComicInfo is the metadata stored in the ComicInfo.xml file of an
+// archive, as written by ComicRack and most comic managers. Only the
+// commonly used fields are read.
+type ComicInfo struct {
+	Title       string
+	Series      string
+	Number      string
+	Volume      int
+	Count       int
+	Summary     string
+	Year        int
+	Month       int
+	Writer      string
+	Penciller   string
+	Publisher   string
+	Genre       string
+	PageCount   int
+	Manga       string
+	LanguageISO string
+}
+
+// ReadComicInfo returns the metadata of the archive or directory at
+// path, or nil if it has none.
+func ReadComicInfo(path string) (*ComicInfo, error) {
+	data, err := ComicInfoXML(path)
+	if data == nil || err != nil {
+		return nil, err
+	}
+	info := new(ComicInfo)
+	if err := xml.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ComicInfoXML returns the ComicInfo.xml file of the zip, 7z or RAR
+// archive or directory at path as it is, or nil if it has none.
+func ComicInfoXML(path string) ([]byte, error) {
+	if IsDir(path) {
+		data, err := os.ReadFile(filepath.Join(path, comicInfoName))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return data, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".7z", ".cb7":
+		return sevenZipEntry(path, comicInfoName)
+	case ".rar", ".cbr":
+		return rarEntry(path, comicInfoName)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !strings.EqualFold(f.Name, comicInfoName) {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/salviati/gomics/decode"
+	"golang.org/x/image/webp"
+	"image"
+	"image/draw"
+)
+
+// Pages in these formats are decoded in Go, so that they show whether
+// or not a gdk-pixbuf loader for them is installed. AVIF and JPEG XL
+// are decoded in Go only with the wasmdecoders build tag, see
+// decoders_wasm.go; without it, their pages are still listed, and
+// LoadPixbuf leaves them to gdk-pixbuf.
+func init() {
+	register(decode.Format{Name: "webp", Extensions: []string{".webp"}, Match: decode.IsWebP, Decode: webp.Decode})
+	addImageExtensions(".avif", ".jxl")
+}
+
+// register registers f with package decode, and lists its extensions
+// with the images found in archives.
+func register(f decode.Format) {
+	decode.Register(f)
+	addImageExtensions(f.Extensions...)
+}
+
+// addImageExtensions lists extensions with the images found in
+// archives, unless they already are.
+func addImageExtensions(extensions ...string) {
+	for _, ext := range extensions {
+		if !ExtensionMatch(ext, ImageExtensions) {
+			ImageExtensions = append(ImageExtensions, ext)
+		}
+	}
+}
+
+// ImagePixbuf copies img into a new pixbuf with an alpha channel.
+func ImagePixbuf(img image.Image) (*gdk.Pixbuf, error) {
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	w, h := nrgba.Rect.Dx(), nrgba.Rect.Dy()
+	p, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, true, 8, w, h)
+	if err != nil {
+		return nil, err
+	}
+	rowstride := p.GetRowstride()
+	data := p.GetPixels()
+	for y := 0; y < h; y++ {
+		copy(data[y*rowstride:y*rowstride+4*w], nrgba.Pix[y*nrgba.Stride:])
+	}
+	return p, nil
+}
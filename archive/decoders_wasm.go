@@ -0,0 +1,35 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build wasmdecoders
+// +build wasmdecoders
+
+package archive
+
+import (
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/jpegxl"
+	"github.com/salviati/gomics/decode"
+)
+
+// AVIF and JPEG XL go through libavif and libjxl built to WebAssembly,
+// which adds a WebAssembly runtime and several megabytes to the binary,
+// so they're only built in with the wasmdecoders tag. Without it, these
+// pages are still listed but left to gdk-pixbuf loaders, if any are
+// installed.
+func init() {
+	register(decode.Format{Name: "avif", Extensions: []string{".avif"}, Match: decode.IsAVIF, Decode: avif.Decode})
+	register(decode.Format{Name: "jxl", Extensions: []string{".jxl"}, Match: decode.IsJXL, Decode: jpegxl.Decode})
+}
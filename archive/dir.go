@@ -15,4 +15,90 @@
 
 package archive
 
-// TODO
+import (
+	"errors"
+	"github.com/gotk3/gotk3/gdk"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Dir is a directory of images, read like an archive. Subdirectories
+// are not looked into.
+type Dir struct {
+	path  string
+	names []string // sorted like the files of a Zip
+}
+
+// IsDir reports whether path is a directory.
+func IsDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func NewDir(path string) (*Dir, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &Dir{path: path}
+	for _, name := range names {
+		if ExtensionMatch(name, ImageExtensions) {
+			ar.names = append(ar.names, name)
+		}
+	}
+	if len(ar.names) == 0 {
+		return nil, errors.New(filepath.Base(path) + ": no images in the directory")
+	}
+	sort.Slice(ar.names, func(i, j int) bool { return strcmp(ar.names[i], ar.names[j], true) })
+
+	return ar, nil
+}
+
+func (ar *Dir) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.names) {
+		return ErrBounds
+	}
+	return nil
+}
+
+func (ar *Dir) Open(i int) (io.ReadCloser, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(ar.path, ar.names[i]))
+}
+
+func (ar *Dir) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+	f, err := ar.Open(i)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return LoadPixbuf(f, autorotate)
+}
+
+func (ar *Dir) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.names[i], nil
+}
+
+func (ar *Dir) Len() int {
+	return len(ar.names)
+}
+
+func (ar *Dir) Close() error {
+	return nil
+}
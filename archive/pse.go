@@ -0,0 +1,145 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/salviati/gomics/httpfile"
+	"github.com/salviati/gomics/opds"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Width asked of servers that scale streamed pages down. It's large
+// enough that pages are effectively sent as they are.
+const pseMaxWidth = 4096
+
+// PSE is a book streamed page by page from an OPDS server, using the
+// OPDS Page Streaming Extension. Pages are fetched when they are loaded.
+//
+// The stream link, the page count and the title of the book are all
+// kept in a single URI (see PSEURI), so that the book can be reopened
+// from bookmarks and recent files like any other archive.
+type PSE struct {
+	link  opds.Link
+	title string
+}
+
+// PSEURI returns the URI of the book with the given stream link.
+func PSEURI(l *opds.Link, title string) string {
+	v := url.Values{}
+	v.Set("pse-count", strconv.Itoa(l.Count))
+	v.Set("title", title)
+	return l.Href + "#" + v.Encode()
+}
+
+// pseParams splits a URI made by PSEURI into the stream link and the
+// parameters stored in its fragment.
+func pseParams(uri string) (href string, v url.Values, ok bool) {
+	i := strings.LastIndex(uri, "#")
+	if !IsRemote(uri) || i < 0 {
+		return "", nil, false
+	}
+	v, err := url.ParseQuery(uri[i+1:])
+	if err != nil || v.Get("pse-count") == "" {
+		return "", nil, false
+	}
+	return uri[:i], v, true
+}
+
+// IsPSE reports whether uri was made by PSEURI.
+func IsPSE(uri string) bool {
+	_, _, ok := pseParams(uri)
+	return ok
+}
+
+func NewPSE(uri string) (*PSE, error) {
+	href, v, ok := pseParams(uri)
+	if !ok {
+		return nil, errors.New("Not a page stream: " + uri)
+	}
+	count, err := strconv.Atoi(v.Get("pse-count"))
+	if err != nil || count <= 0 {
+		return nil, errors.New("Invalid page count in " + uri)
+	}
+
+	ar := &PSE{
+		link:  opds.Link{Rel: opds.RelStream, Href: href, Count: count},
+		title: v.Get("title"),
+	}
+	return ar, nil
+}
+
+func (ar *PSE) checkbounds(i int) error {
+	if i < 0 || i >= ar.link.Count {
+		return ErrBounds
+	}
+	return nil
+}
+
+// pseClient fetches pages, which are small enough to be given a minute
+// in all.
+var pseClient = &http.Client{Transport: httpfile.DefaultClient.Transport, Timeout: time.Minute}
+
+func (ar *PSE) Open(i int) (io.ReadCloser, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+
+	req, err := httpfile.NewRequest(ar.link.PageURL(i, pseMaxWidth))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pseClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Page %d: %s", i+1, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (ar *PSE) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+	r, err := ar.Open(i)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return LoadPixbuf(r, autorotate)
+}
+
+func (ar *PSE) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %d", ar.title, i+1), nil
+}
+
+func (ar *PSE) Len() int {
+	return ar.link.Count
+}
+
+func (ar *PSE) Close() error {
+	return nil
+}
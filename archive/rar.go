@@ -0,0 +1,156 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/nwaples/rardecode"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Rar is a RAR archive, as .rar and .cbr files are. RAR files can only
+// be read front to back, so a page is read by going through the
+// archive up to it; in solid archives, that means decompressing the
+// pages before it too.
+type Rar struct {
+	path  string
+	names []string // of the images, sorted
+	name  string   // Name of the RAR file
+}
+
+// NewRar lists the images of a RAR archive, multi-volume ones included.
+func NewRar(name string) (*Rar, error) {
+	ar := &Rar{path: name, name: path.Base(name)}
+	err := ar.walk(func(h *rardecode.FileHeader, r io.Reader) (bool, error) {
+		if !h.IsDir && ExtensionMatch(h.Name, ImageExtensions) {
+			ar.names = append(ar.names, h.Name)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ar.names) == 0 {
+		return nil, errors.New(ar.name + ": no images in the RAR file")
+	}
+	sort.Slice(ar.names, func(i, j int) bool { return strcmp(ar.names[i], ar.names[j], true) })
+
+	return ar, nil
+}
+
+// walkRar calls fn for the entries of the archive at p in order, with a
+// reader of the entry, until fn returns true or an error.
+func walkRar(p string, fn func(h *rardecode.FileHeader, r io.Reader) (bool, error)) error {
+	rc, err := rardecode.OpenReader(p, "")
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	for {
+		h, err := rc.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if done, err := fn(h, rc); done || err != nil {
+			return err
+		}
+	}
+}
+
+func (ar *Rar) walk(fn func(h *rardecode.FileHeader, r io.Reader) (bool, error)) error {
+	return walkRar(ar.path, fn)
+}
+
+// rarEntry returns the file of the RAR archive at p named name,
+// regardless of case, or nil if there's none.
+func rarEntry(p, name string) (data []byte, err error) {
+	err = walkRar(p, func(h *rardecode.FileHeader, r io.Reader) (bool, error) {
+		if h.IsDir || !strings.EqualFold(h.Name, name) {
+			return false, nil
+		}
+		data, err = io.ReadAll(r)
+		return true, err
+	})
+	return data, err
+}
+
+func (ar *Rar) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.names) {
+		return ErrBounds
+	}
+	return nil
+}
+
+// Open reads page i whole, as the archive can't be kept open at it.
+func (ar *Rar) Open(i int) (io.ReadCloser, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	found := false
+	err := ar.walk(func(h *rardecode.FileHeader, r io.Reader) (bool, error) {
+		if h.Name != ar.names[i] {
+			return false, nil
+		}
+		var err error
+		data, err = io.ReadAll(r)
+		found = true
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New(ar.name + ": " + ar.names[i] + " is gone")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ar *Rar) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+	f, err := ar.Open(i)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return LoadPixbuf(f, autorotate)
+}
+
+func (ar *Rar) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.names[i], nil
+}
+
+func (ar *Rar) Len() int {
+	return len(ar.names)
+}
+
+func (ar *Rar) Close() error {
+	return nil
+}
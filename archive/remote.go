@@ -0,0 +1,69 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"github.com/salviati/gomics/httpfile"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// IsRemote reports whether uri is an http or https URL.
+func IsRemote(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// RemoteURI returns href with the given title attached, for RemoteName
+// to find.
+func RemoteURI(href, title string) string {
+	return href + "#" + url.Values{"title": {title}}.Encode()
+}
+
+// RemoteName returns a readable name for the archive at the given URL.
+func RemoteName(uri string) string {
+	if i := strings.LastIndex(uri, "#"); i >= 0 {
+		if v, err := url.ParseQuery(uri[i+1:]); err == nil && v.Get("title") != "" {
+			return v.Get("title")
+		}
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return uri
+	}
+	return path.Base(u.Path)
+}
+
+// NewRemote opens a zip archive over http or https. Only the parts of
+// the file that are actually read are downloaded, if the server
+// supports range requests.
+//
+// URLs often don't end in a file name (OPDS acquisition links, for
+// instance), so the archive is assumed to be a zip file regardless.
+func NewRemote(uri string) (Archive, error) {
+	f, err := httpfile.Open(uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ar, err := NewZipReader(f, f.Size(), RemoteName(uri), f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ar, nil
+}
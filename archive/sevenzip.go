@@ -0,0 +1,117 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"errors"
+	"github.com/bodgit/sevenzip"
+	"github.com/gotk3/gotk3/gdk"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+type SevenZip struct {
+	files  []*sevenzip.File // File elements sorted by their Names
+	reader *sevenzip.ReadCloser
+	name   string // Name of the 7z file
+}
+
+// NewSevenZip opens a 7z archive, as .7z and .cb7 files are.
+func NewSevenZip(name string) (*SevenZip, error) {
+	r, err := sevenzip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &SevenZip{reader: r, name: path.Base(name)}
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() && ExtensionMatch(f.Name, ImageExtensions) {
+			ar.files = append(ar.files, f)
+		}
+	}
+	if len(ar.files) == 0 {
+		r.Close()
+		return nil, errors.New(ar.name + ": no images in the 7z file")
+	}
+	sort.Slice(ar.files, func(i, j int) bool { return strcmp(ar.files[i].Name, ar.files[j].Name, true) })
+
+	return ar, nil
+}
+
+func (ar *SevenZip) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.files) {
+		return ErrBounds
+	}
+	return nil
+}
+
+func (ar *SevenZip) Open(i int) (io.ReadCloser, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+	return ar.files[i].Open()
+}
+
+func (ar *SevenZip) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+	f, err := ar.Open(i)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return LoadPixbuf(f, autorotate)
+}
+
+func (ar *SevenZip) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.files[i].Name, nil
+}
+
+func (ar *SevenZip) Len() int {
+	return len(ar.files)
+}
+
+func (ar *SevenZip) Close() error {
+	return ar.reader.Close()
+}
+
+// sevenZipEntry returns the file of the 7z archive at path named name,
+// regardless of case, or nil if there's none.
+func sevenZipEntry(p, name string) ([]byte, error) {
+	r, err := sevenzip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !strings.EqualFold(f.Name, name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, nil
+}
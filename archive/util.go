@@ -17,10 +17,12 @@ package archive
 
 import (
 	"bytes"
-	"github.com/salviati/gomics/natsort"
 	"errors"
 	"github.com/gotk3/gotk3/gdk"
+	"github.com/salviati/gomics/decode"
+	"github.com/salviati/gomics/natsort"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -35,8 +37,8 @@ type Loader interface {
 
 // TODO(utkan): check rar support
 
-//var ArchiveExtensions = []string{".zip", ".cbz", ".7z", ".rar", ".tar", ".tgz", ".tbz2", ".cb7", ".cbr", ".cbt"}
-var ArchiveExtensions = []string{".zip", ".cbz"}
+// var ArchiveExtensions = []string{".zip", ".cbz", ".7z", ".rar", ".tar", ".tgz", ".tbz2", ".cb7", ".cbr", ".cbt"}
+var ArchiveExtensions = []string{".zip", ".cbz", ".7z", ".cb7", ".rar", ".cbr"}
 var ImageExtensions = []string{ // FIXME(utkan): Use gdk_pixbuf_get_formats()
 	".jpg", ".jpeg", ".gif", ".png", ".tif", ".bmp", ".pcx", ".xv", ".xpm",
 	".xcf", ".tif", ".tga", ".pnm", ".lbm", ".cur", ".ico",
@@ -75,10 +77,16 @@ func wrap(val, low, mod int) int {
 	return val
 }
 
+// ArchiveLess defines the order in which the archives of a directory
+// are visited.
+func ArchiveLess(a, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
 type stringArray []string
 
 func (p stringArray) Len() int           { return len(p) }
-func (p stringArray) Less(i, j int) bool { return strings.ToLower(p[i]) < strings.ToLower(p[j]) }
+func (p stringArray) Less(i, j int) bool { return ArchiveLess(p[i], p[j]) }
 func (p stringArray) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 func ListArchives(dir string) (anames []string, err error) {
@@ -116,11 +124,24 @@ func ListArchives(dir string) (anames []string, err error) {
 	return
 }
 
+// LoadPixbuf decodes an image with the registered decoders, or with
+// gdk-pixbuf if none of them knows it or can decode it. autorotate
+// applies the embedded orientation of images gdk-pixbuf decodes only;
+// the registered decoders show images as they're stored.
 func LoadPixbuf(r io.Reader, autorotate bool) (*gdk.Pixbuf, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if img, f, err := decode.Decode(data); err == nil {
+		return ImagePixbuf(img)
+	} else if f != nil {
+		log.Println(f.Name+":", err)
+	}
+
 	w, _ := gdk.PixbufLoaderNew()
 	defer w.Close()
-	_, err := io.Copy(w, r)
-	if err != nil {
+	if _, err := w.Write(data); err != nil {
 		return nil, err
 	}
 
@@ -19,13 +19,16 @@ import (
 	"archive/zip"
 	"errors"
 	"github.com/gotk3/gotk3/gdk"
+	"io"
+	"os"
 	"path"
 	"sort"
 )
 
 type Zip struct {
 	files  []*zip.File // File elements sorted by their Names
-	reader *zip.ReadCloser
+	reader *zip.Reader
+	closer io.Closer
 	name   string // Name of the Zip file
 }
 
@@ -37,13 +40,36 @@ func (p zipfile) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 /* Reads filenames from a given zip archive, and sorts them */
 func NewZip(name string) (*Zip, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ar, err := NewZipReader(f, fi.Size(), name, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ar, nil
+}
+
+// NewZipReader reads a zip archive of the given size from r. The
+// closer, if not nil, is closed along with the archive.
+func NewZipReader(r io.ReaderAt, size int64, name string, closer io.Closer) (*Zip, error) {
 	var err error
 
 	ar := new(Zip)
 
 	ar.name = path.Base(name)
+	ar.closer = closer
 	ar.files = make([]*zip.File, 0, MaxArchiveEntries)
-	ar.reader, err = zip.OpenReader(name)
+	ar.reader, err = zip.NewReader(r, size)
 	if err != nil {
 		return nil, err
 	}
@@ -71,12 +97,15 @@ func (ar *Zip) checkbounds(i int) error {
 	return nil
 }
 
-func (ar *Zip) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+func (ar *Zip) Open(i int) (io.ReadCloser, error) {
 	if err := ar.checkbounds(i); err != nil {
 		return nil, err
 	}
+	return ar.files[i].Open()
+}
 
-	f, err := ar.files[i].Open()
+func (ar *Zip) Load(i int, autorotate bool) (*gdk.Pixbuf, error) {
+	f, err := ar.Open(i)
 	if err != nil {
 		return nil, err
 	}
@@ -98,5 +127,8 @@ func (ar *Zip) Len() int {
 }
 
 func (ar *Zip) Close() error {
-	return ar.reader.Close()
+	if ar.closer == nil {
+		return nil
+	}
+	return ar.closer.Close()
 }
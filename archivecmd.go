@@ -0,0 +1,322 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	lsNumber      bool
+	extractNumber bool
+	infoJSON      bool
+	verifyQuiet   bool
+)
+
+func lsFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&lsNumber, "n", false, "number the pages")
+}
+
+func extractFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&extractNumber, "n", false, "prefix file names with the page number, to keep them in reading order")
+}
+
+func infoFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&infoJSON, "json", false, "print JSON")
+}
+
+func verifyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verifyQuiet, "q", false, "only report archives with errors")
+}
+
+// runLs prints the pages of an archive in the order the viewer shows
+// them.
+func runLs(fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	ar, err := archive.NewArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	for i := 0; i < ar.Len(); i++ {
+		name, err := ar.Name(i)
+		if err != nil {
+			return err
+		}
+		if lsNumber {
+			fmt.Printf("%d\t%s\n", i+1, name)
+		} else {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
+
+// parsePages parses a 1-based page range such as 3, 2-5, 4- or -4 and
+// returns the 0-based indices of its first and last page.
+func parsePages(s string, n int) (first, last int, err error) {
+	bad := fmt.Errorf("invalid page range %q, the archive has %d pages", s, n)
+
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+		if from == "" {
+			from = "1"
+		}
+		if to == "" {
+			to = strconv.Itoa(n)
+		}
+	}
+
+	a, err1 := strconv.Atoi(from)
+	b, err2 := strconv.Atoi(to)
+	if err1 != nil || err2 != nil || a < 1 || b > n || a > b {
+		return 0, 0, bad
+	}
+	return a - 1, b - 1, nil
+}
+
+// runExtract copies pages out of an archive as they are stored, without
+// decoding them.
+func runExtract(fs *flag.FlagSet, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	ar, err := archive.NewArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	first, last, err := parsePages(args[1], ar.Len())
+	if err != nil {
+		return err
+	}
+	dir := args[2]
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	width := len(strconv.Itoa(ar.Len()))
+	for i := first; i <= last; i++ {
+		name, err := ar.Name(i)
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(filepath.FromSlash(name))
+		if extractNumber {
+			name = fmt.Sprintf("%0*d-%s", width, i+1, name)
+		}
+		if err := extractPage(ar, i, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractPage(ar archive.Archive, i int, path string) error {
+	r, err := ar.Open(i)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Pages in different directories of the archive may share a
+	// name; never overwrite one with another.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+type pageInfo struct {
+	Name   string
+	Width  int
+	Height int
+	Error  string `json:",omitempty"`
+}
+
+type archiveInfo struct {
+	Path      string
+	Size      int64 `json:",omitempty"`
+	Pages     []pageInfo
+	ComicInfo *archive.ComicInfo `json:",omitempty"`
+}
+
+// pageSize returns the dimensions of a page. Only the header is read
+// for the formats Go knows; the others are decoded in full.
+func pageSize(ar archive.Archive, i int) (int, int, error) {
+	r, err := ar.Open(i)
+	if err != nil {
+		return 0, 0, err
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	r.Close()
+	if err == nil {
+		return cfg.Width, cfg.Height, nil
+	}
+
+	pixbuf, err := ar.Load(i, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pixbuf.GetWidth(), pixbuf.GetHeight(), nil
+}
+
+func runInfo(fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	ar, err := archive.NewArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	info := archiveInfo{Path: args[0], Pages: make([]pageInfo, ar.Len())}
+	if !archive.IsRemote(args[0]) {
+		if fi, err := os.Stat(args[0]); err == nil {
+			info.Size = fi.Size()
+		}
+		// Only archives of files and directories can have one.
+		switch ar.(type) {
+		case *archive.Zip, *archive.SevenZip, *archive.Rar, *archive.Dir:
+			if info.ComicInfo, err = archive.ReadComicInfo(args[0]); err != nil {
+				fmt.Fprintln(os.Stderr, "ComicInfo.xml:", err)
+			}
+		}
+	}
+	for i := range info.Pages {
+		p := &info.Pages[i]
+		p.Name, _ = ar.Name(i)
+		if p.Width, p.Height, err = pageSize(ar, i); err != nil {
+			p.Error = err.Error()
+		}
+	}
+
+	if infoJSON {
+		data, err := json.MarshalIndent(info, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", info.Path)
+	if info.Size > 0 {
+		fmt.Fprintf(w, "Size:\t%d bytes\n", info.Size)
+	}
+	fmt.Fprintf(w, "Pages:\t%d\n", len(info.Pages))
+	if c := info.ComicInfo; c != nil {
+		fields := []struct{ name, value string }{
+			{"Title", c.Title}, {"Series", c.Series}, {"Number", c.Number},
+			{"Writer", c.Writer}, {"Penciller", c.Penciller}, {"Publisher", c.Publisher},
+			{"Genre", c.Genre}, {"Manga", c.Manga}, {"Language", c.LanguageISO},
+		}
+		if c.Year > 0 {
+			fields = append(fields, struct{ name, value string }{"Year", strconv.Itoa(c.Year)})
+		}
+		for _, f := range fields {
+			if f.value != "" {
+				fmt.Fprintf(w, "%s:\t%s\n", f.name, f.value)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+	for i, p := range info.Pages {
+		if p.Error != "" {
+			fmt.Fprintf(w, "%d\t%s\terror: %s\n", i+1, p.Name, p.Error)
+		} else {
+			fmt.Fprintf(w, "%d\t%s\t%dx%d\n", i+1, p.Name, p.Width, p.Height)
+		}
+	}
+	return w.Flush()
+}
+
+// runVerify decodes every page of the given archives, the way the
+// viewer would, and reports the ones that fail.
+func runVerify(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	failed := 0
+	for _, path := range args {
+		if errs := verifyArchive(path); len(errs) > 0 {
+			failed++
+			for _, err := range errs {
+				fmt.Printf("%s: %v\n", path, err)
+			}
+		} else if !verifyQuiet {
+			fmt.Printf("%s: OK\n", path)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed", failed, len(args))
+	}
+	return nil
+}
+
+func verifyArchive(path string) (errs []error) {
+	ar, err := archive.NewArchive(path)
+	if err != nil {
+		return []error{err}
+	}
+	defer ar.Close()
+
+	if ar.Len() == 0 {
+		return []error{errors.New("no pages")}
+	}
+	mem := budget.New(defaultMemoryBudget << 20)
+	for i := 0; i < ar.Len(); i++ {
+		// Reading a zip entry to the end also checks its CRC.
+		pixbuf, err := ar.Load(i, false)
+		if err != nil {
+			name, _ := ar.Name(i)
+			errs = append(errs, fmt.Errorf("page %d (%s): %v", i+1, name, err))
+			continue
+		}
+		mem.Discard(pixbufBytes(pixbuf))
+	}
+	return errs
+}
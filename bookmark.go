@@ -17,39 +17,171 @@ package main
 
 import (
 	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/library"
+	"log"
+	"os"
 	"path/filepath"
 	"time"
 )
 
 var bookmarkMenuItems []*gtk.MenuItem
 
-type Bookmark struct {
-	Path       string
-	Page       uint
-	TotalPages uint
-	Added      time.Time
+const thumbnailSize = 128
+
+// Columns of the bookmarks manager's list store.
+const (
+	bookmarkColumnThumbnail = iota
+	bookmarkColumnName
+	bookmarkColumnArchive
+	bookmarkColumnPage
+	bookmarkColumnNote
+	bookmarkColumnID
+)
+
+func (gui *GUI) bookmarksPath() string {
+	return filepath.Join(gui.State.ConfigPath, BookmarksFile)
+}
+
+func (gui *GUI) thumbnailPath(name string) string {
+	return filepath.Join(gui.State.ConfigPath, ThumbnailDir, name)
+}
+
+// LoadBookmarks reads the bookmarks file. Bookmarks stored in the
+// config file by older versions are moved over to it, unless the file
+// already exists, in which case they were moved before.
+func (gui *GUI) LoadBookmarks() {
+	err := gui.Bookmarks.Load(gui.bookmarksPath())
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+
+	if len(gui.Config.Bookmarks) == 0 {
+		return
+	}
+	if os.IsNotExist(err) {
+		for _, b := range gui.Config.Bookmarks {
+			gui.Bookmarks.Add(b)
+		}
+		if err := gui.Bookmarks.Save(gui.bookmarksPath()); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	// Take them out of the config file right away, so that they
+	// aren't moved again if gomics doesn't quit cleanly.
+	gui.Config.Bookmarks = nil
+	gui.State.ConfigBase.Bookmarks = nil
+	gui.State.ConfigOverride.Bookmarks = nil
+	config := gui.configToSave()
+	if err := config.Save(gui.State.ConfigFile); err != nil {
+		log.Println(err)
+	}
+}
+
+func (gui *GUI) SaveBookmarks() {
+	if err := gui.Bookmarks.Save(gui.bookmarksPath()); err != nil {
+		gui.ShowError(err.Error())
+	}
 }
 
 func (gui *GUI) AddBookmark() {
+	if !gui.Loaded() {
+		return
+	}
+
 	defer gui.RebuildBookmarksMenu()
+	defer gui.SaveBookmarks()
 
-	for i := range gui.Config.Bookmarks {
-		b := &gui.Config.Bookmarks[i]
-		if b.Path == gui.State.ArchivePath {
-			b.Page = uint(gui.State.ArchivePos + 1)
-			b.TotalPages = uint(gui.State.Archive.Len())
+	page := uint(gui.State.ArchivePos + 1)
+	for i := range gui.Bookmarks.Bookmarks {
+		b := &gui.Bookmarks.Bookmarks[i]
+		if b.Path == gui.State.ArchivePath && b.Page == page {
 			b.Added = time.Now()
 			return
 		}
 	}
 
-	gui.Config.Bookmarks = append(gui.Config.Bookmarks, Bookmark{
-		Path:       gui.State.ArchivePath,
-		TotalPages: uint(gui.State.Archive.Len()),
-		Page:       uint(gui.State.ArchivePos + 1),
-		Added:      time.Now(),
+	var seed int64
+	if gui.Config.Random {
+		seed = gui.Config.ShuffleSeed
+	}
+	b := gui.Bookmarks.Add(library.Bookmark{
+		Path:        gui.State.ArchivePath,
+		Fingerprint: gui.State.ArchiveFingerprint,
+		TotalPages:  uint(gui.State.Archive.Len()),
+		Page:        page,
+		Seed:        seed,
 	})
+	b.Thumbnail = gui.saveBookmarkThumbnail(b.ID)
+}
+
+// saveBookmarkThumbnail stores a thumbnail of the current page and
+// returns its file name, or "" on failure.
+func (gui *GUI) saveBookmarkThumbnail(id string) string {
+	if gui.State.PixbufL == nil {
+		return ""
+	}
+
+	pixbuf := gui.State.PixbufL
+	w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), thumbnailSize, thumbnailSize)
+	scaled, err := pixbuf.ScaleSimple(w, h, interpolations[gui.Config.Interpolation])
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	name := id + ".png"
+	if err := scaled.SavePNG(gui.thumbnailPath(name), 5); err != nil {
+		log.Println(err)
+		return ""
+	}
+	return name
+}
+
+func (gui *GUI) RemoveBookmark(id string) {
+	b, ok := gui.Bookmarks.Remove(id)
+	if !ok {
+		return
+	}
+	if b.Thumbnail != "" {
+		os.Remove(gui.thumbnailPath(b.Thumbnail))
+	}
+	gui.SaveBookmarks()
+	gui.RebuildBookmarksMenu()
+}
+
+func (gui *GUI) JumpToBookmark(b *library.Bookmark) {
+	if b.Fingerprint == "" {
+		// Bookmarks made by older versions don't have one.
+		if fp, err := library.Fingerprint(b.Path); err == nil {
+			b.Fingerprint = fp
+			gui.SaveBookmarks()
+		}
+	}
+
+	path, err := gui.locateArchive(b.Path, b.Fingerprint)
+	if err != nil {
+		gui.ShowError("Failed to find " + b.Path + ": " + err.Error())
+		return
+	}
+
+	gui.remember()
+
+	// Restore the order the bookmark was made in, so that reading
+	// goes on from there.
+	if b.Seed != 0 {
+		gui.Config.ShuffleSeed = b.Seed
+		gui.SetRandom(true)
+	}
+
+	if gui.State.ArchivePath != path {
+		gui.LoadArchive(path)
+	}
+	gui.SetPage(int(b.Page) - 1)
 }
 
 func (gui *GUI) RebuildBookmarksMenu() {
@@ -58,25 +190,203 @@ func (gui *GUI) RebuildBookmarksMenu() {
 		bookmarkMenuItems[i].Destroy()
 	}
 	bookmarkMenuItems = nil
-	gc()
 
-	for i := range gui.Config.Bookmarks {
-		bookmark := &gui.Config.Bookmarks[i]
-		base := filepath.Base(bookmark.Path)
-		label := fmt.Sprintf("%s (%d/%d)", base, bookmark.Page, bookmark.TotalPages)
+	for i := range gui.Bookmarks.Bookmarks {
+		id := gui.Bookmarks.Bookmarks[i].ID
+		bookmark := &gui.Bookmarks.Bookmarks[i]
+		label := fmt.Sprintf("%s (%d/%d)", bookmark.Title(), bookmark.Page, bookmark.TotalPages)
 		bookmarkMenuItem, err := gtk.MenuItemNewWithLabel(label)
 		if err != nil {
 			gui.ShowError(err.Error())
 			return
 		}
+		if bookmark.Note != "" {
+			bookmarkMenuItem.SetTooltipText(bookmark.Note)
+		}
 		bookmarkMenuItem.Connect("activate", func() {
-			if gui.State.ArchivePath != bookmark.Path {
-				gui.LoadArchive(bookmark.Path)
+			if b := gui.Bookmarks.Find(id); b != nil {
+				gui.JumpToBookmark(b)
 			}
-			gui.SetPage(int(bookmark.Page) - 1)
 		})
 		bookmarkMenuItems = append(bookmarkMenuItems, bookmarkMenuItem)
 		gui.MenuBookmarks.Append(bookmarkMenuItem)
 	}
 	gui.MenuBookmarks.ShowAll()
 }
+
+func (gui *GUI) initBookmarksDialog() {
+	gui.BookmarksDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+
+	store, err := gtk.ListStoreNew(gdk.PixbufGetType(), glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.BookmarksListStore = store
+	gui.BookmarksTreeView.SetModel(store)
+
+	pixbufRenderer, err := gtk.CellRendererPixbufNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err := gtk.TreeViewColumnNewWithAttribute("", pixbufRenderer, "pixbuf", bookmarkColumnThumbnail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.BookmarksTreeView.AppendColumn(column)
+
+	textColumns := []struct {
+		title    string
+		column   int
+		editable bool
+	}{
+		{"Name", bookmarkColumnName, true},
+		{"Archive", bookmarkColumnArchive, false},
+		{"Page", bookmarkColumnPage, false},
+		{"Note", bookmarkColumnNote, true},
+	}
+	for _, c := range textColumns {
+		renderer, err := gtk.CellRendererTextNew()
+		if err != nil {
+			log.Fatal(err)
+		}
+		column, err := gtk.TreeViewColumnNewWithAttribute(c.title, renderer, "text", c.column)
+		if err != nil {
+			log.Fatal(err)
+		}
+		column.SetResizable(true)
+		gui.BookmarksTreeView.AppendColumn(column)
+
+		if !c.editable {
+			continue
+		}
+		renderer.SetProperty("editable", true)
+		col := c.column
+		renderer.Connect("edited", func(_ *gtk.CellRendererText, path, text string) {
+			iter, err := store.GetIterFromString(path)
+			if err != nil {
+				return
+			}
+			id := gui.bookmarkIDAt(iter)
+			if col == bookmarkColumnName {
+				gui.Bookmarks.Rename(id, text)
+			} else {
+				gui.Bookmarks.SetNote(id, text)
+			}
+			store.SetValue(iter, col, text)
+			gui.SaveBookmarks()
+			gui.RebuildBookmarksMenu()
+		})
+	}
+
+	gui.BookmarksTreeView.Connect("row-activated", gui.jumpToSelectedBookmark)
+	gui.BookmarksJumpButton.Connect("clicked", gui.jumpToSelectedBookmark)
+
+	gui.BookmarksDeleteButton.Connect("clicked", func() {
+		if id, ok := gui.selectedBookmarkID(); ok {
+			gui.RemoveBookmark(id)
+			gui.fillBookmarksStore()
+		}
+	})
+
+	gui.BookmarksMoveUpButton.Connect("clicked", func() {
+		gui.moveSelectedBookmark(-1)
+	})
+
+	gui.BookmarksMoveDownButton.Connect("clicked", func() {
+		gui.moveSelectedBookmark(1)
+	})
+
+	gui.BookmarksSortComboBoxText.Connect("changed", func() {
+		key := gui.BookmarksSortComboBoxText.GetActive()
+		if key < 0 {
+			return
+		}
+		gui.Bookmarks.Sort(library.SortKey(key))
+		gui.SaveBookmarks()
+		gui.RebuildBookmarksMenu()
+		gui.fillBookmarksStore()
+	})
+}
+
+func (gui *GUI) RunBookmarksDialog() {
+	gui.fillBookmarksStore()
+	gui.BookmarksDialog.Run()
+	gui.BookmarksDialog.Hide()
+	gui.BookmarksSortComboBoxText.SetActive(-1)
+	gui.BookmarksListStore.Clear()
+}
+
+func (gui *GUI) fillBookmarksStore() {
+	store := gui.BookmarksListStore
+	store.Clear()
+
+	for i := range gui.Bookmarks.Bookmarks {
+		b := &gui.Bookmarks.Bookmarks[i]
+		iter := store.Append()
+		store.Set(iter,
+			[]int{bookmarkColumnName, bookmarkColumnArchive, bookmarkColumnPage, bookmarkColumnNote, bookmarkColumnID},
+			[]interface{}{b.Title(), filepath.Base(b.Path), fmt.Sprintf("%d/%d", b.Page, b.TotalPages), b.Note, b.ID})
+
+		if b.Thumbnail == "" {
+			continue
+		}
+		if pixbuf, err := gdk.PixbufNewFromFile(gui.thumbnailPath(b.Thumbnail)); err == nil {
+			store.SetValue(iter, bookmarkColumnThumbnail, pixbuf)
+		}
+	}
+}
+
+func (gui *GUI) bookmarkIDAt(iter *gtk.TreeIter) string {
+	v, err := gui.BookmarksListStore.GetValue(iter, bookmarkColumnID)
+	if err != nil {
+		return ""
+	}
+	id, _ := v.GetString()
+	return id
+}
+
+func (gui *GUI) selectedBookmarkID() (string, bool) {
+	sel, err := gui.BookmarksTreeView.GetSelection()
+	if err != nil {
+		return "", false
+	}
+	_, iter, ok := sel.GetSelected()
+	if !ok {
+		return "", false
+	}
+	return gui.bookmarkIDAt(iter), true
+}
+
+func (gui *GUI) jumpToSelectedBookmark() {
+	id, ok := gui.selectedBookmarkID()
+	if !ok {
+		return
+	}
+	if b := gui.Bookmarks.Find(id); b != nil {
+		gui.BookmarksDialog.Response(gtk.RESPONSE_CLOSE)
+		gui.JumpToBookmark(b)
+	}
+}
+
+func (gui *GUI) moveSelectedBookmark(delta int) {
+	id, ok := gui.selectedBookmarkID()
+	if !ok || !gui.Bookmarks.Move(id, delta) {
+		return
+	}
+	gui.SaveBookmarks()
+	gui.RebuildBookmarksMenu()
+	gui.fillBookmarksStore()
+
+	for i := range gui.Bookmarks.Bookmarks {
+		if gui.Bookmarks.Bookmarks[i].ID != id {
+			continue
+		}
+		path, err := gtk.TreePathNewFromString(fmt.Sprint(i))
+		if err != nil {
+			return
+		}
+		if sel, err := gui.BookmarksTreeView.GetSelection(); err == nil {
+			sel.SelectPath(path)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package budget accounts for the memory held by decoded pages and
+// the images made from them, evicting what was used least recently to
+// stay within a budget.
+//
+// Pixbufs live in C memory, which the Go runtime doesn't know about:
+// a dropped pixbuf is only freed once a collection runs its finalizer.
+// So the manager also counts the bytes dropped since it last forced a
+// collection, and forces one when they add up to a share of the budget.
+package budget
+
+import (
+	"container/list"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Kind is what the memory is held for.
+type Kind int
+
+const (
+	Pages      Kind = iota // decoded pages
+	Scaled                 // pages scaled to be drawn
+	Thumbnails             // thumbnails of pages
+	Hashes                 // page hashes
+	numKinds
+)
+
+var kindNames = [numKinds]string{"pages", "scaled", "thumbnails", "hashes"}
+
+func (k Kind) String() string { return kindNames[k] }
+
+// Dropped memory is collected once it reaches this share of the budget.
+const garbageShare = 4
+
+// Manager keeps track of the memory held, and evicts to stay within
+// its limit. Hold and SetLimit, which call eviction functions, are for
+// the main thread; Discard and Stats may be called from any goroutine.
+type Manager struct {
+	mu          sync.Mutex
+	limit       int64
+	lru         *list.List // of the *Handle that can be evicted, the least recently used last
+	held        [numKinds]int64
+	count       [numKinds]int
+	evicted     [numKinds]int
+	garbage     int64 // dropped since the last collection
+	collections int
+	collect     func()
+}
+
+// Handle is memory held for something.
+type Handle struct {
+	m     *Manager
+	kind  Kind
+	size  int64
+	evict func()
+	elem  *list.Element // nil unless it can be evicted
+	done  bool
+}
+
+func New(limit int64) *Manager {
+	return &Manager{limit: limit, lru: list.New(), collect: runtime.GC}
+}
+
+// SetLimit changes the budget, evicting if it's now over.
+func (m *Manager) SetLimit(limit int64) {
+	m.mu.Lock()
+	m.limit = limit
+	evict := m.evictLocked()
+	m.mu.Unlock()
+	m.finish(evict)
+}
+
+// Hold accounts for size bytes held for kind. If evict isn't nil, the
+// memory may be evicted to make room, in which case evict is called to
+// drop it; otherwise it's held until released.
+func (m *Manager) Hold(kind Kind, size int64, evict func()) *Handle {
+	h := &Handle{m: m, kind: kind, size: size, evict: evict}
+	m.mu.Lock()
+	m.held[kind] += size
+	m.count[kind]++
+	if evict != nil {
+		h.elem = m.lru.PushFront(h)
+	}
+	ev := m.evictLocked()
+	m.mu.Unlock()
+	m.finish(ev)
+	return h
+}
+
+// Discard accounts for size bytes that were allocated and dropped at
+// once, such as a page decoded only to be hashed.
+func (m *Manager) Discard(size int64) {
+	m.mu.Lock()
+	m.garbage += size
+	m.mu.Unlock()
+	m.finish(nil)
+}
+
+// Collect forces a collection, so that the memory dropped is freed.
+func (m *Manager) Collect() {
+	m.mu.Lock()
+	m.garbage = 0
+	m.collections++
+	m.mu.Unlock()
+	m.collect()
+}
+
+// evictLocked drops the least recently used memory that can be
+// evicted until the budget is met, and returns the functions to call.
+func (m *Manager) evictLocked() []func() {
+	var evict []func()
+	for m.total() > m.limit && m.lru.Len() > 0 {
+		h := m.lru.Back().Value.(*Handle)
+		m.releaseLocked(h)
+		m.evicted[h.kind]++
+		evict = append(evict, h.evict)
+	}
+	return evict
+}
+
+// finish calls the eviction functions outside of the lock, as they
+// may release other memory, and collects if enough was dropped.
+func (m *Manager) finish(evict []func()) {
+	for _, f := range evict {
+		f()
+	}
+	m.mu.Lock()
+	collect := m.garbage > 0 && m.garbage >= m.limit/garbageShare
+	m.mu.Unlock()
+	if collect {
+		m.Collect()
+	}
+}
+
+func (m *Manager) total() int64 {
+	var n int64
+	for _, b := range m.held {
+		n += b
+	}
+	return n
+}
+
+func (m *Manager) releaseLocked(h *Handle) {
+	if h.done {
+		return
+	}
+	h.done = true
+	if h.elem != nil {
+		m.lru.Remove(h.elem)
+		h.elem = nil
+	}
+	m.held[h.kind] -= h.size
+	m.count[h.kind]--
+	m.garbage += h.size
+}
+
+// Touch marks the memory as used, so that it's evicted last.
+func (h *Handle) Touch() {
+	if h == nil {
+		return
+	}
+	h.m.mu.Lock()
+	if h.elem != nil {
+		h.m.lru.MoveToFront(h.elem)
+	}
+	h.m.mu.Unlock()
+}
+
+// Resize changes the bytes held, as when something grows.
+func (h *Handle) Resize(size int64) {
+	if h == nil {
+		return
+	}
+	h.m.mu.Lock()
+	h.resizeLocked(size)
+}
+
+// Grow adds n bytes to the memory held.
+func (h *Handle) Grow(n int64) {
+	if h == nil {
+		return
+	}
+	h.m.mu.Lock()
+	h.resizeLocked(h.size + n)
+}
+
+// resizeLocked resizes, and unlocks the manager.
+func (h *Handle) resizeLocked(size int64) {
+	m := h.m
+	if h.done {
+		m.mu.Unlock()
+		return
+	}
+	if size < h.size {
+		m.garbage += h.size - size
+	}
+	m.held[h.kind] += size - h.size
+	h.size = size
+	ev := m.evictLocked()
+	m.mu.Unlock()
+	m.finish(ev)
+}
+
+// Release accounts for the memory as dropped. It's safe to release
+// memory more than once, or after it was evicted.
+func (h *Handle) Release() {
+	if h == nil {
+		return
+	}
+	h.m.mu.Lock()
+	h.m.releaseLocked(h)
+	h.m.mu.Unlock()
+	h.m.finish(nil)
+}
+
+// Stats are the memory held, by kind.
+type Stats struct {
+	Limit       int64
+	Held        [numKinds]int64
+	Count       [numKinds]int
+	Evicted     [numKinds]int
+	Garbage     int64
+	Collections int
+}
+
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Stats{
+		Limit:       m.limit,
+		Held:        m.held,
+		Count:       m.count,
+		Evicted:     m.evicted,
+		Garbage:     m.garbage,
+		Collections: m.collections,
+	}
+}
+
+// Total returns the bytes held.
+func (s Stats) Total() int64 {
+	var n int64
+	for _, b := range s.Held {
+		n += b
+	}
+	return n
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-12s %10s %8s %8s\n", "", "held", "items", "evicted")
+	for k := Kind(0); k < numKinds; k++ {
+		fmt.Fprintf(&b, "%-12s %10s %8d %8d\n", k, Bytes(s.Held[k]), s.Count[k], s.Evicted[k])
+	}
+	fmt.Fprintf(&b, "%-12s %10s of %s\n", "total", Bytes(s.Total()), Bytes(s.Limit))
+	fmt.Fprintf(&b, "%-12s %10s, %d collections", "dropped", Bytes(s.Garbage), s.Collections)
+	return b.String()
+}
+
+// Bytes formats n in KiB, MiB or GiB.
+func Bytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package budget
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTest(limit int64) (*Manager, *int) {
+	m := New(limit)
+	collections := 0
+	m.collect = func() { collections++ }
+	return m, &collections
+}
+
+func TestEvict(t *testing.T) {
+	m, _ := newTest(1000)
+	var evicted []string
+	hold := func(name string, size int64) *Handle {
+		return m.Hold(Scaled, size, func() { evicted = append(evicted, name) })
+	}
+
+	page := m.Hold(Pages, 400, nil)
+	a := hold("a", 200)
+	hold("b", 200)
+	hold("c", 200)
+	a.Touch()
+	if len(evicted) != 0 {
+		t.Fatalf("evicted %v within budget", evicted)
+	}
+
+	// b is the least recently used, and the page can't be evicted.
+	hold("d", 100)
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("evicted %v, want [b]", evicted)
+	}
+
+	s := m.Stats()
+	if s.Held[Pages] != 400 || s.Held[Scaled] != 500 || s.Count[Scaled] != 3 || s.Evicted[Scaled] != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	page.Resize(900)
+	page.Grow(50)
+	if got := strings.Join(evicted, ""); got != "bcad" {
+		t.Errorf("evicted %q after growing the page, want bcad", got)
+	}
+	if s := m.Stats(); s.Total() != 950 || s.Count[Scaled] != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// Pinned memory stays even over budget.
+	m.SetLimit(100)
+	if s := m.Stats(); s.Held[Pages] != 950 {
+		t.Errorf("page evicted: %+v", s)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	m, collections := newTest(1000)
+
+	h := m.Hold(Pages, 200, nil)
+	h.Release()
+	h.Release()
+	if *collections != 0 || m.Stats().Garbage != 200 {
+		t.Fatalf("after releasing 200 bytes: %d collections, %+v", *collections, m.Stats())
+	}
+
+	m.Discard(60)
+	if *collections != 1 || m.Stats().Garbage != 0 {
+		t.Fatalf("after dropping 260 bytes: %d collections, %+v", *collections, m.Stats())
+	}
+
+	// Evicted memory is dropped too.
+	m.Hold(Thumbnails, 800, func() {})
+	m.Hold(Thumbnails, 800, func() {})
+	if *collections != 2 {
+		t.Errorf("after evicting 800 bytes: %d collections", *collections)
+	}
+	if s := m.Stats(); s.Collections != 2 || s.Total() != 800 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		12:            "12 B",
+		1536:          "1.5 KiB",
+		256 << 20:     "256.0 MiB",
+		3<<30 + 1<<29: "3.5 GiB",
+	} {
+		if got := Bytes(n); got != want {
+			t.Errorf("Bytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/opds"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Columns of the catalog's list store.
+const (
+	catalogColumnCover = iota
+	catalogColumnMarkup
+	catalogColumnIndex
+)
+
+const (
+	coverSize = 96
+
+	// How many covers are downloaded at once.
+	coverFetchers = 4
+)
+
+// catalogBrowser holds the state of the catalog dialog. Feeds and covers
+// are fetched in the background; replies that arrive after the user
+// has moved on to another feed are dropped.
+type catalogBrowser struct {
+	client  opds.Client
+	feed    *opds.Feed
+	history []string // URLs of the feeds visited before the current one
+	gen     int
+	stop    chan struct{} // closed when gen changes
+	covers  map[string]*gdk.Pixbuf
+	store   *gtk.ListStore
+}
+
+// next invalidates the requests in flight, and returns the generation
+// of the new ones.
+func (c *catalogBrowser) next() (int, chan struct{}) {
+	if c.stop != nil {
+		close(c.stop)
+	}
+	c.gen++
+	c.stop = make(chan struct{})
+	return c.gen, c.stop
+}
+
+func (gui *GUI) initCatalogDialog() {
+	gui.CatalogDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+	gui.CatalogDialog.AddButton("_Open", gtk.RESPONSE_ACCEPT)
+	gui.CatalogDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	store, err := gtk.ListStoreNew(gdk.PixbufGetType(), glib.TYPE_STRING, glib.TYPE_INT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.Catalog.store = store
+	gui.CatalogTreeView.SetModel(store)
+
+	pixbufRenderer, err := gtk.CellRendererPixbufNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err := gtk.TreeViewColumnNewWithAttribute("", pixbufRenderer, "pixbuf", catalogColumnCover)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.CatalogTreeView.AppendColumn(column)
+
+	textRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err = gtk.TreeViewColumnNewWithAttribute("", textRenderer, "markup", catalogColumnMarkup)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.CatalogTreeView.AppendColumn(column)
+
+	gui.CatalogTreeView.Connect("row-activated", func() {
+		e := gui.selectedCatalogEntry()
+		if e == nil {
+			return
+		}
+		if nav := e.Navigation(); nav != nil {
+			gui.fetchCatalog(nav.Href, true)
+			return
+		}
+		gui.CatalogDialog.Response(gtk.RESPONSE_ACCEPT)
+	})
+
+	gui.CatalogURLEntry.Connect("activate", func() {
+		uri, err := gui.CatalogURLEntry.GetText()
+		if err != nil || strings.TrimSpace(uri) == "" {
+			return
+		}
+		gui.Config.CatalogURL = strings.TrimSpace(uri)
+		gui.Catalog.history = nil
+		gui.fetchCatalog(gui.Config.CatalogURL, false)
+	})
+
+	gui.CatalogSearchEntry.Connect("activate", func() {
+		terms, err := gui.CatalogSearchEntry.GetText()
+		if err != nil || strings.TrimSpace(terms) == "" || gui.Catalog.feed == nil {
+			return
+		}
+		feed := gui.Catalog.feed
+		gui.loadCatalog(func() (*opds.Feed, error) {
+			return gui.Catalog.client.Search(feed, terms)
+		}, true)
+	})
+
+	gui.CatalogBackButton.Connect("clicked", func() {
+		h := gui.Catalog.history
+		if len(h) == 0 {
+			return
+		}
+		gui.Catalog.history = h[:len(h)-1]
+		gui.fetchCatalog(h[len(h)-1], false)
+	})
+
+	gui.CatalogPreviousButton.Connect("clicked", func() {
+		if l := gui.Catalog.feed.Link(opds.RelPrevious); l != nil {
+			gui.fetchCatalog(l.Href, true)
+		}
+	})
+
+	gui.CatalogNextButton.Connect("clicked", func() {
+		if l := gui.Catalog.feed.Link(opds.RelNext); l != nil {
+			gui.fetchCatalog(l.Href, true)
+		}
+	})
+}
+
+func (gui *GUI) RunCatalogDialog() {
+	gui.Catalog.covers = make(map[string]*gdk.Pixbuf)
+	gui.CatalogURLEntry.SetText(gui.Config.CatalogURL)
+	if gui.Catalog.feed != nil {
+		gui.showCatalogFeed(gui.Catalog.feed)
+	} else if gui.Config.CatalogURL != "" {
+		gui.fetchCatalog(gui.Config.CatalogURL, false)
+	}
+	gui.updateCatalogButtons()
+
+	var open *opds.Entry
+	for open == nil {
+		if gtk.ResponseType(gui.CatalogDialog.Run()) != gtk.RESPONSE_ACCEPT {
+			break
+		}
+		e := gui.selectedCatalogEntry()
+		if e == nil {
+			continue
+		}
+		if nav := e.Navigation(); nav != nil {
+			gui.fetchCatalog(nav.Href, true)
+			continue
+		}
+		open = e
+	}
+	gui.CatalogDialog.Hide()
+
+	// The feed and history are kept, so that the user can carry on
+	// where they left off.
+	gui.Catalog.next()
+	gui.Catalog.covers = nil
+	gui.Catalog.store.Clear()
+
+	if open != nil {
+		gui.openCatalogEntry(open)
+	}
+}
+
+// openCatalogEntry opens a publication, streaming its pages if the
+// server supports it, or reading the downloadable archive otherwise.
+func (gui *GUI) openCatalogEntry(e *opds.Entry) {
+	if s := e.Stream(); s != nil {
+		gui.LoadArchive(archive.PSEURI(s, e.Title))
+		return
+	}
+	if a := e.Acquisition(); a != nil {
+		gui.LoadArchive(archive.RemoteURI(a.Href, e.Title))
+		return
+	}
+	gui.ShowError(e.Title + " can't be downloaded")
+}
+
+func (gui *GUI) fetchCatalog(uri string, push bool) {
+	gui.loadCatalog(func() (*opds.Feed, error) {
+		return gui.Catalog.client.Fetch(uri)
+	}, push)
+}
+
+// loadCatalog runs fetch in the background and shows the feed it
+// returns. If push is set, the current feed is added to the history.
+func (gui *GUI) loadCatalog(fetch func() (*opds.Feed, error), push bool) {
+	gen, _ := gui.Catalog.next()
+	gui.CatalogStatusLabel.SetText("Loading...")
+
+	go func() {
+		feed, err := fetch()
+		glib.IdleAdd(func() {
+			if gen != gui.Catalog.gen {
+				return
+			}
+			if err != nil {
+				gui.CatalogStatusLabel.SetText(err.Error())
+				return
+			}
+			if push && gui.Catalog.feed != nil {
+				gui.Catalog.history = append(gui.Catalog.history, gui.Catalog.feed.URL)
+			}
+			gui.showCatalogFeed(feed)
+		})
+	}()
+}
+
+func (gui *GUI) showCatalogFeed(feed *opds.Feed) {
+	gui.Catalog.feed = feed
+	store := gui.Catalog.store
+	store.Clear()
+
+	covers := make([]string, len(feed.Entries))
+	for i := range feed.Entries {
+		e := &feed.Entries[i]
+		iter := store.Append()
+		store.Set(iter,
+			[]int{catalogColumnMarkup, catalogColumnIndex},
+			[]interface{}{catalogMarkup(e), i})
+
+		th := e.Thumbnail()
+		if th == nil {
+			continue
+		}
+		if pixbuf, ok := gui.Catalog.covers[th.Href]; ok {
+			store.SetValue(iter, catalogColumnCover, pixbuf)
+		} else {
+			covers[i] = th.Href
+		}
+	}
+
+	gui.CatalogStatusLabel.SetText(fmt.Sprintf("%s (%d entries)", feed.Title, len(feed.Entries)))
+	gui.updateCatalogButtons()
+	gui.fetchCovers(covers)
+}
+
+// catalogMarkup returns the text shown for an entry: the title, and the
+// authors and summary of publications.
+func catalogMarkup(e *opds.Entry) string {
+	markup := "<b>" + html.EscapeString(e.Title) + "</b>"
+	if e.Navigation() != nil {
+		return markup
+	}
+	if len(e.Authors) > 0 {
+		markup += "\n" + html.EscapeString(strings.Join(e.Authors, ", "))
+	}
+	if summary := e.Summary; summary != "" {
+		if r := []rune(summary); len(r) > 200 {
+			summary = string(r[:200]) + "..."
+		}
+		markup += "\n<small>" + html.EscapeString(summary) + "</small>"
+	}
+	return markup
+}
+
+// fetchCovers downloads the cover of each row; rows with an empty URL
+// are skipped.
+func (gui *GUI) fetchCovers(urls []string) {
+	gen, stop := gui.Catalog.next()
+	sem := make(chan bool, coverFetchers)
+	for i, u := range urls {
+		if u == "" {
+			continue
+		}
+		i, u := i, u
+		go func() {
+			select {
+			case sem <- true:
+			case <-stop:
+				return
+			}
+			data, err := gui.Catalog.client.Get(u)
+			<-sem
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			glib.IdleAdd(func() {
+				if gen == gui.Catalog.gen {
+					gui.setCatalogCover(i, u, data)
+				}
+			})
+		}()
+	}
+}
+
+func (gui *GUI) setCatalogCover(row int, uri string, data []byte) {
+	pixbuf, err := archive.LoadPixbuf(bytes.NewReader(data), false)
+	if err != nil {
+		log.Println(uri+":", err)
+		return
+	}
+	w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), coverSize, coverSize)
+	if pixbuf, err = pixbuf.ScaleSimple(w, h, interpolations[gui.Config.Interpolation]); err != nil {
+		log.Println(err)
+		return
+	}
+	gui.Catalog.covers[uri] = pixbuf
+
+	iter, err := gui.Catalog.store.GetIterFromString(strconv.Itoa(row))
+	if err != nil {
+		return
+	}
+	gui.Catalog.store.SetValue(iter, catalogColumnCover, pixbuf)
+}
+
+func (gui *GUI) selectedCatalogEntry() *opds.Entry {
+	sel, err := gui.CatalogTreeView.GetSelection()
+	if err != nil {
+		return nil
+	}
+	_, iter, ok := sel.GetSelected()
+	if !ok {
+		return nil
+	}
+	v, err := gui.Catalog.store.GetValue(iter, catalogColumnIndex)
+	if err != nil {
+		return nil
+	}
+	i, err := v.GoValue()
+	if err != nil || gui.Catalog.feed == nil || i.(int) >= len(gui.Catalog.feed.Entries) {
+		return nil
+	}
+	return &gui.Catalog.feed.Entries[i.(int)]
+}
+
+func (gui *GUI) updateCatalogButtons() {
+	feed := gui.Catalog.feed
+	gui.CatalogBackButton.SetSensitive(len(gui.Catalog.history) > 0)
+	gui.CatalogSearchEntry.SetSensitive(feed != nil && feed.Link(opds.RelSearch) != nil)
+	gui.CatalogPreviousButton.SetSensitive(feed != nil && feed.Link(opds.RelPrevious) != nil)
+	gui.CatalogNextButton.SetSensitive(feed != nil && feed.Link(opds.RelNext) != nil)
+}
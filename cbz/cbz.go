@@ -0,0 +1,127 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package cbz writes comic book archives: zip files holding the pages
+// in reading order under zero-padded names, and optionally the
+// ComicInfo.xml metadata. Pages can be recompressed or scaled down on
+// the way.
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ComicInfoName is the name of the metadata file.
+const ComicInfoName = "ComicInfo.xml"
+
+// Pages is a source of pages, in reading order. archive.Archive
+// satisfies it.
+type Pages interface {
+	Len() int
+	Name(i int) (string, error)
+	Open(i int) (io.ReadCloser, error)
+}
+
+// Formats that gain nothing from being deflated.
+var compressed = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".avif": true, ".jxl": true,
+	".jp2": true, ".j2k": true, ".jpf": true, ".jpx": true, ".jpm": true,
+}
+
+// PageName returns the name of page i of n, numbered from 1 and padded
+// so that names sort in order, such as 007.jpg.
+func PageName(i, n int, ext string) string {
+	digits := len(fmt.Sprint(n))
+	if digits < 3 {
+		digits = 3
+	}
+	return fmt.Sprintf("%0*d%s", digits, i+1, strings.ToLower(ext))
+}
+
+// Write writes pages to w as a zip archive, recoding them according to
+// opt. comicInfo, if not nil, is stored as ComicInfo.xml, and extras,
+// such as the files of an archive that aren't pages, are copied as
+// they are after it. progress, if not nil, is called with the number
+// of pages written after each one.
+func Write(w io.Writer, pages Pages, comicInfo []byte, extras []*zip.File, opt Options, progress func(done int)) error {
+	zw := zip.NewWriter(w)
+	n := pages.Len()
+	now := time.Now()
+
+	for i := 0; i < n; i++ {
+		name, err := pages.Name(i)
+		if err != nil {
+			return err
+		}
+		data, err := readPage(pages, i)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		data, ext, err := Recode(data, filepath.Ext(name), opt)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err := writeFile(zw, PageName(i, n, ext), data, now); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+
+	if comicInfo != nil {
+		if err := writeFile(zw, ComicInfoName, comicInfo, now); err != nil {
+			return err
+		}
+	}
+	for _, f := range extras {
+		if err := zw.Copy(f); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func readPage(pages Pages, i int) ([]byte, error) {
+	r, err := pages.Open(i)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, r)
+	return buf.Bytes(), err
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte, modified time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified}
+	if compressed[strings.ToLower(filepath.Ext(name))] {
+		h.Method = zip.Store
+	}
+	f, err := zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type memPages struct {
+	names []string
+	files [][]byte
+}
+
+func (p *memPages) Len() int                   { return len(p.names) }
+func (p *memPages) Name(i int) (string, error) { return p.names[i], nil }
+func (p *memPages) Open(i int) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(p.files[i])), nil
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func noise(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	x := uint32(1)
+	for i := range img.Pix {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		img.Pix[i] = uint8(x)
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+func TestPageName(t *testing.T) {
+	for _, c := range []struct {
+		i, n int
+		ext  string
+		want string
+	}{
+		{0, 5, ".jpg", "001.jpg"},
+		{41, 120, ".PNG", "042.png"},
+		{6, 1200, ".webp", "0007.webp"},
+	} {
+		if got := PageName(c.i, c.n, c.ext); got != c.want {
+			t.Errorf("PageName(%d, %d, %q) = %q, want %q", c.i, c.n, c.ext, got, c.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	pages := &memPages{
+		names: []string{"ch1/cover.JPG", "ch1/p2.webp", "ch1/p10.bmp"},
+		files: [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+	}
+	info := []byte("<ComicInfo/>")
+
+	var buf bytes.Buffer
+	done := 0
+	if err := Write(&buf, pages, info, nil, Options{}, func(n int) { done = n }); err != nil {
+		t.Fatal(err)
+	}
+	if done != 3 {
+		t.Errorf("progress ended at %d, want 3", done)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, data string
+		method     uint16
+	}{
+		{"001.jpg", "a", zip.Store},
+		{"002.webp", "b", zip.Store},
+		{"003.bmp", "c", zip.Deflate},
+		{ComicInfoName, string(info), zip.Deflate},
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("got %d files, want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if f.Name != want[i].name || string(data) != want[i].data || f.Method != want[i].method {
+			t.Errorf("file %d = %s %q (method %d), want %s %q (method %d)",
+				i, f.Name, data, f.Method, want[i].name, want[i].data, want[i].method)
+		}
+	}
+}
+
+func TestWriteExtras(t *testing.T) {
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	for _, name := range []string{"credits.txt", "ch1/notes.nfo"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(src.Bytes()), int64(src.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages := &memPages{names: []string{"a.jpg"}, files: [][]byte{[]byte("a")}}
+	var buf bytes.Buffer
+	if err := Write(&buf, pages, nil, zr.File, Options{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"001.jpg a", "credits.txt credits.txt", "ch1/notes.nfo ch1/notes.nfo"}
+	if len(zr.File) != len(want) {
+		t.Fatalf("got %d files, want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if got := f.Name + " " + string(data); got != want[i] {
+			t.Errorf("file %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestPageList(t *testing.T) {
+	ar := &memPages{
+		names: []string{"a.jpg", "b.jpg", "c.jpg"},
+		files: [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+	}
+	path := filepath.Join(t.TempDir(), "new.png")
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// c and a swapped, b deleted, and a file inserted.
+	l := PageList{{Archive: ar, Index: 2}, {Path: path}, {Archive: ar, Index: 0}}
+	var buf bytes.Buffer
+	if err := Write(&buf, l, nil, nil, Options{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"001.jpg c", "002.png new", "003.jpg a"}
+	for i, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if got := f.Name + " " + string(data); i >= len(want) || got != want[i] {
+			t.Errorf("file %d = %q", i, got)
+		}
+	}
+	if len(zr.File) != len(want) {
+		t.Errorf("got %d files, want %d", len(zr.File), len(want))
+	}
+}
+
+func TestRecode(t *testing.T) {
+	wide := encodePNG(t, gradient(400, 300))
+
+	// Copied as they are.
+	for _, opt := range []Options{{}, {MaxWidth: 400}} {
+		data, ext, err := Recode(wide, ".png", opt)
+		if err != nil || ext != ".png" || !bytes.Equal(data, wide) {
+			t.Errorf("Recode with %+v changed the page", opt)
+		}
+	}
+	if data, ext, err := Recode([]byte("RIFF....WEBP"), ".webp", Options{Quality: 80}); err != nil || ext != ".webp" || string(data) != "RIFF....WEBP" {
+		t.Errorf("Recode changed an undecodable page")
+	}
+
+	// Scaled down, keeping the format.
+	data, ext, err := Recode(wide, ".png", Options{MaxWidth: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || ext != ".png" || format != "png" || cfg.Width != 100 || cfg.Height != 75 {
+		t.Errorf("scaled to %s %dx%d (%s), want png 100x75", format, cfg.Width, cfg.Height, ext)
+	}
+
+	// Recompressed, unless it would only get larger.
+	noisy := encodePNG(t, noise(400, 300))
+	data, ext, err = Recode(noisy, ".png", Options{Quality: 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, format, _ := image.DecodeConfig(bytes.NewReader(data)); ext != ".jpg" || format != "jpeg" {
+		t.Errorf("recompressed to %s (%s), want jpeg", format, ext)
+	}
+	if data, ext, err := Recode(wide, ".png", Options{Quality: 70}); err != nil || ext != ".png" || !bytes.Equal(data, wide) {
+		t.Errorf("Recode made a page larger")
+	}
+}
+
+// exifJPEG returns a JPEG file of img with the given Exif orientation.
+func exifJPEG(t *testing.T, img image.Image, o uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, o)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	img := gradient(64, 32)
+	for o := 1; o <= 8; o++ {
+		data := exifJPEG(t, img, uint16(o))
+		if got := orientation(data); got != o {
+			t.Errorf("orientation = %d, want %d", got, o)
+		}
+
+		// Turned pages are measured as they're shown.
+		out, _, err := Recode(data, ".jpg", Options{MaxWidth: 16})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := image.Pt(16, 8)
+		if o >= 5 {
+			want = image.Pt(16, 32)
+		}
+		if got := image.Pt(cfg.Width, cfg.Height); got != want {
+			t.Errorf("orientation %d: scaled to %v, want %v", o, got, want)
+		}
+	}
+	if got := orientation(encodePNG(t, img)); got != 1 {
+		t.Errorf("orientation of a PNG = %d, want 1", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 2x1: red, green.
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}
+	img.Set(0, 0, red)
+	img.Set(1, 0, green)
+
+	for _, c := range []struct {
+		o           int
+		size        image.Point
+		first, last color.RGBA // top left, bottom right
+	}{
+		{1, image.Pt(2, 1), red, green},
+		{2, image.Pt(2, 1), green, red},
+		{6, image.Pt(1, 2), red, green},
+		{8, image.Pt(1, 2), green, red},
+	} {
+		out := orient(img, c.o)
+		b := out.Bounds()
+		if b.Size() != c.size || out.RGBAAt(0, 0) != c.first || out.RGBAAt(b.Dx()-1, b.Dy()-1) != c.last {
+			t.Errorf("orient %d: %v %v..%v, want %v %v..%v", c.o,
+				b.Size(), out.RGBAAt(0, 0), out.RGBAAt(b.Dx()-1, b.Dy()-1), c.size, c.first, c.last)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.Set(0, 0, color.RGBA{0, 0, 0, 255})
+
+	out := Scale(img, 1, 1)
+	// One black pixel out of six.
+	if got, want := out.RGBAAt(0, 0), (color.RGBA{167, 167, 167, 209}); got != want {
+		t.Errorf("Scale to 1x1 = %v, want %v", got, want)
+	}
+
+	out = Scale(img, 2, 2)
+	// The left pixel covers the black one and half of the next.
+	if got := out.RGBAAt(0, 0); got.R != 67 || got.G != 67 {
+		t.Errorf("Scale to 2x2 = %v at 0,0, want 67", got)
+	}
+	if got := out.RGBAAt(1, 1); got.R != 200 {
+		t.Errorf("Scale to 2x2 = %v at 1,1, want 200", got)
+	}
+}
+
+func BenchmarkScale(b *testing.B) {
+	img := gradient(1800, 2600)
+	for i := 0; i < b.N; i++ {
+		Scale(img, 1000, 1444)
+	}
+}
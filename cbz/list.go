@@ -0,0 +1,52 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cbz
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Page is a page of an archive being put together: page Index of
+// Archive, or the image file at Path if Archive is nil.
+type Page struct {
+	Archive Pages
+	Index   int
+	Path    string
+}
+
+// PageList is a list of pages taken from archives and files, in
+// reading order. It can be written with Write.
+type PageList []Page
+
+func (l PageList) Len() int {
+	return len(l)
+}
+
+func (l PageList) Name(i int) (string, error) {
+	if p := l[i]; p.Archive != nil {
+		return p.Archive.Name(p.Index)
+	}
+	return filepath.Base(l[i].Path), nil
+}
+
+func (l PageList) Open(i int) (io.ReadCloser, error) {
+	if p := l[i]; p.Archive != nil {
+		return p.Archive.Open(p.Index)
+	}
+	return os.Open(l[i].Path)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cbz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// DefaultQuality is the JPEG quality of pages that are scaled down
+// without asking for a quality.
+const DefaultQuality = 90
+
+// Options tell how pages are recoded. The zero value copies them as
+// they are.
+type Options struct {
+	// MaxWidth scales down pages wider than this. 0 leaves them be.
+	MaxWidth int
+	// Quality recompresses every page as a JPEG of this quality, from
+	// 1 to 100. 0 keeps the format of each page.
+	Quality int
+}
+
+func (opt Options) recodes() bool {
+	return opt.MaxWidth > 0 || opt.Quality > 0
+}
+
+// Recode applies opt to a page, given its file and extension, and
+// returns the new file and extension. Pages in formats that can't be
+// decoded here, such as WebP, are returned as they are, and so are
+// pages that recompressing would only make larger.
+func Recode(data []byte, ext string, opt Options) ([]byte, string, error) {
+	if !opt.recodes() {
+		return data, ext, nil
+	}
+	orig := ext
+	if opt.Quality == 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || !wider(cfg, orientation(data), opt.MaxWidth) {
+			return data, ext, nil
+		}
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, ext, nil
+	}
+	img := orient(toRGBA(src), orientation(data))
+
+	scaled := false
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); opt.MaxWidth > 0 && w > opt.MaxWidth {
+		img = Scale(img, opt.MaxWidth, max(1, (h*opt.MaxWidth+w/2)/w))
+		scaled = true
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case opt.Quality > 0:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opt.Quality})
+		ext = ".jpg"
+	case format == "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: DefaultQuality})
+		ext = ".jpg"
+	default:
+		err = png.Encode(&buf, img)
+		ext = ".png"
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !scaled && buf.Len() >= len(data) {
+		return data, orig, nil
+	}
+	return buf.Bytes(), ext, nil
+}
+
+func wider(cfg image.Config, o int, width int) bool {
+	if o >= 5 {
+		return cfg.Height > width
+	}
+	return cfg.Width > width
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if img, ok := src.(*image.RGBA); ok {
+		return img
+	}
+	b := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	return img
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// orientation returns the Exif orientation of a JPEG file, from 1 to
+// 8, or 1 if it has none.
+func orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for p := 2; p+4 <= len(data) && data[p] == 0xff; {
+		marker := data[p+1]
+		size := int(binary.BigEndian.Uint16(data[p+2:]))
+		if marker == 0xda || p+2+size > len(data) {
+			break // image data
+		}
+		seg := data[p+4 : p+2+size]
+		if marker == 0xe1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		p += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient turns an image the way its Exif orientation o says, as the
+// viewer does when loading it. The Exif data is lost when recoding.
+func orient(img *image.RGBA, o int) *image.RGBA {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cbz
+
+import "image"
+
+// span is the part of a source row or column that makes up one pixel
+// of the scaled image.
+type span struct {
+	first   int
+	weights []float32 // of first and the pixels after it, adding up to 1
+}
+
+func spans(src, dst int) []span {
+	ratio := float64(src) / float64(dst)
+	s := make([]span, dst)
+	for i := range s {
+		a, b := float64(i)*ratio, float64(i+1)*ratio
+		first := int(a)
+		for j := first; float64(j) < b && j < src; j++ {
+			w := minf(b, float64(j+1)) - maxf(a, float64(j))
+			s[i].weights = append(s[i].weights, float32(w/ratio))
+		}
+		s[i].first = first
+	}
+	return s
+}
+
+func minf(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Scale shrinks img to w by h by averaging the pixels that each pixel
+// covers. It isn't meant for enlarging.
+func Scale(img *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	xs, ys := spans(sw, w), spans(sh, h)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	// Rows are scaled horizontally as they're needed. A source row
+	// is shared by two rows of dst at most.
+	row := make([]float32, 4*w)
+	acc := make([]float32, 4*w)
+	for y, sy := range ys {
+		for i := range acc {
+			acc[i] = 0
+		}
+		for k, wy := range sy.weights {
+			src := img.Pix[img.PixOffset(0, sy.first+k):]
+			for x, sx := range xs {
+				var r, g, b, a float32
+				for l, wx := range sx.weights {
+					p := src[4*(sx.first+l):]
+					r += wx * float32(p[0])
+					g += wx * float32(p[1])
+					b += wx * float32(p[2])
+					a += wx * float32(p[3])
+				}
+				row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = r, g, b, a
+			}
+			for i, v := range row {
+				acc[i] += wy * v
+			}
+		}
+		out := dst.Pix[dst.PixOffset(0, y):]
+		for i, v := range acc {
+			if v > 255 {
+				v = 255
+			}
+			out[i] = uint8(v + 0.5)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/salviati/gomics/library"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A command is a gomics subcommand that runs without the GUI.
+type command struct {
+	usage string // arguments, shown in the help
+	help  string
+	run   func(fs *flag.FlagSet, args []string) error
+	flags func(fs *flag.FlagSet) // optional
+}
+
+var commands = map[string]*command{
+	"bookmarks": {
+		usage: "export|import [flags] <file>",
+		help:  "Export or import bookmarks and reading progress as JSON or CSV.",
+		run:   runBookmarks,
+		flags: bookmarksFlags,
+	},
+	"convert": {
+		usage: "[flags] <archive|dir>...",
+		help:  "Convert CBR, CB7 and zip archives and directories of images to CBZ, with the pages in reading order.",
+		run:   runConvert,
+		flags: convertFlags,
+	},
+	"dupes": {
+		usage: "[flags] <dir>... | -pages [flags] <archive>...",
+		help:  "Find archives that look like copies of each other, or with -pages, pages repeated within archives.",
+		run:   runDupes,
+		flags: dupesFlags,
+	},
+	"extract": {
+		usage: "[flags] <archive> <page|first-last> <dir>",
+		help:  "Extract pages of an archive, numbered from 1, to a directory.",
+		run:   runExtract,
+		flags: extractFlags,
+	},
+	"info": {
+		usage: "[flags] <archive>",
+		help:  "Show the pages of an archive with their dimensions, and its metadata.",
+		run:   runInfo,
+		flags: infoFlags,
+	},
+	"ls": {
+		usage: "[flags] <archive>",
+		help:  "List the pages of an archive in reading order.",
+		run:   runLs,
+		flags: lsFlags,
+	},
+	"remote": {
+		usage: "<command> [arguments]",
+		help:  "Control the running viewer. Commands: " + remoteCommands + ".",
+		run:   runRemote,
+	},
+	"serve": {
+		usage: "[flags]",
+		help:  "Serve the library over HTTP, with a web reader.",
+		run:   runServe,
+		flags: serveFlags,
+	},
+	"verify": {
+		usage: "[flags] <archive>...",
+		help:  "Check that every page of the archives can be read and decoded.",
+		run:   runVerify,
+		flags: verifyFlags,
+	},
+}
+
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs the named subcommand, and reports whether name was one.
+func runCommand(name string, args []string) bool {
+	cmd, ok := commands[name]
+	if !ok {
+		return false
+	}
+
+	fs := flag.NewFlagSet("gomics "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gomics %s %s\n%s\n", name, cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Parse(args)
+
+	if err := cmd.run(fs, fs.Args()); err != nil {
+		if err == errUsage {
+			fs.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "gomics "+name+":", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+func commandsUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: gomics [flags] [archive]\n       gomics <command> [arguments]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// remapFlags collects repeated -remap from=to flags.
+type remapFlags []library.Remap
+
+func (r *remapFlags) String() string {
+	s := make([]string, len(*r))
+	for i, rule := range *r {
+		s[i] = rule.From + "=" + rule.To
+	}
+	return strings.Join(s, ",")
+}
+
+func (r *remapFlags) Set(s string) error {
+	rule, err := library.ParseRemap(s)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
+
+var (
+	bookmarksFormat   string
+	bookmarksConflict string
+	bookmarksRemaps   remapFlags
+)
+
+func bookmarksFlags(fs *flag.FlagSet) {
+	fs.StringVar(&bookmarksFormat, "format", "", "`json` or csv (default: guessed from the file name)")
+	fs.StringVar(&bookmarksConflict, "conflict", "latest", "on import, keep the `latest` entry or keep both")
+	fs.Var(&bookmarksRemaps, "remap", "translate path prefix `from=to` (repeatable)")
+}
+
+func runBookmarks(fs *flag.FlagSet, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	configPath, err := userConfigPath()
+	if err != nil {
+		return err
+	}
+
+	var bs library.Bookmarks
+	var p library.Progress
+	bookmarksPath := filepath.Join(configPath, BookmarksFile)
+	progressPath := filepath.Join(configPath, ProgressFile)
+	if err := bs.Load(bookmarksPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := p.Load(progressPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	format := bookmarksFormat
+	if format == "" {
+		format = "json"
+		if strings.ToLower(filepath.Ext(args[1])) == ".csv" {
+			format = "csv"
+		}
+	}
+
+	switch args[0] {
+	case "export":
+		e := library.NewExport(&bs, &p)
+		e.Remap(bookmarksRemaps)
+		return writeExport(args[1], format, e)
+	case "import":
+		var conflict library.Conflict
+		switch bookmarksConflict {
+		case "latest":
+			conflict = library.LatestWins
+		case "both":
+			conflict = library.KeepBoth
+		default:
+			return errUsage
+		}
+
+		e, err := readExport(args[1], format)
+		if err != nil {
+			return err
+		}
+		e.Remap(bookmarksRemaps)
+		n := e.Import(&bs, &p, conflict)
+
+		if err := bs.Save(bookmarksPath); err != nil {
+			return err
+		}
+		if err := p.Save(progressPath); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d entries\n", n)
+		return nil
+	}
+	return errUsage
+}
+
+func writeExport(path, format string, e *library.Export) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if format == "csv" {
+		err = e.WriteCSV(f)
+	} else {
+		err = e.WriteJSON(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readExport(path, format string) (*library.Export, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "csv" {
+		return library.ReadCSV(f)
+	}
+	return library.ReadJSON(f)
+}
@@ -17,13 +17,22 @@ package main
 
 import (
 	"encoding/json"
+	"github.com/salviati/gomics/imgdiff"
+	"github.com/salviati/gomics/library"
 	"os"
+	"os/user"
+	"path/filepath"
 )
 
 const (
 	ConfigDir  = ".config/gomics" // relative to user's home
 	ConfigFile = "config"         // relative to config dir
 	ImageDir   = "images"         // relative to config dir
+
+	BookmarksFile = "bookmarks"  // relative to config dir
+	ProgressFile  = "progress"   // relative to config dir
+	ThumbnailDir  = "thumbnails" // relative to config dir
+	SceneDir      = "scenes"     // relative to config dir
 )
 
 type Config struct {
@@ -36,6 +45,7 @@ type Config struct {
 	WindowHeight        int
 	NSkip               int
 	Random              bool
+	ShuffleSeed         int64 // page order in random mode
 	Seamless            bool
 	HFlip               bool
 	VFlip               bool
@@ -46,8 +56,41 @@ type Config struct {
 	Interpolation       int
 	ImageDiffThres      float32
 	SceneScanSkip       int
+	SceneHash           string // imgdiff hasher used to find scenes
 	SmartScroll         bool
-	Bookmarks           []Bookmark
+	RememberPosition    bool
+	LibraryRoots        []string
+	PathRemaps          []string // from=to rules applied to imported bookmarks, and to=from to exported ones
+	CatalogURL          string   // OPDS catalog last browsed
+	SingleInstance      bool
+	SlideshowDelay      float64 // seconds
+	SlideshowLoop       bool
+	SlideshowScaleTall  bool // show tall pages for longer
+	SkipDuplicatePages  bool // once the archive is indexed
+	ConvertMaxWidth     int  // last used in the Convert to CBZ dialog
+	ConvertQuality      int
+	ConvertReplace      bool
+	ExportWhat          string // page, spread or range
+	ExportFormat        string // png, jpeg or webp
+	ExportQuality       int    // of JPEG and WebP
+	ExportCompression   int    // of PNG
+	ExportDir           string // the images directory if empty
+	ExportTemplate      string // see package filename
+	MemoryBudget        int    // MiB for decoded and scaled pages, thumbnails and hashes
+
+	// Bookmarks used to be stored here. They're only read to move
+	// them over to BookmarksFile.
+	Bookmarks []library.Bookmark `json:",omitempty"`
+}
+
+// userConfigPath returns the directory holding the configuration,
+// bookmarks and other state of the current user.
+func userConfigPath() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(u.HomeDir, ConfigDir), nil
 }
 
 func (c *Config) Load(path string) error {
@@ -92,5 +135,14 @@ func (c *Config) Defaults() {
 	c.EmbeddedOrientation = true
 	c.ImageDiffThres = 0.4
 	c.SceneScanSkip = 5
+	c.SceneHash = imgdiff.Difference.Name()
 	c.SmartScroll = true
+	c.SlideshowDelay = 5
+	c.SlideshowScaleTall = true
+	c.ExportWhat = "page"
+	c.ExportFormat = "png"
+	c.ExportQuality = 90
+	c.ExportCompression = 6
+	c.ExportTemplate = "{archive}-{page}"
+	c.MemoryBudget = defaultMemoryBudget
 }
@@ -0,0 +1,327 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/cbz"
+	"github.com/salviati/gomics/library"
+	"github.com/salviati/gomics/trash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	convertOutput  string
+	convertWidth   int
+	convertQuality int
+	convertReplace bool
+)
+
+func convertFlags(fs *flag.FlagSet) {
+	fs.StringVar(&convertOutput, "o", "", "output `file`, when converting a single archive")
+	fs.IntVar(&convertWidth, "width", 0, "scale down pages wider than this many `pixels`")
+	fs.IntVar(&convertQuality, "quality", 0, "recompress pages as JPEGs of this `quality`, from 1 to 100")
+	fs.BoolVar(&convertReplace, "replace", false, "move the originals to the trash")
+}
+
+// runConvert converts archives and directories of images to CBZ.
+func runConvert(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 || (convertOutput != "" && len(args) > 1) {
+		return errUsage
+	}
+	if convertQuality < 0 || convertQuality > 100 || convertWidth < 0 {
+		return errUsage
+	}
+	opt := cbz.Options{MaxWidth: convertWidth, Quality: convertQuality}
+
+	failed := 0
+	for _, src := range args {
+		dst := convertOutput
+		if dst == "" {
+			dst = cbzPath(src)
+		}
+		var fp string
+		if convertReplace {
+			fp, _ = library.Fingerprint(src)
+		}
+		if err := convertArchive(src, dst, opt, convertReplace, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			failed++
+			continue
+		}
+		if fp != "" {
+			if err := rekeyLibrary(src, fp, dst); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			}
+		}
+		fmt.Println(dst)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed", failed, len(args))
+	}
+	return nil
+}
+
+// rekeyLibrary moves the bookmarks and reading progress of src, with
+// fingerprint fp, over to dst once it has taken src's place.
+func rekeyLibrary(src, fp, dst string) error {
+	newFP, err := library.Fingerprint(dst)
+	if err != nil {
+		return err
+	}
+	configPath, err := userConfigPath()
+	if err != nil {
+		return err
+	}
+
+	var bs library.Bookmarks
+	var p library.Progress
+	bookmarksPath := filepath.Join(configPath, BookmarksFile)
+	progressPath := filepath.Join(configPath, ProgressFile)
+	if err := bs.Load(bookmarksPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := p.Load(progressPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Only files with something to change are written, so that a
+	// missing bookmarks file still gets the ones in the config.
+	if bs.Rekey(fp, src, newFP)+bs.Relink(newFP, dst) > 0 {
+		if err := bs.Save(bookmarksPath); err != nil {
+			return err
+		}
+	}
+	if _, ok := p.Get(fp); !ok {
+		return nil
+	}
+	p.Rekey(fp, src, newFP)
+	p.Relink(newFP, dst)
+	return p.Save(progressPath)
+}
+
+// cbzPath returns where an archive is converted to by default: next
+// to it, with the .cbz extension.
+func cbzPath(src string) string {
+	src = filepath.Clean(src)
+	if !archive.IsDir(src) {
+		src = strings.TrimSuffix(src, filepath.Ext(src))
+	}
+	return src + ".cbz"
+}
+
+// convertArchive writes the pages of src to a new CBZ at dst, in the
+// order the viewer shows them, along with its ComicInfo.xml. The result
+// is checked to open before it takes the place of dst, and before src
+// goes to the trash if replace is set. dst may be src itself when
+// replacing it.
+func convertArchive(src, dst string, opt cbz.Options, replace bool, progress func(done, total int)) (err error) {
+	if archive.IsRemote(src) {
+		return errors.New("remote archives can't be converted")
+	}
+	same := filepath.Clean(src) == filepath.Clean(dst)
+	if same && !replace {
+		return errors.New("the archive would be written over itself")
+	}
+	if _, err := os.Lstat(dst); err == nil && !same {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	ar, err := archive.NewArchive(src)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+	info, err := archive.ComicInfoXML(src)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := writeCBZ(dst, ar, info, nil, opt, func(done int) {
+		if progress != nil {
+			progress(done, ar.Len())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if replace && same {
+		if err = trash.Move(src); err != nil {
+			return err
+		}
+		// The original is in the trash by now, so the new archive is
+		// the only copy left here and stays put if it can't be moved.
+		if err := os.Rename(tmp, dst); err != nil {
+			return fmt.Errorf("the original is in the trash, and the converted archive stays at %s: %v", tmp, err)
+		}
+		return nil
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	if replace && !same {
+		if err := trash.Move(src); err != nil {
+			return fmt.Errorf("converted to %s, but the original stays: %v", dst, err)
+		}
+	}
+	return nil
+}
+
+// writeCBZ writes pages, info and extras, as cbz.Write does, to a
+// temporary file next to dst, and checks that it opens with all of its
+// pages. Moving it into place, or
+// removing it, is up to the caller.
+func writeCBZ(dst string, pages cbz.Pages, info []byte, extras []*zip.File, opt cbz.Options, progress func(done int)) (path string, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	if err = cbz.Write(w, pages, info, extras, opt, progress); err != nil {
+		return "", err
+	}
+	if err = w.Flush(); err != nil {
+		return "", err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	out, err := archive.NewZip(tmp.Name())
+	if err != nil {
+		return "", fmt.Errorf("the new archive doesn't open: %v", err)
+	}
+	n := out.Len()
+	out.Close()
+	if n != pages.Len() {
+		return "", fmt.Errorf("the new archive has %d pages instead of %d", n, pages.Len())
+	}
+	return tmp.Name(), nil
+}
+
+func (gui *GUI) initConvertDialog() {
+	gui.ConvertDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	gui.ConvertDialog.AddButton("_Convert", gtk.RESPONSE_ACCEPT)
+	gui.ConvertDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	gui.ConvertWidthSpinButton.SetRange(0, 10000)
+	gui.ConvertWidthSpinButton.SetIncrements(100, 500)
+	gui.ConvertQualitySpinButton.SetRange(0, 100)
+	gui.ConvertQualitySpinButton.SetIncrements(5, 10)
+}
+
+// RunConvertDialog converts the current archive to CBZ in the
+// background.
+func (gui *GUI) RunConvertDialog() {
+	if !gui.Loaded() || gui.State.Converting {
+		return
+	}
+	src := gui.State.ArchivePath
+	if archive.IsRemote(src) {
+		gui.ShowError("Remote archives can't be converted")
+		return
+	}
+	dst := cbzPath(src)
+
+	gui.ConvertLabel.SetText("Write " + filepath.Base(dst))
+	gui.ConvertWidthSpinButton.SetValue(float64(gui.Config.ConvertMaxWidth))
+	gui.ConvertQualitySpinButton.SetValue(float64(gui.Config.ConvertQuality))
+	gui.ConvertReplaceCheckButton.SetActive(gui.Config.ConvertReplace || src == dst)
+
+	res := gtk.ResponseType(gui.ConvertDialog.Run())
+	gui.ConvertDialog.Hide()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	gui.Config.ConvertMaxWidth = gui.ConvertWidthSpinButton.GetValueAsInt()
+	gui.Config.ConvertQuality = gui.ConvertQualitySpinButton.GetValueAsInt()
+	replace := gui.ConvertReplaceCheckButton.GetActive()
+	if src != dst {
+		gui.Config.ConvertReplace = replace
+	}
+	opt := cbz.Options{MaxWidth: gui.Config.ConvertMaxWidth, Quality: gui.Config.ConvertQuality}
+
+	gui.State.Converting = true
+	gui.MenuItemConvert.SetSensitive(false)
+	name := filepath.Base(dst)
+	fp := gui.State.ArchiveFingerprint
+
+	go func() {
+		var newFP string
+		err := convertArchive(src, dst, opt, replace, func(done, total int) {
+			glib.IdleAdd(func() {
+				gui.SetStatus(fmt.Sprintf("Converting to %s: %d of %d pages", name, done, total))
+			})
+		})
+		if err == nil && replace {
+			if newFP, err = library.Fingerprint(dst); err != nil {
+				err = fmt.Errorf("converted to %s, but its bookmarks stay with the original: %v", dst, err)
+			}
+		}
+		glib.IdleAdd(func() {
+			gui.State.Converting = false
+			gui.MenuItemConvert.SetSensitive(true)
+			if err != nil {
+				gui.ShowError(err.Error())
+				return
+			}
+			gui.SetStatus("Converted to " + name)
+			if !replace {
+				return
+			}
+
+			// The original is gone, so its bookmarks and position
+			// go over to the new archive.
+			if gui.State.ArchivePath == src {
+				gui.recordProgress()
+			}
+			gui.rekeyArchive(src, fp, dst, newFP)
+
+			// Carry on reading the new archive.
+			if gui.State.ArchivePath == src {
+				pos := gui.State.ArchivePos
+				gui.LoadArchive(dst)
+				gui.SetPage(pos)
+			}
+		})
+	}()
+}
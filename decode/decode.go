@@ -0,0 +1,120 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package decode keeps a registry of image formats that gomics decodes
+// itself, in Go, rather than through whichever gdk-pixbuf loaders are
+// installed.
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+)
+
+// Format is a registered image format.
+type Format struct {
+	Name       string
+	Extensions []string // with the dot, in lower case
+	Match      func(header []byte) bool
+	Decode     func(r io.Reader) (image.Image, error)
+}
+
+// HeaderSize is as much of the file as Match gets to see, at most.
+const HeaderSize = 64
+
+// ErrUnknown is returned for data that no registered format matches.
+var ErrUnknown = errors.New("decode: unknown image format")
+
+var formats []Format
+
+// Register adds a format. Formats are matched in the order they're
+// registered in.
+func Register(f Format) {
+	formats = append(formats, f)
+}
+
+// Extensions returns the extensions of the registered formats.
+func Extensions() []string {
+	var exts []string
+	for _, f := range formats {
+		exts = append(exts, f.Extensions...)
+	}
+	return exts
+}
+
+// Sniff returns the format of data, judging by its first bytes, or nil.
+func Sniff(data []byte) *Format {
+	if len(data) > HeaderSize {
+		data = data[:HeaderSize]
+	}
+	for i := range formats {
+		if formats[i].Match(data) {
+			return &formats[i]
+		}
+	}
+	return nil
+}
+
+// Decode decodes data with the format it's in.
+func Decode(data []byte) (image.Image, *Format, error) {
+	f := Sniff(data)
+	if f == nil {
+		return nil, nil, ErrUnknown
+	}
+	img, err := f.Decode(bytes.NewReader(data))
+	return img, f, err
+}
+
+// IsWebP reports whether header starts a WebP file.
+func IsWebP(header []byte) bool {
+	return len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP"
+}
+
+// IsAVIF reports whether header starts an AVIF file: an ISO media file
+// with the avif or avis brand, as the major brand or a compatible one.
+func IsAVIF(header []byte) bool {
+	if len(header) < 16 || string(header[4:8]) != "ftyp" {
+		return false
+	}
+	n := int(header[0])<<24 | int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	if n < 16 {
+		return false
+	}
+	if n > len(header) {
+		n = len(header)
+	}
+	for i := 8; i+4 <= n; i += 4 {
+		if i == 12 { // minor version
+			continue
+		}
+		if b := string(header[i : i+4]); b == "avif" || b == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	jxlCodestream = []byte{0xff, 0x0a}
+	jxlContainer  = []byte{0, 0, 0, 0x0c, 'J', 'X', 'L', ' ', 0x0d, 0x0a, 0x87, 0x0a}
+)
+
+// IsJXL reports whether header starts a JPEG XL file, either a bare
+// codestream or one in the ISO media container.
+func IsJXL(header []byte) bool {
+	return bytes.HasPrefix(header, jxlCodestream) || bytes.HasPrefix(header, jxlContainer)
+}
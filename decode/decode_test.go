@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package decode
+
+import (
+	"errors"
+	"image"
+	"io"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	for _, c := range []struct {
+		header          string
+		webp, avif, jxl bool
+	}{
+		{"RIFF\x10\x00\x00\x00WEBPVP8 ", true, false, false},
+		{"RIFF\x10\x00\x00\x00WAVEfmt ", false, false, false},
+		{"\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", false, true, false},
+		{"\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avis", false, true, false},
+		{"\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", false, false, false},
+		{"\x00\x00\x00\x10ftypmp42avif\x00\x00\x00\x00", false, false, false}, // avif as the minor version
+		{"\xff\x0a\xfa\x1f", false, false, true},
+		{"\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a\x00\x00\x00\x14ftypjxl ", false, false, true},
+		{"\xff\xd8\xff\xe0", false, false, false},
+		{"", false, false, false},
+	} {
+		h := []byte(c.header)
+		if IsWebP(h) != c.webp || IsAVIF(h) != c.avif || IsJXL(h) != c.jxl {
+			t.Errorf("%q: got webp %v, avif %v, jxl %v", c.header, IsWebP(h), IsAVIF(h), IsJXL(h))
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	defer func(saved []Format) { formats = saved }(formats)
+	formats = nil
+
+	errBad := errors.New("bad")
+	Register(Format{
+		Name:       "webp",
+		Extensions: []string{".webp"},
+		Match:      IsWebP,
+		Decode: func(io.Reader) (image.Image, error) {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), nil
+		},
+	})
+	Register(Format{
+		Name:       "jxl",
+		Extensions: []string{".jxl"},
+		Match:      IsJXL,
+		Decode:     func(io.Reader) (image.Image, error) { return nil, errBad },
+	})
+
+	if got := Extensions(); len(got) != 2 || got[0] != ".webp" || got[1] != ".jxl" {
+		t.Errorf("Extensions() = %v", got)
+	}
+	if img, f, err := Decode([]byte("RIFF\x00\x00\x00\x00WEBP")); err != nil || f.Name != "webp" || img.Bounds().Dx() != 1 {
+		t.Errorf("Decode of WebP = %v, %v, %v", img, f, err)
+	}
+	if _, f, err := Decode([]byte{0xff, 0x0a}); err != errBad || f.Name != "jxl" {
+		t.Errorf("Decode of JPEG XL = %v, %v", f, err)
+	}
+	if _, f, err := Decode([]byte{0xff, 0xd8}); err != ErrUnknown || f != nil {
+		t.Errorf("Decode of JPEG = %v, %v", f, err)
+	}
+}
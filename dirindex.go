@@ -0,0 +1,166 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/dirwatch"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// dirIndex is the sorted list of archives in a directory. As long as
+// the directory is being watched, the list is kept up to date instead
+// of being read from scratch on every archive step.
+type dirIndex struct {
+	dir     string
+	names   []string
+	watcher *dirwatch.Watcher // nil if the directory isn't watched
+}
+
+// find returns the position of name in the index, or the position it
+// would be inserted at if it's not there.
+func (idx *dirIndex) find(name string) (i int, found bool) {
+	i = sort.Search(len(idx.names), func(i int) bool { return !archive.ArchiveLess(idx.names[i], name) })
+
+	// Names differing only in case sort next to each other.
+	for j := i; j < len(idx.names) && !archive.ArchiveLess(name, idx.names[j]); j++ {
+		if idx.names[j] == name {
+			return j, true
+		}
+	}
+	return i, false
+}
+
+func (idx *dirIndex) insert(name string) bool {
+	if !archive.ExtensionMatch(name, archive.ArchiveExtensions) {
+		return false
+	}
+	i, found := idx.find(name)
+	if found {
+		return false
+	}
+	idx.names = append(idx.names, "")
+	copy(idx.names[i+1:], idx.names[i:])
+	idx.names[i] = name
+	return true
+}
+
+func (idx *dirIndex) remove(name string) bool {
+	i, found := idx.find(name)
+	if !found {
+		return false
+	}
+	idx.names = append(idx.names[:i], idx.names[i+1:]...)
+	return true
+}
+
+func (idx *dirIndex) close() {
+	if idx.watcher != nil {
+		idx.watcher.Close()
+		idx.watcher = nil
+	}
+}
+
+// archiveIndex returns the index of the given directory, building it
+// and starting to watch the directory if needed.
+func (gui *GUI) archiveIndex(dir string) (*dirIndex, error) {
+	idx := gui.State.DirIndex
+	if idx != nil && idx.dir == dir && idx.watcher != nil {
+		return idx, nil
+	}
+	if idx != nil {
+		idx.close()
+		gui.State.DirIndex = nil
+	}
+
+	names, err := archive.ListArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	idx = &dirIndex{dir: dir, names: names}
+	if idx.watcher, err = dirwatch.New(dir); err != nil {
+		// Fall back to reading the directory every time.
+		log.Println(err)
+	} else {
+		go gui.watchDir(idx, idx.watcher)
+	}
+
+	gui.State.DirIndex = idx
+	return idx, nil
+}
+
+// watchDir runs on its own goroutine, so it's given the watcher rather
+// than reading idx.watcher, which the main thread may clear.
+func (gui *GUI) watchDir(idx *dirIndex, w *dirwatch.Watcher) {
+	go func() {
+		for err := range w.Errors {
+			log.Println(err)
+		}
+	}()
+
+	for ev := range w.Events {
+		ev := ev
+		glib.IdleAdd(func() {
+			gui.dirEvent(idx, ev)
+		})
+	}
+
+	// The directory is gone or the watch was cancelled; the list
+	// will be read from scratch next time.
+	glib.IdleAdd(func() {
+		if idx.watcher == w {
+			idx.watcher = nil
+		}
+	})
+}
+
+// dirEvent updates the index, and lets the user know when the current
+// archive disappears or a new one shows up next to it. It runs on the
+// main loop.
+func (gui *GUI) dirEvent(idx *dirIndex, ev dirwatch.Event) {
+	if gui.State.DirIndex != idx {
+		return
+	}
+
+	dir, cur := filepath.Split(gui.State.ArchivePath)
+	isCur := gui.Loaded() && filepath.Clean(dir) == filepath.Clean(idx.dir)
+
+	switch ev.Op {
+	case dirwatch.Create:
+		if idx.insert(ev.Name) && isCur && ev.Name != cur {
+			gui.SetStatus("New archive in the directory: " + ev.Name)
+		}
+	case dirwatch.Remove:
+		if idx.remove(ev.Name) && isCur && ev.Name == cur {
+			gui.SetStatus(cur + " was removed from the directory")
+		}
+	case dirwatch.Rename:
+		idx.remove(ev.OldName)
+		inserted := idx.insert(ev.Name)
+		if isCur && ev.OldName == cur {
+			// Keep following the archive under its new name.
+			gui.State.ArchivePath = filepath.Join(idx.dir, ev.Name)
+			gui.State.ArchiveName = ev.Name
+			gui.StatusImage()
+		} else if inserted && isCur {
+			gui.SetStatus("New archive in the directory: " + ev.Name)
+		}
+	}
+}
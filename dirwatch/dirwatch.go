@@ -0,0 +1,116 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dirwatch reports files being created, removed and renamed in
+// a directory. It uses inotify on Linux and falls back to polling on
+// other systems.
+package dirwatch
+
+import (
+	"sort"
+	"time"
+)
+
+type Op int
+
+const (
+	Create Op = iota
+	Remove
+	Rename
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// An Event describes a change of a directory entry. Names are relative
+// to the watched directory. OldName is only set for renames within the
+// directory; moving a file in or out of it is reported as Create or
+// Remove.
+type Event struct {
+	Op      Op
+	Name    string
+	OldName string
+}
+
+// PollInterval is how often the directory is re-read where inotify is
+// not available.
+var PollInterval = 2 * time.Second
+
+// Watcher watches a single directory. Events and Errors are closed once
+// the watcher is closed, or the directory itself is removed.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+	dir    string
+	impl   watcher
+}
+
+type watcher interface {
+	close() error
+}
+
+func New(dir string) (*Watcher, error) {
+	w := &Watcher{
+		Events: make(chan Event, 64),
+		Errors: make(chan error, 1),
+		dir:    dir,
+	}
+	impl, err := newWatcher(w)
+	if err != nil {
+		return nil, err
+	}
+	w.impl = impl
+	return w, nil
+}
+
+func (w *Watcher) Dir() string {
+	return w.dir
+}
+
+func (w *Watcher) Close() error {
+	return w.impl.close()
+}
+
+// diff reports the differences between two sorted lists of names.
+func diff(old, cur []string, emit func(Event)) {
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && old[i] < cur[j]):
+			emit(Event{Op: Remove, Name: old[i]})
+			i++
+		case i == len(old) || cur[j] < old[i]:
+			emit(Event{Op: Create, Name: cur[j]})
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+}
+
+func sortedNames(names []string) []string {
+	sort.Strings(names)
+	return names
+}
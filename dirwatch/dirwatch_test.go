@@ -0,0 +1,88 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dirwatch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	PollInterval = 50 * time.Millisecond
+	dir := t.TempDir()
+
+	w, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	next := func() Event {
+		select {
+		case ev := <-w.Events:
+			return ev
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return Event{}
+	}
+
+	a, b := filepath.Join(dir, "a.cbz"), filepath.Join(dir, "b.cbz")
+	if err := os.WriteFile(a, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(); ev != (Event{Op: Create, Name: "a.cbz"}) {
+		t.Errorf("got %+v, want creation of a.cbz", ev)
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(); ev != (Event{Op: Remove, Name: "a.cbz"}) {
+		t.Errorf("got %+v, want removal of a.cbz", ev)
+	}
+
+	if err := os.WriteFile(b, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	next()
+	if err := os.Rename(b, a); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "linux" {
+		// Polling can't tell a rename from a removal and a creation.
+		return
+	}
+	if ev := next(); ev != (Event{Op: Rename, Name: "a.cbz", OldName: "b.cbz"}) {
+		t.Errorf("got %+v, want b.cbz renamed to a.cbz", ev)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var got []Event
+	diff([]string{"a", "b", "d"}, []string{"b", "c", "d", "e"}, func(ev Event) { got = append(got, ev) })
+
+	want := []Event{{Op: Remove, Name: "a"}, {Op: Create, Name: "c"}, {Op: Create, Name: "e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dirwatch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+type inotify struct {
+	f *os.File
+}
+
+func newWatcher(w *Watcher) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	if _, err := syscall.InotifyAddWatch(fd, w.dir, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// The descriptor is non-blocking, so reads go through the runtime
+	// poller, and closing the file interrupts a pending read.
+	in := &inotify{f: os.NewFile(uintptr(fd), "inotify")}
+	go in.run(w)
+	return in, nil
+}
+
+func (in *inotify) close() error {
+	return in.f.Close()
+}
+
+func (in *inotify) run(w *Watcher) {
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	var buf [64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)]byte
+	for {
+		n, err := in.f.Read(buf[:])
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.Errors <- err
+			}
+			return
+		}
+
+		if done := in.parse(w, buf[:n]); done {
+			in.f.Close()
+			return
+		}
+	}
+}
+
+// parse sends the events in buf, and reports whether the directory
+// itself went away.
+func (in *inotify) parse(w *Watcher, buf []byte) (done bool) {
+	// A rename shows up as a MOVED_FROM and MOVED_TO pair sharing a
+	// cookie. These are queued together, so pairing them within a
+	// single read is sufficient.
+	movedFrom := make(map[uint32]string)
+	var events []Event
+
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(raw.Len)]
+		name := string(bytes.TrimRight(nameBytes, "\x00"))
+		off += syscall.SizeofInotifyEvent + int(raw.Len)
+
+		switch {
+		case raw.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0:
+			done = true
+		case raw.Mask&syscall.IN_CREATE != 0:
+			events = append(events, Event{Op: Create, Name: name})
+		case raw.Mask&syscall.IN_DELETE != 0:
+			events = append(events, Event{Op: Remove, Name: name})
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			movedFrom[raw.Cookie] = name
+			events = append(events, Event{Op: Remove, Name: name})
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			if old, ok := movedFrom[raw.Cookie]; ok {
+				// Turn the earlier removal into a rename.
+				for i := range events {
+					if events[i].Op == Remove && events[i].Name == old {
+						events = append(events[:i], events[i+1:]...)
+						break
+					}
+				}
+				events = append(events, Event{Op: Rename, Name: name, OldName: old})
+			} else {
+				events = append(events, Event{Op: Create, Name: name})
+			}
+		}
+	}
+
+	for _, ev := range events {
+		w.Events <- ev
+	}
+	return done
+}
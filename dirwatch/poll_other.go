@@ -0,0 +1,84 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !linux
+// +build !linux
+
+package dirwatch
+
+import (
+	"os"
+	"time"
+)
+
+type poller struct {
+	stop chan struct{}
+}
+
+func newWatcher(w *Watcher) (watcher, error) {
+	names, err := readDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &poller{stop: make(chan struct{})}
+	go p.run(w, names)
+	return p, nil
+}
+
+func (p *poller) close() error {
+	close(p.stop)
+	return nil
+}
+
+func (p *poller) run(w *Watcher, names []string) {
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := readDir(w.dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.Errors <- err
+			}
+			return
+		}
+		diff(names, cur, func(ev Event) { w.Events <- ev })
+		names = cur
+	}
+}
+
+func readDir(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	return sortedNames(names), nil
+}
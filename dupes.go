@@ -0,0 +1,658 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/dupes"
+	"github.com/salviati/gomics/imgdiff"
+	"github.com/salviati/gomics/trash"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+const (
+	dupesDefaultThreshold = 0.85
+	dupesDefaultSamples   = 4
+	dupesPreviewSize      = 160
+
+	dupesResponseTrash gtk.ResponseType = 1
+)
+
+// Columns of the duplicates list.
+const (
+	dupesColumnMarkup = iota
+	dupesColumnGroup
+	dupesColumnMember // -1 on the rows of groups
+)
+
+var (
+	dupesThreshold float64
+	dupesSamples   int
+	dupesHash      string
+	dupesJSON      bool
+	dupesPages     bool
+)
+
+func dupesFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&dupesThreshold, "threshold", dupesDefaultThreshold, "how `similar` archives must be to be grouped, from 0 to 1")
+	fs.IntVar(&dupesSamples, "samples", dupesDefaultSamples, "`number` of pages compared besides the cover")
+	fs.StringVar(&dupesHash, "hash", imgdiff.Difference.Name(), "perceptual hash: dhash, ahash, phash, whash or color")
+	fs.BoolVar(&dupesJSON, "json", false, "print JSON")
+	fs.BoolVar(&dupesPages, "pages", false, "list the pages repeated within each archive instead")
+}
+
+// runDupes prints groups of archives that look like copies of each
+// other.
+func runDupes(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	h := imgdiff.Lookup(dupesHash)
+	if h == nil {
+		return fmt.Errorf("unknown hash %q", dupesHash)
+	}
+	if dupesPages {
+		return runDupePages(h, args)
+	}
+
+	paths, err := findArchives(args)
+	if err != nil {
+		return err
+	}
+	mem := budget.New(defaultMemoryBudget << 20)
+	sigs := signArchives(paths, h, dupesSamples, mem, nil, func(path string, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+	})
+	groups := dupes.Find(sigs, h, dupesThreshold)
+
+	if dupesJSON {
+		type member struct {
+			Path  string
+			Pages int
+			Size  int64
+		}
+		type group struct {
+			Score    float64
+			Archives []member
+		}
+		out := make([]group, 0, len(groups))
+		for _, g := range groups {
+			jg := group{Score: g.Score}
+			for _, m := range g.Members {
+				jg.Archives = append(jg.Archives, member{m.Path, m.Pages, m.Size})
+			}
+			out = append(out, jg)
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(out)
+	}
+
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%.0f%% similar:\n", g.Score*100)
+		for _, m := range g.Members {
+			fmt.Printf("\t%s\t%d pages\t%s\n", m.Path, m.Pages, byteSize(m.Size))
+		}
+	}
+	return nil
+}
+
+// runDupePages prints the pages repeated within archives, numbered
+// from 1.
+func runDupePages(h imgdiff.Hasher, args []string) error {
+	type repeat struct {
+		Page, Original int
+		Similarity     float64
+	}
+	type report struct {
+		Path    string
+		Repeats []repeat
+	}
+
+	var (
+		reports []report
+		failed  int
+	)
+	mem := budget.New(defaultMemoryBudget << 20)
+	for _, path := range args {
+		hashes, err := hashPages(path, h, true, mem, nil, func(int) {})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		r := report{Path: path, Repeats: []repeat{}}
+		for _, p := range dupes.Pages(hashes, h, duplicatePageDistance) {
+			r.Repeats = append(r.Repeats, repeat{p.Page + 1, p.Original + 1, 1 - p.Distance})
+		}
+		reports = append(reports, r)
+	}
+
+	if dupesJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "\t")
+		if err := e.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range reports {
+			if len(r.Repeats) == 0 {
+				continue
+			}
+			fmt.Println(r.Path + ":")
+			for _, p := range r.Repeats {
+				fmt.Printf("\tpage %d repeats page %d (%.0f%% similar)\n", p.Page, p.Original, p.Similarity*100)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed", failed, len(args))
+	}
+	return nil
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// findArchives lists the archives in and under dirs.
+func findArchives(dirs []string) ([]string, error) {
+	var paths []string
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() && archive.ExtensionMatch(path, archive.ArchiveExtensions) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// signArchives computes the signatures of the archives on all CPUs,
+// calling done after each one. Archives that can't be read are left
+// out. A nil result means it was stopped.
+func signArchives(paths []string, h imgdiff.Hasher, samples int, mem *budget.Manager, stop <-chan struct{}, done func(path string, err error)) []*dupes.Signature {
+	var (
+		mu   sync.Mutex
+		sigs []*dupes.Signature
+		wg   sync.WaitGroup
+	)
+	work := make(chan string)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				sig, err := signArchive(path, h, samples, mem)
+				if err == nil {
+					mu.Lock()
+					sigs = append(sigs, sig)
+					mu.Unlock()
+				}
+				done(path, err)
+			}
+		}()
+	}
+
+	stopped := false
+	for _, path := range paths {
+		select {
+		case work <- path:
+			continue
+		case <-stop:
+			stopped = true
+		}
+		break
+	}
+	close(work)
+	wg.Wait()
+
+	if stopped {
+		return nil
+	}
+	return sigs
+}
+
+func signArchive(path string, h imgdiff.Hasher, samples int, mem *budget.Manager) (*dupes.Signature, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	ar, err := archive.NewArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	if ar.Len() == 0 {
+		return nil, errors.New("no pages")
+	}
+	sig := &dupes.Signature{Path: path, Size: fi.Size(), Pages: ar.Len()}
+
+	hash := func(i int) (imgdiff.Hash, error) {
+		pixbuf, err := ar.Load(i, true)
+		if err != nil {
+			return 0, err
+		}
+		defer mem.Discard(pixbufBytes(pixbuf))
+		return hashPixbuf(h, pixbuf)
+	}
+
+	if sig.Cover, err = hash(0); err != nil {
+		return nil, err
+	}
+	for _, i := range dupes.SamplePages(ar.Len(), samples) {
+		// A broken page counts as unlike anything.
+		hh, err := hash(i)
+		if err != nil {
+			log.Println(path+":", err)
+		}
+		sig.Samples = append(sig.Samples, hh)
+	}
+	return sig, nil
+}
+
+// dupesReport holds the state of the duplicates dialog. The scan and
+// the previews run in the background, and their results are dropped
+// once the dialog is closed.
+type dupesReport struct {
+	groups      []dupes.Group
+	done, total int
+	scanning    bool
+	covers      map[string]*gdk.Pixbuf
+	previews    []*gtk.Box
+	gen         int
+	stop        chan struct{} // closed when gen changes
+	store       *gtk.TreeStore
+}
+
+func (d *dupesReport) reset() (int, chan struct{}) {
+	if d.stop != nil {
+		close(d.stop)
+	}
+	d.gen++
+	d.stop = make(chan struct{})
+	d.groups = nil
+	d.done, d.total = 0, 0
+	d.scanning = false
+	d.covers = make(map[string]*gdk.Pixbuf)
+	return d.gen, d.stop
+}
+
+func (gui *GUI) initDupesDialog() {
+	gui.DupesDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+	gui.DupesDialog.AddButton("Move to _Trash", dupesResponseTrash)
+	gui.DupesDialog.AddButton("_Open", gtk.RESPONSE_ACCEPT)
+	gui.DupesDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	gui.DupesFolderDialog.AddButton("_Search", gtk.RESPONSE_ACCEPT)
+	gui.DupesFolderDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+
+	store, err := gtk.TreeStoreNew(glib.TYPE_STRING, glib.TYPE_INT, glib.TYPE_INT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.Dupes.store = store
+	gui.DupesTreeView.SetModel(store)
+
+	renderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err := gtk.TreeViewColumnNewWithAttribute("", renderer, "markup", dupesColumnMarkup)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.DupesTreeView.AppendColumn(column)
+
+	gui.DupesTreeView.Connect("row-activated", func() {
+		gui.DupesDialog.Response(gtk.RESPONSE_ACCEPT)
+	})
+
+	if sel, err := gui.DupesTreeView.GetSelection(); err == nil {
+		sel.Connect("changed", func() {
+			group, _, ok := gui.selectedDuplicate()
+			if ok {
+				gui.showDuplicatePreviews(group)
+			}
+		})
+	}
+}
+
+// FindDuplicates asks for a folder, and lists the archives in it that
+// look like copies of each other.
+func (gui *GUI) FindDuplicates() {
+	dir := gui.Config.LastDirectory
+	if len(gui.Config.LibraryRoots) > 0 {
+		dir = gui.Config.LibraryRoots[0]
+	}
+	gui.DupesFolderDialog.SetCurrentFolder(dir)
+
+	res := gtk.ResponseType(gui.DupesFolderDialog.Run())
+	gui.DupesFolderDialog.Hide()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	gui.scanDuplicates(gui.DupesFolderDialog.GetFilename())
+	defer gui.Dupes.reset()
+
+	for {
+		switch gtk.ResponseType(gui.DupesDialog.Run()) {
+		case gtk.RESPONSE_ACCEPT:
+			// The dialog stays up, so that archives can be
+			// opened one after the other.
+			if _, m, ok := gui.selectedDuplicate(); ok && m != nil {
+				gui.LoadArchive(m.Path)
+			}
+		case dupesResponseTrash:
+			gui.trashDuplicate()
+		default:
+			gui.DupesDialog.Hide()
+			return
+		}
+	}
+}
+
+func (gui *GUI) scanDuplicates(dir string) {
+	gen, stop := gui.Dupes.reset()
+	gui.Dupes.scanning = true
+	gui.showDuplicates()
+
+	h := gui.hasher()
+
+	update := func(f func()) {
+		glib.IdleAdd(func() {
+			if gen == gui.Dupes.gen {
+				f()
+			}
+		})
+	}
+
+	go func() {
+		paths, err := findArchives([]string{dir})
+		if err != nil {
+			update(func() {
+				gui.Dupes.scanning = false
+				gui.DupesStatusLabel.SetText(err.Error())
+			})
+			return
+		}
+		update(func() {
+			gui.Dupes.total = len(paths)
+			gui.updateDupesStatus()
+		})
+
+		sigs := signArchives(paths, h, dupesDefaultSamples, gui.Memory, stop, func(path string, err error) {
+			if err != nil {
+				log.Println(path+":", err)
+			}
+			update(func() {
+				gui.Dupes.done++
+				gui.updateDupesStatus()
+			})
+		})
+		if sigs == nil {
+			return
+		}
+
+		groups := dupes.Find(sigs, h, dupesDefaultThreshold)
+		update(func() {
+			gui.Dupes.groups = groups
+			gui.Dupes.scanning = false
+			gui.showDuplicates()
+		})
+	}()
+}
+
+func (gui *GUI) updateDupesStatus() {
+	d := &gui.Dupes
+	switch {
+	case d.scanning && d.total == 0:
+		gui.DupesStatusLabel.SetText("Looking for archives...")
+	case d.scanning:
+		gui.DupesStatusLabel.SetText(fmt.Sprintf("Comparing archives: %d of %d", d.done, d.total))
+	case len(d.groups) == 0:
+		gui.DupesStatusLabel.SetText("No duplicates found")
+	default:
+		gui.DupesStatusLabel.SetText(fmt.Sprintf("%d groups of duplicates", len(d.groups)))
+	}
+}
+
+func (gui *GUI) showDuplicates() {
+	store := gui.Dupes.store
+	store.Clear()
+	gui.clearDuplicatePreviews()
+	gui.updateDupesStatus()
+
+	for i, g := range gui.Dupes.groups {
+		parent := store.Append(nil)
+		markup := fmt.Sprintf("<b>%.0f%% similar</b>, %d archives", g.Score*100, len(g.Members))
+		store.SetValue(parent, dupesColumnMarkup, markup)
+		store.SetValue(parent, dupesColumnGroup, i)
+		store.SetValue(parent, dupesColumnMember, -1)
+
+		for j, m := range g.Members {
+			iter := store.Append(parent)
+			markup := fmt.Sprintf("%s\n<small>%s, %d pages, %s</small>",
+				html.EscapeString(filepath.Base(m.Path)), html.EscapeString(filepath.Dir(m.Path)), m.Pages, byteSize(m.Size))
+			store.SetValue(iter, dupesColumnMarkup, markup)
+			store.SetValue(iter, dupesColumnGroup, i)
+			store.SetValue(iter, dupesColumnMember, j)
+		}
+	}
+	gui.DupesTreeView.ExpandAll()
+}
+
+// selectedDuplicate returns the group of the selected row, and the
+// archive if it's one.
+func (gui *GUI) selectedDuplicate() (int, *dupes.Signature, bool) {
+	sel, err := gui.DupesTreeView.GetSelection()
+	if err != nil {
+		return 0, nil, false
+	}
+	_, iter, ok := sel.GetSelected()
+	if !ok {
+		return 0, nil, false
+	}
+
+	column := func(c int) (int, bool) {
+		v, err := gui.Dupes.store.GetValue(iter, c)
+		if err != nil {
+			return 0, false
+		}
+		i, err := v.GoValue()
+		if err != nil {
+			return 0, false
+		}
+		return i.(int), true
+	}
+	group, ok1 := column(dupesColumnGroup)
+	member, ok2 := column(dupesColumnMember)
+	if !ok1 || !ok2 || group >= len(gui.Dupes.groups) {
+		return 0, nil, false
+	}
+	members := gui.Dupes.groups[group].Members
+	if member < 0 || member >= len(members) {
+		return group, nil, true
+	}
+	return group, members[member], true
+}
+
+func (gui *GUI) clearDuplicatePreviews() {
+	for _, box := range gui.Dupes.previews {
+		box.Destroy()
+	}
+	gui.Dupes.previews = nil
+}
+
+// showDuplicatePreviews puts the covers of a group side by side,
+// loading the ones that are missing in the background.
+func (gui *GUI) showDuplicatePreviews(group int) {
+	gui.clearDuplicatePreviews()
+
+	var missing []string
+	for _, m := range gui.Dupes.groups[group].Members {
+		box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		image, err := gtk.ImageNew()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		image.SetSizeRequest(dupesPreviewSize, dupesPreviewSize)
+		if cover, ok := gui.Dupes.covers[m.Path]; ok {
+			image.SetFromPixbuf(cover)
+		} else {
+			missing = append(missing, m.Path)
+		}
+		label, err := gtk.LabelNew(fmt.Sprintf("%s\n%d pages, %s", filepath.Base(m.Path), m.Pages, byteSize(m.Size)))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		label.SetLineWrap(true)
+		label.SetMaxWidthChars(20)
+
+		box.PackStart(image, false, false, 0)
+		box.PackStart(label, false, false, 0)
+		gui.DupesPreviewBox.PackStart(box, false, false, 0)
+		box.ShowAll()
+		gui.Dupes.previews = append(gui.Dupes.previews, box)
+	}
+
+	if len(missing) > 0 {
+		gui.loadDuplicateCovers(group, missing)
+	}
+}
+
+func (gui *GUI) loadDuplicateCovers(group int, paths []string) {
+	gen, stop := gui.Dupes.gen, gui.Dupes.stop
+	interp := interpolations[gui.Config.Interpolation]
+	mem := gui.Memory
+
+	go func() {
+		for _, path := range paths {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			cover, err := loadCover(path, dupesPreviewSize, interp, mem)
+			if err != nil {
+				log.Println(path+":", err)
+				continue
+			}
+			path := path
+			glib.IdleAdd(func() {
+				if gen != gui.Dupes.gen {
+					return
+				}
+				gui.Dupes.covers[path] = cover
+				if g, _, ok := gui.selectedDuplicate(); ok && g == group {
+					gui.showDuplicatePreviews(group)
+				}
+			})
+		}
+	}()
+}
+
+// loadCover returns the first page of an archive, scaled to fit size.
+func loadCover(path string, size int, interp gdk.InterpType, mem *budget.Manager) (*gdk.Pixbuf, error) {
+	ar, err := archive.NewArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	pixbuf, err := ar.Load(0, true)
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Discard(pixbufBytes(pixbuf))
+	w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), size, size)
+	return pixbuf.ScaleSimple(w, h, interp)
+}
+
+// trashDuplicate moves the selected archive to the trash, and takes it
+// off the list. If it's the archive being read, it's closed only once
+// it's in the trash.
+func (gui *GUI) trashDuplicate() {
+	group, m, ok := gui.selectedDuplicate()
+	if !ok || m == nil {
+		return
+	}
+
+	if err := trash.Move(m.Path); err != nil {
+		gui.DupesStatusLabel.SetText(err.Error())
+		return
+	}
+	if gui.State.ArchivePath == m.Path {
+		gui.Close()
+	}
+
+	g := &gui.Dupes.groups[group]
+	for i := range g.Members {
+		if g.Members[i] == m {
+			g.Members = append(g.Members[:i], g.Members[i+1:]...)
+			break
+		}
+	}
+	if len(g.Members) < 2 {
+		gui.Dupes.groups = append(gui.Dupes.groups[:group], gui.Dupes.groups[group+1:]...)
+	}
+	gui.showDuplicates()
+	gui.DupesStatusLabel.SetText("Moved " + filepath.Base(m.Path) + " to the trash")
+}
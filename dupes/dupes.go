@@ -0,0 +1,170 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dupes finds archives that are likely copies of each other,
+// such as re-releases of a chapter at another quality, by comparing
+// perceptual hashes of their covers and of pages sampled across them.
+// It also finds pages repeated within an archive.
+package dupes
+
+import (
+	"github.com/salviati/gomics/imgdiff"
+	"sort"
+)
+
+// Signature sums up an archive for comparison.
+type Signature struct {
+	Path    string
+	Size    int64
+	Pages   int
+	Cover   imgdiff.Hash
+	Samples []imgdiff.Hash // of the pages returned by SamplePages
+}
+
+// Archives whose page counts differ more than this aren't compared.
+const minPageRatio = 0.5
+
+// Weights of the parts of the similarity.
+const (
+	coverWeight   = 0.4
+	samplesWeight = 0.4
+	pagesWeight   = 0.2
+)
+
+// SamplePages returns up to count pages spread evenly over an archive
+// of n pages, leaving out the cover.
+func SamplePages(n, count int) []int {
+	if n-1 < count {
+		count = n - 1
+	}
+	pages := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		pages = append(pages, 1+(2*i+1)*(n-1)/(2*count))
+	}
+	return pages
+}
+
+// Similarity returns how alike two archives are, from 0 to 1.
+func Similarity(a, b *Signature, h imgdiff.Hasher) float64 {
+	cover := 1 - h.Distance(a.Cover, b.Cover)
+	pages := pageRatio(a.Pages, b.Pages)
+	if len(a.Samples) == 0 || len(b.Samples) == 0 {
+		return (cover*coverWeight + pages*pagesWeight) / (coverWeight + pagesWeight)
+	}
+	return cover*coverWeight + matchSamples(a.Samples, b.Samples, h)*samplesWeight + pages*pagesWeight
+}
+
+func pageRatio(a, b int) float64 {
+	if a > b {
+		a, b = b, a
+	}
+	if b == 0 {
+		return 1
+	}
+	return float64(a) / float64(b)
+}
+
+// matchSamples compares each sample of a with the one at the same
+// place in b and its neighbours, which allows for a page or two added
+// or removed, such as a credits page.
+func matchSamples(a, b []imgdiff.Hash, h imgdiff.Hasher) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	total := 0.0
+	for i := range a {
+		j := i * len(b) / len(a)
+		best := 0.0
+		for k := j - 1; k <= j+1; k++ {
+			if k < 0 || k >= len(b) {
+				continue
+			}
+			if s := 1 - h.Distance(a[i], b[k]); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	return total / float64(len(a))
+}
+
+// Group is a set of archives that are likely duplicates.
+type Group struct {
+	Members []*Signature
+	// Score is the lowest similarity between two members.
+	Score float64
+}
+
+// Find groups the archives whose similarity is at least threshold.
+// Grouping is transitive: if a is like b and b is like c, all three
+// end up together. Groups come sorted by score, best first.
+func Find(sigs []*Signature, h imgdiff.Hasher, threshold float64) []Group {
+	sorted := append([]*Signature(nil), sigs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pages < sorted[j].Pages })
+
+	parent := make([]int, len(sorted))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	for i := range sorted {
+		for j := i + 1; j < len(sorted); j++ {
+			if pageRatio(sorted[i].Pages, sorted[j].Pages) < minPageRatio {
+				break
+			}
+			if Similarity(sorted[i], sorted[j], h) >= threshold {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := make(map[int][]*Signature)
+	for i, s := range sorted {
+		r := root(i)
+		members[r] = append(members[r], s)
+	}
+
+	var groups []Group
+	for _, m := range members {
+		if len(m) < 2 {
+			continue
+		}
+		sort.Slice(m, func(i, j int) bool { return m[i].Path < m[j].Path })
+		score := 1.0
+		for i := range m {
+			for j := i + 1; j < len(m); j++ {
+				if s := Similarity(m[i], m[j], h); s < score {
+					score = s
+				}
+			}
+		}
+		groups = append(groups, Group{Members: m, Score: score})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Score != groups[j].Score {
+			return groups[i].Score > groups[j].Score
+		}
+		return groups[i].Members[0].Path < groups[j].Members[0].Path
+	})
+	return groups
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dupes
+
+import (
+	"github.com/salviati/gomics/imgdiff"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSamplePages(t *testing.T) {
+	for _, c := range []struct {
+		n, count int
+		want     []int
+	}{
+		{1, 4, []int{}},
+		{3, 4, []int{1, 2}},
+		{9, 4, []int{2, 4, 6, 8}},
+		{101, 4, []int{13, 38, 63, 88}},
+	} {
+		if got := SamplePages(c.n, c.count); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SamplePages(%d, %d) = %v, want %v", c.n, c.count, got, c.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	h := imgdiff.Difference
+	a := &Signature{Path: "a.cbz", Pages: 20, Cover: 0xff00ff00ff00ff00, Samples: []imgdiff.Hash{1, 2, 3, 4}}
+
+	if s := Similarity(a, a, h); math.Abs(s-1) > 1e-9 {
+		t.Errorf("an archive is %.2f like itself", s)
+	}
+
+	// A re-release with a credits page at the start and a slightly
+	// different cover.
+	b := &Signature{Path: "b.cbz", Pages: 21, Cover: 0xff00ff00ff00ff01, Samples: []imgdiff.Hash{0xf0, 1, 2, 3}}
+	if s := Similarity(a, b, h); s < 0.9 {
+		t.Errorf("re-release is only %.2f similar", s)
+	}
+
+	c := &Signature{Path: "c.cbz", Pages: 20, Cover: 0x00ff00ff00ff00ff, Samples: []imgdiff.Hash{^imgdiff.Hash(1), ^imgdiff.Hash(2), ^imgdiff.Hash(3), ^imgdiff.Hash(4)}}
+	if s := Similarity(a, c, h); s > 0.5 {
+		t.Errorf("unrelated archive is %.2f similar", s)
+	}
+
+	// Archives too short to sample are compared by cover.
+	d, e := &Signature{Pages: 1, Cover: 7}, &Signature{Pages: 1, Cover: 7}
+	if s := Similarity(d, e, h); math.Abs(s-1) > 1e-9 {
+		t.Errorf("single pages are %.2f similar", s)
+	}
+}
+
+func TestFind(t *testing.T) {
+	h := imgdiff.Difference
+	sig := func(path string, pages int, cover imgdiff.Hash) *Signature {
+		return &Signature{Path: path, Pages: pages, Cover: cover, Samples: []imgdiff.Hash{cover >> 1, cover >> 2}}
+	}
+	sigs := []*Signature{
+		sig("x/ch1.cbz", 20, 0xffff),
+		sig("unrelated.cbz", 20, 0xffff<<32),
+		sig("y/ch1-hq.cbz", 20, 0xfffe),
+		sig("ch2.cbz", 30, 0xff<<48),
+		sig("z/ch1.zip", 21, 0xffff),
+		sig("ch2-lq.cbz", 31, 0xff<<48),
+		sig("long.cbz", 200, 0xffff),
+	}
+
+	groups := Find(sigs, h, 0.9)
+	var got [][]string
+	for _, g := range groups {
+		var paths []string
+		for _, m := range g.Members {
+			paths = append(paths, m.Path)
+		}
+		got = append(got, paths)
+		if g.Score < 0.9 || g.Score > 1+1e-9 {
+			t.Errorf("group %v has score %.2f", paths, g.Score)
+		}
+	}
+	want := [][]string{
+		{"ch2-lq.cbz", "ch2.cbz"},
+		{"x/ch1.cbz", "y/ch1-hq.cbz", "z/ch1.zip"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(groups) == 2 && groups[0].Score < groups[1].Score {
+		t.Error("groups aren't sorted by score")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dupes
+
+import "github.com/salviati/gomics/imgdiff"
+
+// Page is a page that repeats an earlier one, such as a second copy
+// of the cover or of a credits page.
+type Page struct {
+	Page     int
+	Original int
+	Distance float64
+}
+
+// Pages returns the pages whose hash is within maxDistance of an
+// earlier page, in order. Each is matched to the closest original,
+// never to another repeat, so that a run of slowly changing pages
+// doesn't chain into one.
+func Pages(hashes []imgdiff.Hash, h imgdiff.Hasher, maxDistance float64) []Page {
+	var (
+		originals []int
+		repeats   []Page
+	)
+	for i, hash := range hashes {
+		best := Page{Page: i, Original: -1, Distance: maxDistance}
+		for _, j := range originals {
+			if d := h.Distance(hashes[j], hash); d <= best.Distance && (best.Original < 0 || d < best.Distance) {
+				best.Original, best.Distance = j, d
+			}
+		}
+		if best.Original < 0 {
+			originals = append(originals, i)
+		} else {
+			repeats = append(repeats, best)
+		}
+	}
+	return repeats
+}
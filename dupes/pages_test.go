@@ -0,0 +1,46 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dupes
+
+import (
+	"github.com/salviati/gomics/imgdiff"
+	"reflect"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	h := imgdiff.Difference
+	hashes := []imgdiff.Hash{
+		0x00ff00ff00ff00ff, // cover
+		0x0f0f0f0f0f0f0f0f,
+		0x00ff00ff00ff00fe, // the cover again, one bit off
+		0x3333333333333333,
+		0x0f0f0f0f0f0f0f0e, // page 1, one bit off
+		0x0f0f0f0f0f0f0f0c, // two bits off page 1, but one off page 4
+	}
+	want := []Page{
+		{Page: 2, Original: 0, Distance: 1.0 / 64},
+		{Page: 4, Original: 1, Distance: 1.0 / 64},
+		{Page: 5, Original: 1, Distance: 2.0 / 64},
+	}
+	if got := Pages(hashes, h, 2.0/64); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pages = %v, want %v", got, want)
+	}
+
+	if got := Pages(hashes, h, 0); got != nil {
+		t.Errorf("Pages with no tolerance = %v, want none", got)
+	}
+}
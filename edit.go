@@ -0,0 +1,419 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/cbz"
+	"github.com/salviati/gomics/library"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Columns of the page editor.
+const (
+	editColumnThumbnail = iota
+	editColumnName
+	editColumnPage
+)
+
+const editThumbnailSize = 128
+
+// BackupExt is added to the name of an archive to name its backup,
+// made before it's rewritten.
+const BackupExt = ".bak"
+
+// pageEditor holds the pages of the archive being edited. Rows refer
+// to pages by their index in pages, which doesn't change while
+// editing; the order of the rows is the order of the pages.
+type pageEditor struct {
+	ar    archive.Archive // opened for the editor alone
+	pages []cbz.Page
+	gen   int
+	stop  chan struct{} // closed when gen changes
+	store *gtk.ListStore
+	mem   *budget.Handle // of the thumbnails
+}
+
+func (e *pageEditor) reset() (int, chan struct{}) {
+	if e.stop != nil {
+		close(e.stop)
+	}
+	e.gen++
+	e.stop = make(chan struct{})
+	if e.ar != nil {
+		e.ar.Close()
+		e.ar = nil
+	}
+	e.pages = nil
+	e.mem.Release()
+	e.mem = nil
+	return e.gen, e.stop
+}
+
+func (gui *GUI) initEditDialog() {
+	gui.EditDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	gui.EditDialog.AddButton("_Save", gtk.RESPONSE_ACCEPT)
+	gui.EditDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	gui.EditInsertDialog.AddButton("_Insert", gtk.RESPONSE_ACCEPT)
+	gui.EditInsertDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+
+	store, err := gtk.ListStoreNew(gdk.PixbufGetType(), glib.TYPE_STRING, glib.TYPE_INT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.Edit.store = store
+	gui.EditIconView.SetModel(store)
+	gui.EditIconView.SetPixbufColumn(editColumnThumbnail)
+	gui.EditIconView.SetTextColumn(editColumnName)
+
+	gui.EditDeleteButton.Connect("clicked", gui.deleteEditedPages)
+	gui.EditInsertButton.Connect("clicked", gui.insertEditedPages)
+}
+
+// RunEditDialog lets the pages of the current zip archive be
+// reordered by dragging them, deleted, or added from image files.
+// Saving writes a new archive in place of the old one, with the pages
+// renamed so that they sort in order, and keeps the old one as a
+// backup.
+func (gui *GUI) RunEditDialog() {
+	if !gui.Loaded() {
+		return
+	}
+	path := gui.State.ArchivePath
+	if _, ok := gui.State.Archive.(*archive.Zip); !ok || archive.IsRemote(path) {
+		gui.ShowError("Only local zip archives can be edited")
+		return
+	}
+
+	gen, stop := gui.Edit.reset()
+	defer gui.Edit.reset()
+	ar, err := archive.NewArchive(path)
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+	gui.Edit.ar = ar
+
+	store := gui.Edit.store
+	store.Clear()
+	for i := 0; i < ar.Len(); i++ {
+		name, _ := ar.Name(i)
+		gui.addEditedPage(nil, cbz.Page{Archive: ar, Index: i}, filepath.Base(name), nil)
+	}
+	gui.updateEditStatus()
+	gui.loadEditThumbnails(gen, stop, path)
+
+	for {
+		if gtk.ResponseType(gui.EditDialog.Run()) != gtk.RESPONSE_ACCEPT {
+			break
+		}
+		if err := gui.saveEditedPages(path); err != nil {
+			gui.ShowError(err.Error())
+			continue
+		}
+		gui.EditDialog.Hide()
+
+		pos := gui.State.ArchivePos
+		gui.LoadArchive(path)
+		gui.SetPage(pos)
+		gui.SetStatus("Saved " + filepath.Base(path) + ", the original is kept as " + filepath.Base(path+BackupExt))
+		return
+	}
+	gui.EditDialog.Hide()
+}
+
+// addEditedPage adds a row for page after the row at sibling, or at the
+// end if sibling is nil, and returns the new row.
+func (gui *GUI) addEditedPage(sibling *gtk.TreeIter, page cbz.Page, name string, thumbnail *gdk.Pixbuf) *gtk.TreeIter {
+	store := gui.Edit.store
+	var iter *gtk.TreeIter
+	if sibling == nil {
+		iter = store.Append()
+	} else {
+		iter = store.InsertAfter(sibling)
+	}
+	store.Set(iter, []int{editColumnName, editColumnPage}, []interface{}{name, len(gui.Edit.pages)})
+	if thumbnail != nil {
+		store.SetValue(iter, editColumnThumbnail, thumbnail)
+		gui.holdEditThumbnail(thumbnail)
+	}
+	gui.Edit.pages = append(gui.Edit.pages, page)
+	return iter
+}
+
+// editedPages returns the pages in the order of the rows.
+func (gui *GUI) editedPages() cbz.PageList {
+	var pages cbz.PageList
+	store := gui.Edit.store
+	iter, ok := store.GetIterFirst()
+	for ok {
+		if v, err := store.GetValue(iter, editColumnPage); err == nil {
+			if i, err := v.GoValue(); err == nil {
+				pages = append(pages, gui.Edit.pages[i.(int)])
+			}
+		}
+		ok = store.IterNext(iter)
+	}
+	return pages
+}
+
+// selectedEditRows returns the selected rows, in order.
+func (gui *GUI) selectedEditRows() []*gtk.TreeIter {
+	var iters []*gtk.TreeIter
+	gui.EditIconView.GetSelectedItems().Foreach(func(item interface{}) {
+		if iter, err := gui.Edit.store.GetIter(item.(*gtk.TreePath)); err == nil {
+			iters = append(iters, iter)
+		}
+	})
+	return iters
+}
+
+func (gui *GUI) updateEditStatus() {
+	n := gui.Edit.store.IterNChildren(nil)
+	gui.EditStatusLabel.SetText(fmt.Sprintf("%d pages. Drag pages to move them.", n))
+}
+
+func (gui *GUI) deleteEditedPages() {
+	for _, iter := range gui.selectedEditRows() {
+		gui.Edit.store.Remove(iter)
+	}
+	gui.updateEditStatus()
+}
+
+// insertEditedPages adds image files after the selected pages, or at
+// the end.
+func (gui *GUI) insertEditedPages() {
+	res := gtk.ResponseType(gui.EditInsertDialog.Run())
+	gui.EditInsertDialog.Hide()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	paths, err := gui.EditInsertDialog.GetFilenames()
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+
+	var after *gtk.TreeIter
+	if rows := gui.selectedEditRows(); len(rows) > 0 {
+		after = rows[len(rows)-1]
+	}
+	for _, path := range paths {
+		if !archive.ExtensionMatch(path, archive.ImageExtensions) {
+			gui.ShowError(filepath.Base(path) + " isn't an image gomics can read")
+			continue
+		}
+		thumbnail, err := gui.fileThumbnail(path)
+		if err != nil {
+			gui.ShowError(err.Error())
+			continue
+		}
+		after = gui.addEditedPage(after, cbz.Page{Path: path}, filepath.Base(path), thumbnail)
+	}
+	gui.updateEditStatus()
+}
+
+// fileThumbnail loads an image from disk, with the same decoders as
+// pages, and scales it down to a thumbnail.
+func (gui *GUI) fileThumbnail(path string) (*gdk.Pixbuf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pixbuf, err := archive.LoadPixbuf(f, gui.Config.EmbeddedOrientation)
+	if err != nil {
+		return nil, err
+	}
+	defer gui.Memory.Discard(pixbufBytes(pixbuf))
+	w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), editThumbnailSize, editThumbnailSize)
+	return pixbuf.ScaleSimple(w, h, interpolations[gui.Config.Interpolation])
+}
+
+// holdEditThumbnail accounts for a thumbnail shown in the editor,
+// until it's closed.
+func (gui *GUI) holdEditThumbnail(thumbnail *gdk.Pixbuf) {
+	if gui.Edit.mem == nil {
+		gui.Edit.mem = gui.Memory.Hold(budget.Thumbnails, pixbufBytes(thumbnail), nil)
+		return
+	}
+	gui.Edit.mem.Grow(pixbufBytes(thumbnail))
+}
+
+// loadEditThumbnails loads the thumbnails of the pages of the archive
+// in the background.
+func (gui *GUI) loadEditThumbnails(gen int, stop chan struct{}, path string) {
+	orientation := gui.Config.EmbeddedOrientation
+	interp := interpolations[gui.Config.Interpolation]
+	mem := gui.Memory
+
+	go func() {
+		ar, err := archive.NewArchive(path)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ar.Close()
+
+		for i := 0; i < ar.Len(); i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			pixbuf, err := ar.Load(i, orientation)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), editThumbnailSize, editThumbnailSize)
+			thumbnail, err := pixbuf.ScaleSimple(w, h, interp)
+			mem.Discard(pixbufBytes(pixbuf))
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			// Pages of the archive come first in pages.
+			i := i
+			glib.IdleAdd(func() {
+				if gen == gui.Edit.gen {
+					gui.setEditThumbnail(i, thumbnail)
+				}
+			})
+		}
+	}()
+}
+
+func (gui *GUI) setEditThumbnail(page int, thumbnail *gdk.Pixbuf) {
+	store := gui.Edit.store
+	iter, ok := store.GetIterFirst()
+	for ok {
+		if v, err := store.GetValue(iter, editColumnPage); err == nil {
+			if p, err := v.GoValue(); err == nil && p.(int) == page {
+				store.SetValue(iter, editColumnThumbnail, thumbnail)
+				gui.holdEditThumbnail(thumbnail)
+				return
+			}
+		}
+		ok = store.IterNext(iter)
+	}
+}
+
+// saveEditedPages writes the edited pages in place of the archive at
+// path, which is kept as a backup. The new archive is written in full
+// before being moved in place, so path always holds a whole archive.
+// Files of the archive other than pages and ComicInfo.xml are carried
+// over as they are, and bookmarks and reading progress follow it to
+// its new fingerprint.
+func (gui *GUI) saveEditedPages(path string) error {
+	pages := gui.editedPages()
+	if len(pages) == 0 {
+		return errors.New("An archive needs at least one page")
+	}
+
+	fp, err := library.Fingerprint(path)
+	if err != nil {
+		return err
+	}
+	info, err := archive.ComicInfoXML(path)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tmp, err := writeCBZ(path, pages, info, zipExtras(zr.File), cbz.Options{}, nil)
+	if err != nil {
+		return err
+	}
+	if err := backupFile(path, path+BackupExt); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	newFP, err := library.Fingerprint(path)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	if gui.State.ArchivePath == path {
+		gui.recordProgress()
+	}
+	gui.rekeyArchive(path, fp, path, newFP)
+	return nil
+}
+
+// zipExtras returns the files among those of a zip archive that are
+// neither pages nor ComicInfo.xml.
+func zipExtras(files []*zip.File) []*zip.File {
+	var extras []*zip.File
+	for _, f := range files {
+		if f.FileInfo().IsDir() || archive.ExtensionMatch(f.Name, archive.ImageExtensions) ||
+			strings.EqualFold(f.Name, cbz.ComicInfoName) {
+			continue
+		}
+		extras = append(extras, f)
+	}
+	return extras
+}
+
+// backupFile makes backup a copy of path, replacing any older backup.
+// It's a hard link when the file system allows.
+func backupFile(path, backup string) error {
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backup)
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/filename"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// What can be exported.
+const (
+	exportPage   = "page"
+	exportSpread = "spread"
+	exportRange  = "range"
+)
+
+const exportResponseCopy gtk.ResponseType = 1
+
+// exportFormats are the formats pages can be exported in, by their
+// gdk-pixbuf names.
+var exportFormats = []struct {
+	name, label, ext string
+}{
+	{"png", "PNG", ".png"},
+	{"jpeg", "JPEG", ".jpg"},
+	{"webp", "WebP", ".webp"},
+}
+
+func exportExt(format string) string {
+	for _, f := range exportFormats {
+		if f.name == format {
+			return f.ext
+		}
+	}
+	return "." + format
+}
+
+// exportOptions returns the gdk-pixbuf options of a format: the
+// compression level of PNGs, and the quality of the others.
+func (gui *GUI) exportOptions(format string) map[string]string {
+	if format == "png" {
+		return map[string]string{"compression": strconv.Itoa(gui.Config.ExportCompression)}
+	}
+	return map[string]string{"quality": strconv.Itoa(gui.Config.ExportQuality)}
+}
+
+func (gui *GUI) exportDir() string {
+	if gui.Config.ExportDir != "" {
+		return gui.Config.ExportDir
+	}
+	return filepath.Join(gui.State.ConfigPath, ImageDir)
+}
+
+// flipped returns pixbuf flipped the way pages are shown.
+func (gui *GUI) flipped(pixbuf *gdk.Pixbuf) (p *gdk.Pixbuf, err error) {
+	p = pixbuf
+	if gui.Config.HFlip {
+		if p, err = p.Flip(true); err != nil {
+			return nil, err
+		}
+	}
+	if gui.Config.VFlip {
+		if p, err = p.Flip(false); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// spread returns the current pages as they are shown, side by side in
+// double page mode, at their full size.
+func (gui *GUI) spread() (*gdk.Pixbuf, error) {
+	if !gui.Config.DoublePage || gui.forceSinglePage() {
+		return gui.flipped(gui.State.PixbufL)
+	}
+
+	left, right := gui.State.PixbufL, gui.State.PixbufR
+	if gui.Config.MangaMode {
+		left, right = right, left
+	}
+	left, err := gui.flipped(left)
+	if err != nil {
+		return nil, err
+	}
+	right, err = gui.flipped(right)
+	if err != nil {
+		return nil, err
+	}
+
+	lw, lh := left.GetWidth(), left.GetHeight()
+	rw, rh := right.GetWidth(), right.GetHeight()
+	h := max(lh, rh)
+	p, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, false, 8, lw+rw, h)
+	if err != nil {
+		return nil, err
+	}
+	p.Fill(0xffffffff)
+	left.CopyArea(0, 0, lw, lh, p, 0, (h-lh)/2)
+	right.CopyArea(0, 0, rw, rh, p, lw, (h-rh)/2)
+	return p, nil
+}
+
+// pageFields returns the fields of the export template for page i of
+// the archive at path, and the page after it for spreads.
+func pageFields(path string, ar archive.Archive, i int, spread bool) filename.Fields {
+	base := filepath.Base(path)
+	f := filename.Fields{
+		Archive: strings.TrimSuffix(base, filepath.Ext(base)),
+		Page:    i + 1,
+		Pages:   ar.Len(),
+	}
+	if name, err := ar.Name(i); err == nil {
+		name = filepath.Base(name)
+		f.Name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if spread {
+		f.Last = i + 2
+	}
+	return f
+}
+
+func (gui *GUI) initExportDialog() {
+	gui.ExportDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	gui.ExportDialog.AddButton("Copy to C_lipboard", exportResponseCopy)
+	gui.ExportDialog.AddButton("_Export", gtk.RESPONSE_ACCEPT)
+	gui.ExportDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	for _, f := range exportFormats {
+		gui.ExportFormatComboBoxText.Append(f.name, f.label)
+	}
+	gui.ExportFormatComboBoxText.Connect("changed", gui.updateExportQuality)
+
+	gui.ExportTemplateEntry.SetTooltipText("Fields: " + filename.FieldNames)
+	gui.ExportRangeEntry.Connect("changed", func() {
+		gui.ExportRangeRadioButton.SetActive(true)
+	})
+}
+
+// updateExportQuality shows the compression level for PNG, and the
+// quality for the other formats.
+func (gui *GUI) updateExportQuality() {
+	if gui.ExportFormatComboBoxText.GetActiveID() == "png" {
+		gui.ExportQualityLabel.SetText("Compression:")
+		gui.ExportQualitySpinButton.SetRange(0, 9)
+		gui.ExportQualitySpinButton.SetIncrements(1, 3)
+		gui.ExportQualitySpinButton.SetValue(float64(gui.Config.ExportCompression))
+	} else {
+		gui.ExportQualityLabel.SetText("Quality:")
+		gui.ExportQualitySpinButton.SetRange(1, 100)
+		gui.ExportQualitySpinButton.SetIncrements(5, 10)
+		gui.ExportQualitySpinButton.SetValue(float64(gui.Config.ExportQuality))
+	}
+}
+
+// RunExportDialog saves the current page, the spread or a range of
+// pages to files, or copies the page or spread to the clipboard.
+func (gui *GUI) RunExportDialog() {
+	if !gui.Loaded() || !gui.pixbufLoaded() {
+		return
+	}
+
+	// Typing a range picks it, so the entry is filled in first.
+	gui.ExportRangeEntry.SetText(strconv.Itoa(gui.State.ArchivePos+1) + "-")
+	switch gui.Config.ExportWhat {
+	case exportSpread:
+		gui.ExportSpreadRadioButton.SetActive(true)
+	case exportRange:
+		gui.ExportRangeRadioButton.SetActive(true)
+	default:
+		gui.ExportPageRadioButton.SetActive(true)
+	}
+	gui.ExportFormatComboBoxText.SetActiveID(gui.Config.ExportFormat)
+	gui.updateExportQuality()
+	gui.ExportFolderChooserButton.SetCurrentFolder(gui.exportDir())
+	gui.ExportTemplateEntry.SetText(gui.Config.ExportTemplate)
+
+	for {
+		res := gtk.ResponseType(gui.ExportDialog.Run())
+		if res != gtk.RESPONSE_ACCEPT && res != exportResponseCopy {
+			gui.ExportDialog.Hide()
+			return
+		}
+		if err := gui.readExportDialog(); err != nil {
+			gui.ShowError(err.Error())
+			continue
+		}
+		gui.ExportDialog.Hide()
+
+		if res == exportResponseCopy {
+			gui.CopyImage()
+			return
+		}
+		if err := gui.export(); err != nil {
+			gui.ShowError(err.Error())
+		}
+		return
+	}
+}
+
+func (gui *GUI) readExportDialog() error {
+	switch {
+	case gui.ExportSpreadRadioButton.GetActive():
+		gui.Config.ExportWhat = exportSpread
+	case gui.ExportRangeRadioButton.GetActive():
+		gui.Config.ExportWhat = exportRange
+	default:
+		gui.Config.ExportWhat = exportPage
+	}
+
+	gui.Config.ExportFormat = gui.ExportFormatComboBoxText.GetActiveID()
+	if gui.Config.ExportFormat == "png" {
+		gui.Config.ExportCompression = gui.ExportQualitySpinButton.GetValueAsInt()
+	} else {
+		gui.Config.ExportQuality = gui.ExportQualitySpinButton.GetValueAsInt()
+	}
+	if dir := gui.ExportFolderChooserButton.GetFilename(); dir != "" {
+		gui.Config.ExportDir = dir
+	}
+
+	tmpl, err := gui.ExportTemplateEntry.GetText()
+	if err != nil {
+		return err
+	}
+	if _, err := filename.Expand(tmpl, pageFields(gui.State.ArchivePath, gui.State.Archive, gui.State.ArchivePos, false)); err != nil {
+		return err
+	}
+	gui.Config.ExportTemplate = tmpl
+	return nil
+}
+
+// CopyImage copies the pages as they are shown to the clipboard.
+func (gui *GUI) CopyImage() {
+	if !gui.pixbufLoaded() {
+		return
+	}
+	p, err := gui.spread()
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+	clipboard.SetImage(p)
+	gui.SetStatus("Copied to the clipboard")
+}
+
+// export saves what the export dialog was set to.
+func (gui *GUI) export() error {
+	dir, format := gui.exportDir(), gui.Config.ExportFormat
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var (
+		p      *gdk.Pixbuf
+		spread bool
+		err    error
+	)
+	switch gui.Config.ExportWhat {
+	case exportRange:
+		text, err := gui.ExportRangeEntry.GetText()
+		if err != nil {
+			return err
+		}
+		first, last, err := parsePages(text, gui.State.Archive.Len())
+		if err != nil {
+			return err
+		}
+		gui.exportRange(first, last)
+		return nil
+	case exportSpread:
+		spread = gui.Config.DoublePage && !gui.forceSinglePage()
+		p, err = gui.spread()
+	default:
+		p = gui.State.PixbufL
+	}
+	if err != nil {
+		return err
+	}
+
+	name, err := filename.Expand(gui.Config.ExportTemplate, pageFields(gui.State.ArchivePath, gui.State.Archive, gui.State.ArchivePos, spread))
+	if err != nil {
+		return err
+	}
+	name += exportExt(format)
+	if err := savePixbuf(p, filepath.Join(dir, name), format, gui.exportOptions(format)); err != nil {
+		return err
+	}
+	gui.SetStatus("Saved to " + name)
+	return nil
+}
+
+// exportRange saves pages first to last in the background. The archive
+// is opened anew so as not to get in the way of the viewer.
+func (gui *GUI) exportRange(first, last int) {
+	dir, format := gui.exportDir(), gui.Config.ExportFormat
+	tmpl, options := gui.Config.ExportTemplate, gui.exportOptions(format)
+	path, orientation := gui.State.ArchivePath, gui.Config.EmbeddedOrientation
+	status := func(msg string) {
+		glib.IdleAdd(func() { gui.SetStatus(msg) })
+	}
+
+	mem := gui.Memory
+	go func() {
+		ar, err := archive.NewArchive(path)
+		if err != nil {
+			glib.IdleAdd(func() { gui.ShowError(err.Error()) })
+			return
+		}
+		defer ar.Close()
+
+		failed := 0
+		for i := first; i <= last; i++ {
+			err := func() error {
+				name, err := filename.Expand(tmpl, pageFields(path, ar, i, false))
+				if err != nil {
+					return err
+				}
+				p, err := ar.Load(i, orientation)
+				if err != nil {
+					return err
+				}
+				defer mem.Discard(pixbufBytes(p))
+				return savePixbuf(p, filepath.Join(dir, name+exportExt(format)), format, options)
+			}()
+			if err != nil {
+				failed++
+				status(fmt.Sprintf("Page %d: %v", i+1, err))
+				continue
+			}
+			status(fmt.Sprintf("Exported page %d of %d-%d", i+1, first+1, last+1))
+		}
+
+		n := last - first + 1
+		if failed > 0 {
+			status(fmt.Sprintf("Exported %d of %d pages to %s", n-failed, n, dir))
+		} else {
+			status(fmt.Sprintf("Exported %d pages to %s", n, dir))
+		}
+	}()
+}
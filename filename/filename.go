@@ -0,0 +1,90 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package filename expands the templates that exported pages are named
+// by, such as "{archive}-{page}".
+package filename
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fields are what a template can refer to.
+type Fields struct {
+	Archive string // the archive's name, without extension
+	Name    string // the page's name in the archive, without extension
+	Page    int    // numbered from 1
+	Last    int    // the last page of a spread, or 0
+	Pages   int    // in the archive
+}
+
+// FieldNames lists what can go between braces, for help texts.
+const FieldNames = "{archive}, {name}, {page} and {pages}"
+
+// Expand replaces the fields between braces in tmpl. Page numbers are
+// padded to the width of the page count, so that names sort in order,
+// and a spread is numbered like 006-007. Slashes in the values are
+// replaced so that the result is always a single file name.
+func Expand(tmpl string, f Fields) (string, error) {
+	digits := len(fmt.Sprint(f.Pages))
+	page := fmt.Sprintf("%0*d", digits, f.Page)
+	if f.Last > f.Page {
+		page += fmt.Sprintf("-%0*d", digits, f.Last)
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			b.WriteString(tmpl)
+			break
+		}
+		b.WriteString(tmpl[:i])
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return "", errors.New("unclosed { in " + tmpl)
+		}
+		switch field := tmpl[i+1 : i+j]; field {
+		case "archive":
+			b.WriteString(clean(f.Archive))
+		case "name":
+			b.WriteString(clean(f.Name))
+		case "page":
+			b.WriteString(page)
+		case "pages":
+			b.WriteString(fmt.Sprint(f.Pages))
+		default:
+			return "", fmt.Errorf("unknown field {%s}, use %s", field, FieldNames)
+		}
+		tmpl = tmpl[i+j+1:]
+	}
+
+	name := clean(b.String())
+	if name == "" || name == "." || name == ".." {
+		return "", errors.New("the template gives an empty name")
+	}
+	return name, nil
+}
+
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, s)
+}
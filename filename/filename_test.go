@@ -0,0 +1,47 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package filename
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	f := Fields{Archive: "Vol 1", Name: "scans/p7", Page: 7, Pages: 120}
+	spread := f
+	spread.Last = 8
+
+	for _, c := range []struct {
+		tmpl string
+		f    Fields
+		want string
+	}{
+		{"{archive}-{page}", f, "Vol 1-007"},
+		{"{archive}-{page}", spread, "Vol 1-007-008"},
+		{"{name} of {pages}", f, "scans_p7 of 120"},
+		{"page", f, "page"},
+		{"a/{page}", Fields{Page: 3, Pages: 9}, "a_3"},
+	} {
+		got, err := Expand(c.tmpl, c.f)
+		if err != nil || got != c.want {
+			t.Errorf("Expand(%q) = %q, %v, want %q", c.tmpl, got, err, c.want)
+		}
+	}
+
+	for _, tmpl := range []string{"{archive", "{title}", "", "{name}"} {
+		if got, err := Expand(tmpl, Fields{Page: 1, Pages: 1}); err == nil {
+			t.Errorf("Expand(%q) = %q, want an error", tmpl, got)
+		}
+	}
+}
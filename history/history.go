@@ -0,0 +1,75 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package history keeps browser-style back and forward lists of
+// places visited in the viewer.
+package history
+
+// MaxEntries is how far back the history goes.
+const MaxEntries = 100
+
+// Entry is a place in an archive.
+type Entry struct {
+	Path string
+	Page int // 0-based
+}
+
+type History struct {
+	back, forward []Entry
+}
+
+// Push records e as the place a jump was made from. The forward list
+// is forgotten, as in a browser.
+func (h *History) Push(e Entry) {
+	h.forward = h.forward[:0]
+	if n := len(h.back); n > 0 && h.back[n-1] == e {
+		return
+	}
+	h.back = append(h.back, e)
+	if len(h.back) > MaxEntries {
+		h.back = append(h.back[:0], h.back[len(h.back)-MaxEntries:]...)
+	}
+}
+
+// Back returns the place to go back to from cur, and remembers cur so
+// that Forward can return to it. Entries equal to cur are skipped.
+func (h *History) Back(cur Entry) (Entry, bool) {
+	return move(&h.back, &h.forward, cur)
+}
+
+// Forward undoes Back.
+func (h *History) Forward(cur Entry) (Entry, bool) {
+	return move(&h.forward, &h.back, cur)
+}
+
+func (h *History) CanBack() bool {
+	return len(h.back) > 0
+}
+
+func (h *History) CanForward() bool {
+	return len(h.forward) > 0
+}
+
+func move(from, to *[]Entry, cur Entry) (Entry, bool) {
+	for len(*from) > 0 {
+		e := (*from)[len(*from)-1]
+		*from = (*from)[:len(*from)-1]
+		if e != cur {
+			*to = append(*to, cur)
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
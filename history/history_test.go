@@ -0,0 +1,86 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	var h History
+	a, b, c := Entry{"a.cbz", 0}, Entry{"a.cbz", 10}, Entry{"b.cbz", 3}
+
+	if _, ok := h.Back(a); ok {
+		t.Fatal("Back on an empty history")
+	}
+
+	// a -> b -> c
+	h.Push(a)
+	h.Push(b)
+
+	step := func(f func(Entry) (Entry, bool), cur, want Entry) {
+		t.Helper()
+		got, ok := f(cur)
+		if !ok || got != want {
+			t.Fatalf("from %v got %v, %v; want %v", cur, got, ok, want)
+		}
+	}
+	step(h.Back, c, b)
+	step(h.Back, b, a)
+	if h.CanBack() {
+		t.Error("CanBack at the start")
+	}
+	step(h.Forward, a, b)
+	step(h.Forward, b, c)
+	if h.CanForward() {
+		t.Error("CanForward at the end")
+	}
+
+	// A jump after going back drops the forward list.
+	step(h.Back, c, b)
+	h.Push(b)
+	if h.CanForward() {
+		t.Error("Push kept the forward list")
+	}
+}
+
+func TestHistoryDuplicates(t *testing.T) {
+	var h History
+	a, b := Entry{"a.cbz", 0}, Entry{"a.cbz", 10}
+
+	h.Push(a)
+	h.Push(a)
+	h.Push(b)
+	if len(h.back) != 2 {
+		t.Errorf("got %d entries, want 2", len(h.back))
+	}
+
+	// A jump that went nowhere leaves the current page on the list.
+	if e, ok := h.Back(b); !ok || e != a {
+		t.Errorf("Back skipped to %v, %v; want %v", e, ok, a)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	var h History
+	for i := 0; i < MaxEntries+10; i++ {
+		h.Push(Entry{"a.cbz", i})
+	}
+	if len(h.back) != MaxEntries {
+		t.Fatalf("got %d entries, want %d", len(h.back), MaxEntries)
+	}
+	if h.back[0].Page != 10 {
+		t.Errorf("oldest entry is page %d, want 10", h.back[0].Page)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package httpfile provides random access to files served over HTTP.
+//
+// Files are read with HTTP range requests, so that reading the central
+// directory of a zip file and a few of its entries doesn't download
+// the whole file. If the server doesn't support ranges, the file is
+// downloaded to a temporary file instead.
+package httpfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClosed = errors.New("httpfile: file already closed")
+)
+
+const (
+	// BlockSize is the unit in which ranges are requested and cached.
+	BlockSize = 64 * 1024
+
+	// MaxBlocks is the number of blocks cached per file.
+	MaxBlocks = 256
+
+	// maxReadahead is the largest number of blocks requested at once
+	// while reading sequentially.
+	maxReadahead = 16
+
+	// blockTimeout bounds the time a range of blocks takes to arrive,
+	// body included.
+	blockTimeout = time.Minute
+)
+
+// DefaultClient is used when Open is given no client. Files are read on
+// the GUI thread, so its timeouts keep a stalled server from hanging it
+// for good. Whole downloads aren't bounded past the response headers,
+// as large files on slow links take a while.
+var DefaultClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// ReaderAt is a remote file, either accessed with range requests or
+// downloaded to a temporary file.
+type ReaderAt interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// Open opens the file at the given http or https URL. User info in the
+// URL is sent as basic authentication. A nil client means
+// DefaultClient.
+func Open(rawurl string, client *http.Client) (ReaderAt, error) {
+	if client == nil {
+		client = DefaultClient
+	}
+
+	f := &File{client: client, blocks: make(map[int64]*block)}
+	if err := f.setURL(rawurl); err != nil {
+		return nil, err
+	}
+
+	// Ask for the first block; the response tells us the size of the
+	// file and whether ranges are supported at all.
+	resp, err := f.get(0, BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return download(resp.Body)
+	}
+
+	size, err := contentRangeSize(resp.Header.Get("Content-Range"))
+	if err != nil {
+		// We can't do random access without knowing the size, and
+		// the body is only the first block, so ask for the whole file.
+		resp.Body.Close()
+		if resp, err = f.do(f.req.Clone(f.req.Context())); err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("httpfile: GET %s: %s", f.req.URL, resp.Status)
+		}
+		return download(resp.Body)
+	}
+	f.size = size
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.store(0, data)
+	return f, nil
+}
+
+// NewRequest returns a GET request for rawurl, with the user info of
+// the URL moved to a basic authentication header.
+func NewRequest(rawurl string) (*http.Request, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("httpfile: unsupported URL scheme %q", u.Scheme)
+	}
+
+	user := u.User
+	u.User = nil
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	return req, nil
+}
+
+// File is a remote file accessed with range requests. Recently read
+// blocks are cached.
+type File struct {
+	client *http.Client
+	req    *http.Request
+	size   int64
+
+	mu     sync.Mutex
+	blocks map[int64]*block
+	tick   int64 // for least-recently-used eviction
+	last   int64 // last block fetched
+	run    int   // number of sequential fetches
+	closed bool
+}
+
+type block struct {
+	data []byte
+	used int64
+}
+
+func (f *File) setURL(rawurl string) error {
+	req, err := NewRequest(rawurl)
+	if err != nil {
+		return err
+	}
+	f.req = req
+	return nil
+}
+
+func (f *File) get(off, n int64) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(f.req.Context(), blockTimeout)
+	req := f.req.Clone(ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	resp, err := f.do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of a request once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (f *File) do(req *http.Request) (*http.Response, error) {
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("httpfile: GET %s: %s", f.req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// contentRangeSize parses the total size out of "bytes a-b/size".
+func contentRangeSize(s string) (int64, error) {
+	i := strings.LastIndexByte(s, '/')
+	if !strings.HasPrefix(s, "bytes ") || i < 0 {
+		return 0, fmt.Errorf("httpfile: bad Content-Range %q", s)
+	}
+	return strconv.ParseInt(s[i+1:], 10, 64)
+}
+
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	f.closed = true
+	f.blocks = nil
+	return nil
+}
+
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("httpfile: negative offset")
+	}
+
+	for len(p) > 0 {
+		if off >= f.size {
+			return n, io.EOF
+		}
+
+		data, err := f.block(off / BlockSize)
+		if err != nil {
+			return n, err
+		}
+
+		m := copy(p, data[off%BlockSize:])
+		n += m
+		off += int64(m)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// block returns the ith block, fetching it if needed.
+func (f *File) block(i int64) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+
+	f.tick++
+	if b, ok := f.blocks[i]; ok {
+		b.used = f.tick
+		return b.data, nil
+	}
+
+	// Zip entries are read front to back in small pieces, so fetch
+	// more at once the longer a sequential read goes on.
+	if i != f.last+1 {
+		f.run = 0
+	} else if int64(1)<<uint(f.run) < maxReadahead {
+		f.run++
+	}
+	count := int64(1) << uint(f.run)
+	if count > maxReadahead {
+		count = maxReadahead
+	}
+	for j := int64(1); j < count; j++ {
+		if _, ok := f.blocks[i+j]; ok || (i+j)*BlockSize >= f.size {
+			count = j
+			break
+		}
+	}
+
+	off := i * BlockSize
+	n := count * BlockSize
+	if off+n > f.size {
+		n = f.size - off
+	}
+
+	resp, err := f.get(off, n)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("httpfile: GET %s: server stopped honoring ranges", f.req.URL)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+
+	for j := int64(0); j < count; j++ {
+		end := (j + 1) * BlockSize
+		if end > n {
+			end = n
+		}
+		f.store(i+j, data[j*BlockSize:end])
+	}
+	f.last = i + count - 1
+
+	if n > BlockSize {
+		n = BlockSize
+	}
+	return data[:n], nil
+}
+
+// store caches a block, evicting the least recently used one if the
+// cache is full. f.mu must be held, unless f isn't shared yet.
+func (f *File) store(i int64, data []byte) {
+	if len(f.blocks) >= MaxBlocks {
+		var lru int64 = -1
+		for j, b := range f.blocks {
+			if lru < 0 || b.used < f.blocks[lru].used {
+				lru = j
+			}
+		}
+		delete(f.blocks, lru)
+	}
+	f.blocks[i] = &block{data: data, used: f.tick}
+}
+
+// tempFile is a downloaded copy of a file from a server that doesn't
+// support range requests.
+type tempFile struct {
+	*os.File
+	size int64
+}
+
+func download(r io.Reader) (ReaderAt, error) {
+	f, err := os.CreateTemp("", "gomics-")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &tempFile{File: f, size: size}, nil
+}
+
+func (t *tempFile) Size() int64 {
+	return t.size
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.File.Name())
+	return err
+}
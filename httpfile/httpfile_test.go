@@ -0,0 +1,234 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package httpfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testZip returns a zip file with a few large, incompressible entries.
+func testZip(t *testing.T) (data []byte, entries map[string][]byte) {
+	rnd := rand.New(rand.NewSource(1))
+	entries = make(map[string][]byte)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"01.jpg", "02.jpg", "03.jpg", "04.jpg"} {
+		content := make([]byte, 5*BlockSize/2)
+		rnd.Read(content)
+		entries[name] = content
+
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), entries
+}
+
+func serve(data []byte, ranges bool, requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "test.cbz", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func readEntry(t *testing.T, zr *zip.Reader, name string) []byte {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	t.Fatalf("no entry %s", name)
+	return nil
+}
+
+func TestRanges(t *testing.T) {
+	data, entries := testZip(t)
+	var requests int64
+	ts := serve(data, true, &requests)
+	defer ts.Close()
+
+	f, err := Open("http://user:secret@"+ts.Listener.Addr().String()+"/test.cbz", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := f.(*File); !ok {
+		t.Fatalf("got %T, want a range-backed *File", f)
+	}
+	if f.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", f.Size(), len(data))
+	}
+
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readEntry(t, zr, "03.jpg"); !bytes.Equal(got, entries["03.jpg"]) {
+		t.Error("03.jpg differs")
+	}
+
+	// Only the central directory and the entry itself should have
+	// been fetched, not the whole file.
+	n := atomic.LoadInt64(&requests)
+	if n > 6 {
+		t.Errorf("%d requests to read the directory and one entry", n)
+	}
+
+	// Cached blocks aren't fetched again.
+	readEntry(t, zr, "03.jpg")
+	if m := atomic.LoadInt64(&requests); m != n {
+		t.Errorf("re-reading a cached entry made %d more requests", m-n)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	data, entries := testZip(t)
+	var requests int64
+	ts := serve(data, false, &requests)
+	defer ts.Close()
+
+	f, err := Open("http://user:secret@"+ts.Listener.Addr().String()+"/test.cbz", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := f.(*tempFile); !ok {
+		t.Fatalf("got %T, want a downloaded *tempFile", f)
+	}
+
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readEntry(t, zr, "01.jpg"); !bytes.Equal(got, entries["01.jpg"]) {
+		t.Error("01.jpg differs")
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+}
+
+// TestSequential reads a file front to back, long enough that the
+// readahead would have overflowed if it kept doubling.
+func TestSequential(t *testing.T) {
+	data := make([]byte, 80*maxReadahead*BlockSize)
+	for i := range data {
+		data[i] = byte(i / BlockSize)
+	}
+	var requests int64
+	ts := serve(data, true, &requests)
+	defer ts.Close()
+
+	f, err := Open("http://user:secret@"+ts.Listener.Addr().String()+"/test.cbz", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	for off := int64(0); off < f.Size(); off += int64(len(buf)) {
+		n, err := f.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+			t.Fatalf("ReadAt(%d) differs", off)
+		}
+	}
+	if max := int64(len(data))/(maxReadahead*BlockSize) + 8; requests > max {
+		t.Errorf("%d requests, want at most %d", requests, max)
+	}
+}
+
+// TestUnknownSize checks that a ranged reply without the size of the
+// file isn't taken for the whole file.
+func TestUnknownSize(t *testing.T) {
+	data, entries := testZip(t)
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.Header.Get("Range") == "" {
+			w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-"+strconv.Itoa(BlockSize-1)+"/*")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[:BlockSize])
+	}))
+	defer ts.Close()
+
+	f, err := Open(ts.URL+"/test.cbz", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", f.Size(), len(data))
+	}
+
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readEntry(t, zr, "04.jpg"); !bytes.Equal(got, entries["04.jpg"]) {
+		t.Error("04.jpg differs")
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	var requests int64
+	ts := serve(nil, true, &requests)
+	defer ts.Close()
+
+	if _, err := Open(ts.URL+"/test.cbz", ts.Client()); err == nil {
+		t.Error("opened a file without credentials")
+	}
+}
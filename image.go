@@ -18,7 +18,6 @@ package main
 import (
 	"fmt"
 	"github.com/gotk3/gotk3/gdk"
-	"github.com/gotk3/gotk3/gtk"
 	"path/filepath"
 )
 
@@ -59,11 +58,11 @@ func (gui *GUI) StatusImage() {
 	if gui.Config.DoublePage && gui.forceSinglePage() == false {
 		leftPath, _ := s.Archive.Name(s.ArchivePos)
 		left := filepath.Base(leftPath)
-		rightPath, _ := s.Archive.Name(s.ArchivePos + 1)
+		rightPath, _ := s.Archive.Name(s.ArchivePosR)
 		right := filepath.Base(rightPath)
 
 		leftIndex := s.ArchivePos + 1
-		rightIndex := s.ArchivePos + 2
+		rightIndex := s.ArchivePosR + 1
 
 		leftw, lefth := s.PixbufL.GetWidth(), s.PixbufL.GetHeight()
 		rightw, righth := s.PixbufR.GetWidth(), s.PixbufR.GetHeight()
@@ -145,6 +144,9 @@ func (gui *GUI) scaledSize(scrw, scrh int) (scale float64) {
 		}
 	}
 	// original, others
+	if gui.State.Zoom > 0 {
+		return gui.State.Zoom
+	}
 	return 1
 }
 
@@ -168,59 +170,17 @@ func (gui *GUI) Blit() {
 	if gui.Config.DoublePage && gui.forceSinglePage() == false {
 		left := gui.State.PixbufL
 		right := gui.State.PixbufR
+		keyL, keyR := gui.pageKey(sideLeft), gui.pageKey(sideRight)
 
 		if gui.Config.MangaMode {
 			left, right = right, left
+			keyL, keyR = keyR, keyL
 		}
 
-		if err := gui.blit(gui.ImageL, left, gui.State.Scale); err != nil {
-			gui.ShowError(err.Error())
-			return
-		}
-
-		if err := gui.blit(gui.ImageR, right, gui.State.Scale); err != nil {
-			gui.ShowError(err.Error())
-			return
-		}
+		gui.blit(&gui.ViewL, left, keyL, gui.State.Scale)
+		gui.blit(&gui.ViewR, right, keyR, gui.State.Scale)
 	} else {
-		gui.ImageR.Clear()
-		if err := gui.blit(gui.ImageL, gui.State.PixbufL, gui.State.Scale); err != nil {
-			gui.ShowError(err.Error())
-			return
-		}
-	}
-
-	if gui.State.Scale != 1 || gui.Config.HFlip || gui.Config.VFlip {
-		gc()
-	}
-}
-
-func (gui *GUI) blit(image *gtk.Image, pixbuf *gdk.Pixbuf, scale float64) (err error) {
-	image.Clear()
-
-	if gui.Config.HFlip {
-		pixbuf, err = pixbuf.Flip(true)
-		if err != nil {
-			return err
-		}
-	}
-
-	if gui.Config.VFlip {
-		pixbuf, err = pixbuf.Flip(false)
-		if err != nil {
-			return err
-		}
+		gui.clearPage(&gui.ViewR)
+		gui.blit(&gui.ViewL, gui.State.PixbufL, gui.pageKey(sideLeft), gui.State.Scale)
 	}
-
-	if scale != 1 {
-		w, h := pixbuf.GetWidth(), pixbuf.GetHeight()
-		pixbuf, err = pixbuf.ScaleSimple(int(float64(w)*scale), int(float64(h)*scale), interpolations[gui.Config.Interpolation])
-		if err != nil {
-			return err
-		}
-	}
-
-	image.SetFromPixbuf(pixbuf)
-
-	return nil
 }
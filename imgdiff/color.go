@@ -0,0 +1,111 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package imgdiff
+
+import "image"
+
+const (
+	colorHues   = 12
+	colorGrays  = 4
+	colorLevels = 15 // per bin, in the 4 bits each gets
+
+	// Pixels with less saturation than this count as gray.
+	minSaturation = 0.2
+)
+
+// colorHistogram packs a histogram of 12 hues and 4 levels of gray
+// into 4 bits per bin. Unlike the other hashes it ignores the layout
+// of the image, and tells apart pictures that differ in colour only.
+type colorHistogram struct{}
+
+func (colorHistogram) Name() string { return "color" }
+
+func (colorHistogram) Hash(img image.Image) Hash {
+	var bins [colorHues + colorGrays]int
+	total := 0
+	eachPixel(img, func(_, _ int, r, g, b uint8) {
+		bins[colorBin(r, g, b)]++
+		total++
+	})
+	if total == 0 {
+		return 0
+	}
+
+	var hash Hash
+	for i, n := range bins {
+		level := (n*colorLevels + total/2) / total
+		hash |= Hash(level) << uint(4*i)
+	}
+	return hash
+}
+
+// Distance is half the L1 distance between the histograms, which is
+// the share of pixels that would have to change colour.
+func (colorHistogram) Distance(h1, h2 Hash) float64 {
+	d := 0
+	for i := 0; i < colorHues+colorGrays; i++ {
+		a, b := int(h1>>uint(4*i)&0xf), int(h2>>uint(4*i)&0xf)
+		if a > b {
+			d += a - b
+		} else {
+			d += b - a
+		}
+	}
+	if dist := float64(d) / (2 * colorLevels); dist < 1 {
+		return dist
+	}
+	return 1
+}
+
+func colorBin(r, g, b uint8) int {
+	max, min := r, r
+	if g > max {
+		max = g
+	}
+	if b > max {
+		max = b
+	}
+	if g < min {
+		min = g
+	}
+	if b < min {
+		min = b
+	}
+
+	if max == 0 || float64(max-min)/float64(max) < minSaturation {
+		return colorHues + int(max)*colorGrays/256
+	}
+
+	// Hue in [0, 6), as in the HSV colour model.
+	c := float64(max - min)
+	var h float64
+	switch max {
+	case r:
+		h = float64(int(g)-int(b)) / c
+		if h < 0 {
+			h += 6
+		}
+	case g:
+		h = float64(int(b)-int(r))/c + 2
+	default:
+		h = float64(int(r)-int(g))/c + 4
+	}
+	bin := int(h * colorHues / 6)
+	if bin >= colorHues {
+		bin = colorHues - 1
+	}
+	return bin
+}
@@ -13,110 +13,197 @@
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <http://www.gnu.org/licenses/>.
 
+// Package imgdiff computes perceptual hashes of images: small
+// signatures that stay close for images that look alike, even after
+// resizing, recompression or small edits.
 package imgdiff
 
 import (
-	"github.com/gotk3/gotk3/gdk"
-	//"github.com/nfnt/resize"
 	"image"
 	"image/color"
 	"math/bits"
-	//"github.com/disintegration/imaging"
+	"sort"
 )
 
-const (
-	dhashImageWidth  = 9
-	dhashImageHeight = 8
-)
-
-type Hash uint64 // assuming (dhashImageWidth-1)*dhashImageHeight <= 64
+type Hash uint64
 
+// Distance returns the number of bits that differ between two hashes.
 func Distance(h1, h2 Hash) int {
 	return bits.OnesCount64(uint64(h1 ^ h2))
 }
 
-func init() {
-	if dhashImageHeight*(dhashImageWidth-1) > 64 {
-		panic("dhashImageHeight is too large")
-	}
+// A Hasher computes one kind of perceptual hash.
+type Hasher interface {
+	// Name identifies the algorithm, as in the configuration.
+	Name() string
+	Hash(img image.Image) Hash
+	// Distance returns how different the images with the given
+	// hashes are, from 0 for identical to 1 for unrelated.
+	Distance(h1, h2 Hash) float64
 }
 
-// type grayscaleImage {
-// 	int w
-// 	int h
-// 	data []byte
-// }
-//
-// func newGrayscaleImage(int w, h) grayscaleImage {
-// 	return grayscaleImage{
-// 		w: w,
-// 		h: h,
-// 		data: make([]byte, w*h, w*h)
-// 	}
-// }
-
-func pixbufToGrayscaleImage(p *gdk.Pixbuf) *image.Gray {
-	nchan := p.GetNChannels()
-	data := p.GetPixels()
-	w, h := p.GetWidth(), p.GetHeight()
-	rowstride := p.GetRowstride()
-	im := image.NewGray(image.Rect(0, 0, w, h))
-
-	if nchan == 1 {
-		for ih := 0; ih < h; ih++ {
-			for iw := 0; iw < w; iw++ {
-				y := data[ih*rowstride+iw*nchan]
-				im.SetGray(iw, ih, color.Gray{Y: y})
-			}
-		}
-	} else if nchan == 3 || nchan == 4 {
-		for ih := 0; ih < h; ih++ {
-			for iw := 0; iw < w; iw++ {
-				r := data[ih*rowstride+iw*nchan]
-				g := data[ih*rowstride+iw*nchan+1]
-				b := data[ih*rowstride+iw*nchan+2]
-				y := uint8((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
-				im.SetGray(iw, ih, color.Gray{Y: y})
-			}
+var (
+	Average        Hasher = averageHash{}
+	Difference     Hasher = differenceHash{}
+	Perceptual     Hasher = perceptualHash{}
+	Wavelet        Hasher = waveletHash{}
+	ColorHistogram Hasher = colorHistogram{}
+)
+
+// Hashers lists every algorithm, Difference first as the default.
+var Hashers = []Hasher{Difference, Average, Perceptual, Wavelet, ColorHistogram}
+
+// Lookup returns the hasher called name, or nil.
+func Lookup(name string) Hasher {
+	for _, h := range Hashers {
+		if h.Name() == name {
+			return h
 		}
-	} else {
-		panic("unknown image depth")
 	}
+	return nil
+}
 
-	return im
+// hamming is the distance of hashes whose 64 bits weigh the same.
+func hamming(h1, h2 Hash) float64 {
+	return float64(Distance(h1, h2)) / 64
 }
 
-// http://www.hackerfactor.com/blog/?/archives/529-Kind-of-Like-That.html
-func DHash(p *gdk.Pixbuf) Hash {
-	//im := resize.Resize(dhashImageWidth, dhashImageHeight, pixbufToGrayscaleImage(p), resize.Bilinear)
-	//gray := im.(*image.Gray)
+// averageHash sets a bit for each cell of an 8x8 grid that is brighter
+// than the mean.
+type averageHash struct{}
 
-	//im := imaging.Resize(pixbufToGrayscaleImage(p), dhashImageWidth, dhashImageHeight, imaging.Linear)
+func (averageHash) Name() string                 { return "ahash" }
+func (averageHash) Distance(h1, h2 Hash) float64 { return hamming(h1, h2) }
 
-	q, err := p.ScaleSimple(dhashImageWidth, dhashImageHeight, gdk.INTERP_TILES)
-	if err != nil {
-		panic(err.Error())
+func (averageHash) Hash(img image.Image) Hash {
+	g := grayGrid(img, 8, 8)
+	mean := 0.0
+	for _, v := range g {
+		mean += v
 	}
-	gray := pixbufToGrayscaleImage(q)
+	mean /= float64(len(g))
+	return threshold(g, mean)
+}
 
-	data := make([]byte, dhashImageWidth*dhashImageHeight, dhashImageWidth*dhashImageHeight)
-	for iy := 0; iy < dhashImageHeight; iy++ {
-		for ix := 0; ix < dhashImageWidth; ix++ {
-			data[iy*dhashImageWidth+ix] = gray.GrayAt(ix, iy).Y
-		}
-	}
+// differenceHash sets a bit where brightness increases from one cell
+// to the next in a 9x8 grid.
+// http://www.hackerfactor.com/blog/?/archives/529-Kind-of-Like-That.html
+type differenceHash struct{}
 
-	var hash Hash
+func (differenceHash) Name() string                 { return "dhash" }
+func (differenceHash) Distance(h1, h2 Hash) float64 { return hamming(h1, h2) }
+
+func (differenceHash) Hash(img image.Image) Hash {
+	const w, h = 9, 8
+	g := grayGrid(img, w, h)
 
-	for iy := 0; iy < dhashImageHeight; iy++ {
-		for ix := 0; ix < dhashImageWidth-1; ix++ {
-			o := iy * dhashImageWidth
-			if data[o+ix+1] > data[o+ix] {
-				hash |= 1 << uint(iy*dhashImageHeight+ix)
+	var hash Hash
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			if g[y*w+x+1] > g[y*w+x] {
+				hash |= 1 << uint(y*(w-1)+x)
 			}
 		}
 	}
+	return hash
+}
 
+// threshold sets bit i of the hash if v[i] > t.
+func threshold(v []float64, t float64) Hash {
+	var hash Hash
+	for i, x := range v {
+		if x > t {
+			hash |= 1 << uint(i)
+		}
+	}
 	return hash
+}
+
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+func luma(r, g, b uint8) float64 {
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
+
+// grayGrid averages the brightness of img over a w x h grid. Cells
+// that no pixel falls into, when img is smaller than the grid, take
+// the pixel under their centre.
+func grayGrid(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	dx, dy := b.Dx(), b.Dy()
+	sum := make([]float64, w*h)
+	count := make([]int, w*h)
+
+	eachPixel(img, func(x, y int, r, g, bl uint8) {
+		i := (y*h/dy)*w + x*w/dx
+		sum[i] += luma(r, g, bl)
+		count[i]++
+	})
+
+	for i := range sum {
+		if count[i] > 0 {
+			sum[i] /= float64(count[i])
+			continue
+		}
+		if dx == 0 || dy == 0 {
+			continue
+		}
+		x, y := (i%w*dx+dx/2)/w, (i/w*dy+dy/2)/h
+		c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+		sum[i] = luma(c.R, c.G, c.B)
+	}
+	return sum
+}
 
+// eachPixel calls f with the colour of every pixel of img, with x and
+// y relative to its bounds. The common image types are read directly,
+// as img.At allocates.
+func eachPixel(img image.Image, f func(x, y int, r, g, b uint8)) {
+	b := img.Bounds()
+	switch m := img.(type) {
+	case *image.NRGBA:
+		for y := 0; y < b.Dy(); y++ {
+			p := m.Pix[y*m.Stride : y*m.Stride+4*b.Dx()]
+			for x := 0; x < b.Dx(); x++ {
+				f(x, y, p[4*x], p[4*x+1], p[4*x+2])
+			}
+		}
+	case *image.RGBA:
+		for y := 0; y < b.Dy(); y++ {
+			p := m.Pix[y*m.Stride : y*m.Stride+4*b.Dx()]
+			for x := 0; x < b.Dx(); x++ {
+				f(x, y, p[4*x], p[4*x+1], p[4*x+2])
+			}
+		}
+	case *image.Gray:
+		for y := 0; y < b.Dy(); y++ {
+			p := m.Pix[y*m.Stride : y*m.Stride+b.Dx()]
+			for x, v := range p {
+				f(x, y, v, v, v)
+			}
+		}
+	case *image.YCbCr:
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				yi, ci := m.YOffset(b.Min.X+x, b.Min.Y+y), m.COffset(b.Min.X+x, b.Min.Y+y)
+				r, g, bl := color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+				f(x, y, r, g, bl)
+			}
+		}
+	default:
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+				f(x, y, c.R, c.G, c.B)
+			}
+		}
+	}
 }
@@ -0,0 +1,202 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package imgdiff
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// scene draws a picture given as a function of coordinates in [0, 1).
+func scene(w, h int, f func(u, v float64) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, f(float64(x)/float64(w), float64(y)/float64(h)))
+		}
+	}
+	return img
+}
+
+func gray(v float64) color.NRGBA {
+	c := uint8(math.Max(0, math.Min(255, v*255)))
+	return color.NRGBA{c, c, c, 255}
+}
+
+// A gradient with a bright disc: the picture the variants are made of.
+func disc(u, v float64) color.NRGBA {
+	if (u-0.6)*(u-0.6)+(v-0.4)*(v-0.4) < 0.04 {
+		return gray(0.95)
+	}
+	return gray(0.2 + 0.5*u*v)
+}
+
+func stripes(u, v float64) color.NRGBA {
+	return gray(0.5 + 0.4*math.Sin(u*40+v*7))
+}
+
+func tint(f func(u, v float64) color.NRGBA, r, g, b float64) func(u, v float64) color.NRGBA {
+	return func(u, v float64) color.NRGBA {
+		c := f(u, v)
+		return color.NRGBA{uint8(float64(c.R) * r), uint8(float64(c.G) * g), uint8(float64(c.B) * b), 255}
+	}
+}
+
+func brighter(f func(u, v float64) color.NRGBA) func(u, v float64) color.NRGBA {
+	return func(u, v float64) color.NRGBA {
+		c := f(u, v)
+		add := func(x uint8) uint8 { return uint8(math.Min(255, float64(x)+20)) }
+		return color.NRGBA{add(c.R), add(c.G), add(c.B), 255}
+	}
+}
+
+func noisy(img *image.NRGBA) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	out := image.NewNRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = v
+			continue
+		}
+		out.Pix[i] = uint8(math.Max(0, math.Min(255, float64(v)+rnd.NormFloat64()*6)))
+	}
+	return out
+}
+
+func TestHashers(t *testing.T) {
+	orig := scene(600, 900, disc)
+	alike := map[string]image.Image{
+		"resized":  scene(240, 360, disc),
+		"brighter": scene(600, 900, brighter(disc)),
+		"noisy":    noisy(orig),
+	}
+	other := scene(600, 900, stripes)
+
+	for _, h := range Hashers {
+		if h.Distance(h.Hash(orig), h.Hash(orig)) != 0 {
+			t.Errorf("%s: an image differs from itself", h.Name())
+		}
+		if Lookup(h.Name()) != h {
+			t.Errorf("Lookup(%q) failed", h.Name())
+		}
+
+		base := h.Hash(orig)
+		for name, img := range alike {
+			if h == ColorHistogram && name == "brighter" {
+				// Grays move to the next bin.
+				continue
+			}
+			if d := h.Distance(base, h.Hash(img)); d > 0.15 {
+				t.Errorf("%s: %s image is %.2f away", h.Name(), name, d)
+			}
+		}
+		if h == ColorHistogram {
+			// Both are shades of gray.
+			continue
+		}
+		if d := h.Distance(base, h.Hash(other)); d < 0.3 {
+			t.Errorf("%s: different image is only %.2f away", h.Name(), d)
+		}
+	}
+
+	if Lookup("nope") != nil {
+		t.Error("Lookup found an unknown hasher")
+	}
+}
+
+func TestColorHistogram(t *testing.T) {
+	h := ColorHistogram
+	red := h.Hash(scene(200, 300, tint(disc, 1, 0.2, 0.2)))
+	blue := h.Hash(scene(200, 300, tint(disc, 0.2, 0.2, 1)))
+	if d := h.Distance(red, blue); d < 0.5 {
+		t.Errorf("red and blue are only %.2f apart", d)
+	}
+}
+
+func TestImageTypes(t *testing.T) {
+	// Hashes don't depend on how the image is stored.
+	src := scene(64, 96, disc)
+	gray := image.NewGray(src.Bounds())
+	rgba := image.NewRGBA(src.Bounds())
+	ycc := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 64; x++ {
+			c := src.NRGBAAt(x, y)
+			gray.SetGray(x, y, color.Gray{c.R})
+			rgba.SetRGBA(x, y, color.RGBA{c.R, c.G, c.B, 255})
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			ycc.Y[ycc.YOffset(x, y)], ycc.Cb[ycc.COffset(x, y)], ycc.Cr[ycc.COffset(x, y)] = yy, cb, cr
+		}
+	}
+	sub := scene(100, 150, disc).SubImage(image.Rect(18, 27, 82, 123))
+
+	for _, h := range Hashers {
+		want := h.Hash(src)
+		for _, img := range []image.Image{gray, rgba, ycc} {
+			if d := h.Distance(want, h.Hash(img)); d > 0.05 {
+				t.Errorf("%s: %T is %.2f away", h.Name(), img, d)
+			}
+		}
+		// Sub-images are hashed relative to their bounds.
+		h.Hash(sub)
+	}
+}
+
+func TestTinyImage(t *testing.T) {
+	// Smaller than the grids the hashes work on.
+	img := scene(3, 2, disc)
+	for _, h := range Hashers {
+		if h.Distance(h.Hash(img), h.Hash(img)) != 0 {
+			t.Errorf("%s: unstable on a tiny image", h.Name())
+		}
+	}
+	h := Difference.Hash(image.NewNRGBA(image.Rect(0, 0, 0, 0)))
+	if h != 0 {
+		t.Errorf("empty image hashed to %x", h)
+	}
+}
+
+func BenchmarkHashers(b *testing.B) {
+	images := map[string]image.Image{
+		"NRGBA": scene(1000, 1500, disc),
+	}
+	ycc := image.NewYCbCr(image.Rect(0, 0, 1000, 1500), image.YCbCrSubsampleRatio420)
+	images["YCbCr"] = ycc
+
+	for _, h := range Hashers {
+		for name, img := range images {
+			b.Run(h.Name()+"/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					h.Hash(img)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDistance(b *testing.B) {
+	x, y := Hash(0x0123456789abcdef), Hash(0xfedcba9876543210)
+	for _, h := range Hashers {
+		b.Run(h.Name(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h.Distance(x, y)
+			}
+		})
+	}
+}
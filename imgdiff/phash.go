@@ -0,0 +1,71 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package imgdiff
+
+import (
+	"image"
+	"math"
+)
+
+const dctSize = 32
+
+// dctCos[u][x] is the DCT-II basis cos((2x+1)uπ/2N).
+var dctCos = func() (t [dctSize][dctSize]float64) {
+	for u := range t {
+		for x := range t[u] {
+			t[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * dctSize))
+		}
+	}
+	return
+}()
+
+// perceptualHash takes the discrete cosine transform of a 32x32
+// grid, and sets a bit for each of the 8x8 lowest frequencies that is
+// above their median. The DC term is left out of the median, as it
+// only says how bright the image is.
+// http://www.hackerfactor.com/blog/?/archives/432-Looks-Like-It.html
+type perceptualHash struct{}
+
+func (perceptualHash) Name() string                 { return "phash" }
+func (perceptualHash) Distance(h1, h2 Hash) float64 { return hamming(h1, h2) }
+
+func (perceptualHash) Hash(img image.Image) Hash {
+	g := grayGrid(img, dctSize, dctSize)
+
+	// Rows first, keeping only the 8 lowest frequencies, then columns.
+	var rows [dctSize][8]float64
+	for y := 0; y < dctSize; y++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for x := 0; x < dctSize; x++ {
+				s += g[y*dctSize+x] * dctCos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	coeffs := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for y := 0; y < dctSize; y++ {
+				s += rows[y][u] * dctCos[v][y]
+			}
+			coeffs[v*8+u] = s
+		}
+	}
+
+	return threshold(coeffs, median(coeffs[1:]))
+}
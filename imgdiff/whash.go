@@ -0,0 +1,78 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package imgdiff
+
+import "image"
+
+// waveletHash runs a Haar wavelet transform over a 64x64 grid down to
+// 4x4 bands. The 16 coarsest coefficients (LL) give a bit each for
+// being above their median, and the 48 in the horizontal, vertical
+// and diagonal detail bands give a bit each for their sign. Edges
+// thus count for more than in the average hash.
+type waveletHash struct{}
+
+func (waveletHash) Name() string                 { return "whash" }
+func (waveletHash) Distance(h1, h2 Hash) float64 { return hamming(h1, h2) }
+
+func (waveletHash) Hash(img image.Image) Hash {
+	const size = 64
+	g := grayGrid(img, size, size)
+
+	// Each pass halves the LL band, in place in the top left corner.
+	for n := size; n > 8; n /= 2 {
+		haar(g, size, n)
+	}
+	haar(g, size, 8)
+
+	ll := make([]float64, 0, 16)
+	detail := make([]float64, 0, 48)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if x < 4 && y < 4 {
+				ll = append(ll, g[y*size+x])
+			} else {
+				detail = append(detail, g[y*size+x])
+			}
+		}
+	}
+
+	return threshold(ll, median(ll)) | threshold(detail, 0)<<16
+}
+
+// haar does one level of the 2D Haar transform on the n x n top left
+// corner of g, whose rows are stride long.
+func haar(g []float64, stride, n int) {
+	tmp := make([]float64, n)
+	half := n / 2
+	for y := 0; y < n; y++ {
+		row := g[y*stride : y*stride+n]
+		for i := 0; i < half; i++ {
+			tmp[i] = (row[2*i] + row[2*i+1]) / 2
+			tmp[half+i] = (row[2*i] - row[2*i+1]) / 2
+		}
+		copy(row, tmp)
+	}
+	for x := 0; x < n; x++ {
+		for i := 0; i < half; i++ {
+			a, b := g[2*i*stride+x], g[(2*i+1)*stride+x]
+			tmp[i] = (a + b) / 2
+			tmp[half+i] = (a - b) / 2
+		}
+		for i := 0; i < n; i++ {
+			g[i*stride+x] = tmp[i]
+		}
+	}
+}
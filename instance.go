@@ -0,0 +1,231 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/ipc"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// remoteState is what the get-state command returns.
+type remoteState struct {
+	Archive    string `json:",omitempty"`
+	Name       string `json:",omitempty"`
+	Page       int    `json:",omitempty"` // 1-based
+	Pages      int    `json:",omitempty"`
+	Fullscreen bool
+	DoublePage bool
+	MangaMode  bool
+	ZoomMode   string
+	Slideshow  bool
+	Seed       int64 `json:",omitempty"` // set in random mode
+}
+
+var remoteCommands = "next, prev, goto <page>, open <archive> [page], bookmark <name>, toggle-fullscreen, toggle-slideshow, present, get-state"
+
+// startIPC makes the viewer controllable by other processes. Only the
+// first instance gets to listen.
+func (gui *GUI) startIPC() {
+	s, err := ipc.Listen(ipc.SocketPath(), gui.handleIPC)
+	if err != nil {
+		if err != ipc.ErrRunning {
+			log.Println(err)
+		}
+		return
+	}
+	gui.IPC = s
+}
+
+// handleIPC runs a request on the main loop and waits for the result.
+func (gui *GUI) handleIPC(req ipc.Request) (interface{}, error) {
+	type result struct {
+		v   interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	glib.IdleAdd(func() {
+		v, err := gui.runIPC(req)
+		done <- result{v, err}
+	})
+	r := <-done
+	return r.v, r.err
+}
+
+func (gui *GUI) runIPC(req ipc.Request) (interface{}, error) {
+	args := req.Args
+	needArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("%s: wrong number of arguments", req.Command)
+		}
+		return nil
+	}
+
+	switch req.Command {
+	case "next":
+		gui.NextPage()
+	case "prev":
+		gui.PreviousPage()
+	case "goto":
+		if err := needArgs(1, 1); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || !gui.Loaded() || n < 1 || n > gui.State.Archive.Len() {
+			return nil, errors.New("goto: invalid page " + args[0])
+		}
+		gui.jumpToPage(n - 1)
+	case "open":
+		if err := needArgs(1, 2); err != nil {
+			return nil, err
+		}
+		gui.LoadArchive(args[0])
+		if !gui.Loaded() {
+			return nil, errors.New("open: failed to open " + args[0])
+		}
+		if len(args) == 2 {
+			if n, err := strconv.Atoi(args[1]); err == nil && n >= 1 && n <= gui.State.Archive.Len() {
+				gui.SetPage(n - 1)
+			}
+		}
+	case "bookmark":
+		if err := needArgs(1, 1); err != nil {
+			return nil, err
+		}
+		b := gui.Bookmarks.FindByName(args[0])
+		if b == nil {
+			return nil, errors.New("bookmark: no bookmark called " + args[0])
+		}
+		gui.JumpToBookmark(b)
+	case "toggle-fullscreen":
+		gui.SetFullscreen(!gui.Config.Fullscreen)
+	case "toggle-slideshow":
+		gui.ToggleSlideshow()
+	case "present":
+		gui.MainWindow.Present()
+	case "get-state":
+		return gui.remoteState(), nil
+	default:
+		return nil, fmt.Errorf("unknown command %q, expected one of: %s", req.Command, remoteCommands)
+	}
+	return nil, nil
+}
+
+func (gui *GUI) remoteState() remoteState {
+	st := remoteState{
+		Fullscreen: gui.Config.Fullscreen,
+		DoublePage: gui.Config.DoublePage,
+		MangaMode:  gui.Config.MangaMode,
+		ZoomMode:   gui.Config.ZoomMode,
+		Slideshow:  gui.Slideshow.running,
+	}
+	if gui.Config.Random {
+		st.Seed = gui.Config.ShuffleSeed
+	}
+	if gui.Loaded() {
+		st.Archive = gui.State.ArchivePath
+		st.Name = gui.State.ArchiveName
+		st.Page = gui.State.ArchivePos + 1
+		st.Pages = gui.State.Archive.Len()
+	}
+	return st
+}
+
+// singleInstance reports whether the user asked for archives to be
+// opened in the running window.
+func singleInstance() bool {
+	path := *configFlag
+	if path == "" {
+		dir, err := userConfigPath()
+		if err != nil {
+			return false
+		}
+		path = filepath.Join(dir, ConfigFile)
+	}
+
+	var config Config
+	if err := config.Load(path); err != nil {
+		return false
+	}
+	return config.SingleInstance
+}
+
+// forwardToRunning hands the archive or bookmark given on the command
+// line over to the running instance, and reports whether there was one
+// to take it. Session flags other than -page are not forwarded.
+func forwardToRunning() bool {
+	var req ipc.Request
+	switch {
+	case *bookmarkFlag != "":
+		req = ipc.Request{Command: "bookmark", Args: []string{*bookmarkFlag}}
+	case flag.NArg() > 0:
+		uri := flag.Arg(0)
+		if !archive.IsRemote(uri) && !filepath.IsAbs(uri) {
+			if abs, err := filepath.Abs(uri); err == nil {
+				uri = abs
+			}
+		}
+		req = ipc.Request{Command: "open", Args: []string{uri}}
+		if *pageFlag > 0 {
+			req.Args = append(req.Args, strconv.Itoa(*pageFlag))
+		}
+	default:
+		req = ipc.Request{Command: "present"}
+	}
+
+	_, err := ipc.Send(ipc.SocketPath(), req)
+	if err == ipc.ErrNotRunning {
+		return false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if req.Command != "present" {
+		ipc.Send(ipc.SocketPath(), ipc.Request{Command: "present"})
+	}
+	return true
+}
+
+// runRemote sends a command to the running instance.
+func runRemote(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	data, err := ipc.Send(ipc.SocketPath(), ipc.Request{Command: args[0], Args: args[1:]})
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "\t"); err != nil {
+		return err
+	}
+	fmt.Println(out.String())
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ipc lets other processes control a running gomics over a
+// Unix socket. Every connection carries a single JSON request, answered
+// by a single JSON response.
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Request struct {
+	Command string
+	Args    []string `json:",omitempty"`
+}
+
+type Response struct {
+	Error string          `json:",omitempty"`
+	Data  json.RawMessage `json:",omitempty"`
+}
+
+// A Handler runs a request. The result, if not nil, is sent back as
+// JSON.
+type Handler func(req Request) (interface{}, error)
+
+var (
+	ErrRunning    = errors.New("Another instance is already listening.")
+	ErrNotRunning = errors.New("gomics isn't running.")
+)
+
+// How long a client has to send its request.
+const requestTimeout = 5 * time.Second
+
+// SocketPath returns the path of the socket of the current user.
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gomics.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gomics-%d.sock", os.Getuid()))
+}
+
+type Server struct {
+	path     string
+	listener net.Listener
+	handler  Handler
+}
+
+// Listen starts serving requests on the socket at path. It returns
+// ErrRunning if another process already does; a socket left behind by
+// a process that died is replaced.
+func Listen(path string, h Handler) (*Server, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, ErrRunning
+	}
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	s := &Server{path: path, listener: l, handler: h}
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req Request
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: err.Error()})
+		return
+	}
+
+	var resp Response
+	v, err := s.handler(req)
+	if err == nil && v != nil {
+		resp.Data, err = json.Marshal(v)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// Close stops listening and removes the socket.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// Send sends a request to the process listening at path, and returns
+// the data of its response.
+func Send(path string, req Request) (json.RawMessage, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Data, nil
+}
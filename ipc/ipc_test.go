@@ -0,0 +1,110 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestIPC(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gomics-ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gomics.sock")
+
+	page := 1
+	s, err := Listen(path, func(req Request) (interface{}, error) {
+		switch req.Command {
+		case "next":
+			page++
+			return nil, nil
+		case "goto":
+			n, err := strconv.Atoi(req.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			page = n
+			return nil, nil
+		case "get-state":
+			return map[string]int{"Page": page}, nil
+		}
+		return nil, errors.New("unknown command")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Listen(path, nil); err != ErrRunning {
+		t.Errorf("second Listen: %v", err)
+	}
+
+	if data, err := Send(path, Request{Command: "next"}); err != nil || data != nil {
+		t.Errorf("next: %s %v", data, err)
+	}
+	if _, err := Send(path, Request{Command: "goto", Args: []string{"x"}}); err == nil {
+		t.Errorf("goto x succeeded")
+	}
+	if _, err := Send(path, Request{Command: "bogus"}); err == nil || err.Error() != "unknown command" {
+		t.Errorf("bogus: %v", err)
+	}
+
+	data, err := Send(path, Request{Command: "get-state"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct{ Page int }
+	if err := json.Unmarshal(data, &state); err != nil || state.Page != 2 {
+		t.Errorf("state = %s, %v", data, err)
+	}
+
+	s.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind: %v", err)
+	}
+	if _, err := Send(path, Request{Command: "next"}); err != ErrNotRunning {
+		t.Errorf("Send after Close: %v", err)
+	}
+}
+
+func TestStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gomics-ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gomics.sock")
+
+	// A crashed instance leaves its socket file behind.
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Listen(path, func(Request) (interface{}, error) { return "pong", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if data, err := Send(path, Request{Command: "ping"}); err != nil || string(data) != `"pong"` {
+		t.Errorf("ping: %s %v", data, err)
+	}
+}
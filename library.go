@@ -0,0 +1,231 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/library"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (gui *GUI) progressPath() string {
+	return filepath.Join(gui.State.ConfigPath, ProgressFile)
+}
+
+func (gui *GUI) LoadProgress() {
+	if err := gui.Progress.Load(gui.progressPath()); err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+}
+
+// mergeProgress takes in the positions saved since the file was read,
+// by the server for instance, where they're newer than ours.
+func (gui *GUI) mergeProgress() {
+	var disk library.Progress
+	if err := disk.Load(gui.progressPath()); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return
+	}
+	gui.Progress.Merge(&disk)
+}
+
+func (gui *GUI) SaveProgress() {
+	gui.mergeProgress()
+	if err := gui.Progress.Save(gui.progressPath()); err != nil {
+		log.Println(err)
+	}
+}
+
+// recordProgress remembers the current page of the current archive.
+func (gui *GUI) recordProgress() {
+	if !gui.Loaded() || gui.State.ArchiveFingerprint == "" {
+		return
+	}
+
+	gui.Progress.Set(gui.State.ArchiveFingerprint, library.Position{
+		Path:       gui.State.ArchivePath,
+		Page:       uint(gui.State.ArchivePos + 1),
+		TotalPages: uint(gui.State.Archive.Len()),
+	})
+}
+
+// libraryRoots returns the directories to search for moved archives.
+// The closest existing parent of the old location is searched first,
+// which covers archives renamed or moved around within a series.
+func (gui *GUI) libraryRoots(oldPath string) []string {
+	var roots []string
+
+	dir := filepath.Dir(oldPath)
+	for {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			roots = append(roots, dir)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return append(roots, gui.Config.LibraryRoots...)
+}
+
+// locateArchive returns the current location of the archive last seen
+// at path with the given fingerprint. If the file is gone or was
+// replaced, the library roots are searched for it, and bookmarks and
+// reading progress are relinked to the new location. If it isn't found
+// elsewhere but path still exists, the archive was changed in place,
+// and they're given its new fingerprint.
+func (gui *GUI) locateArchive(path, fp string) (string, error) {
+	if fp == "" {
+		return path, nil
+	}
+
+	cur, curErr := library.Fingerprint(path)
+	if curErr == nil && cur == fp {
+		return path, nil
+	}
+
+	newPath, err := library.Locate(gui.libraryRoots(path), fp, archive.ArchiveExtensions)
+	if err != nil {
+		if curErr != nil {
+			return "", err
+		}
+		gui.rekeyArchive(path, fp, path, cur)
+		return path, nil
+	}
+
+	gui.Bookmarks.Relink(fp, newPath)
+	gui.Progress.Relink(fp, newPath)
+	gui.SaveBookmarks()
+	gui.SaveProgress()
+	gui.RebuildBookmarksMenu()
+	log.Println("Relinked", path, "to", newPath)
+
+	return newPath, nil
+}
+
+// rekeyArchive moves the bookmarks and reading progress of the archive
+// at path from fingerprint fp to newFP, once it has been changed, and
+// over to newPath if it was written elsewhere.
+func (gui *GUI) rekeyArchive(path, fp, newPath, newFP string) {
+	if fp == "" || newFP == "" || (fp == newFP && path == newPath) {
+		return
+	}
+	// Merged before rather than on saving, which would bring the
+	// position under the old fingerprint back.
+	gui.mergeProgress()
+	gui.Bookmarks.Rekey(fp, path, newFP)
+	gui.Progress.Rekey(fp, path, newFP)
+	if newPath != path {
+		gui.Bookmarks.Relink(newFP, newPath)
+		gui.Progress.Relink(newFP, newPath)
+	}
+	gui.SaveBookmarks()
+	if err := gui.Progress.Save(gui.progressPath()); err != nil {
+		log.Println(err)
+	}
+	gui.RebuildBookmarksMenu()
+	log.Println("Rekeyed", path, "from", fp, "to", newPath, newFP)
+}
+
+// pathRemaps parses Config.PathRemaps, skipping malformed rules.
+func (gui *GUI) pathRemaps() []library.Remap {
+	var rules []library.Remap
+	for _, s := range gui.Config.PathRemaps {
+		rule, err := library.ParseRemap(s)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func exportFormat(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return "csv"
+	}
+	return "json"
+}
+
+func (gui *GUI) ExportBookmarks() {
+	gui.recordProgress()
+
+	res := gtk.ResponseType(gui.ExportBookmarksDialog.Run())
+	gui.ExportBookmarksDialog.Hide()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	path := gui.ExportBookmarksDialog.GetFilename()
+	e := library.NewExport(&gui.Bookmarks, &gui.Progress)
+	e.Remap(library.Reverse(gui.pathRemaps()))
+	if err := writeExport(path, exportFormat(path), e); err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+	gui.SetStatus("Exported bookmarks to " + path)
+}
+
+func (gui *GUI) ImportBookmarks() {
+	res := gtk.ResponseType(gui.ImportBookmarksDialog.Run())
+	gui.ImportBookmarksDialog.Hide()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	path := gui.ImportBookmarksDialog.GetFilename()
+	e, err := readExport(path, exportFormat(path))
+	if err != nil {
+		gui.ShowError(err.Error())
+		return
+	}
+
+	dialog := gtk.MessageDialogNew(gui.MainWindow, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE,
+		"What should happen to bookmarks and positions that exist both here and in the imported file?")
+	dialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Keep _both", gtk.RESPONSE_NO)
+	dialog.AddButton("Keep the _latest", gtk.RESPONSE_YES)
+	res = gtk.ResponseType(dialog.Run())
+	dialog.Destroy()
+
+	var conflict library.Conflict
+	switch res {
+	case gtk.RESPONSE_YES:
+		conflict = library.LatestWins
+	case gtk.RESPONSE_NO:
+		conflict = library.KeepBoth
+	default:
+		return
+	}
+
+	e.Remap(gui.pathRemaps())
+	n := e.Import(&gui.Bookmarks, &gui.Progress, conflict)
+	gui.SaveBookmarks()
+	gui.SaveProgress()
+	gui.RebuildBookmarksMenu()
+	gui.SetStatus(fmt.Sprintf("Imported %d entries from %s", n, path))
+}
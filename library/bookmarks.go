@@ -0,0 +1,214 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package library keeps track of the user's bookmarks and reading
+// progress.
+package library
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Bookmark struct {
+	ID          string
+	Name        string
+	Note        string `json:",omitempty"`
+	Thumbnail   string `json:",omitempty"` // file name, relative to the thumbnail dir
+	Path        string
+	Fingerprint string `json:",omitempty"`
+	Page        uint   // 1-based
+	TotalPages  uint
+	Seed        int64 `json:",omitempty"` // shuffle seed, for bookmarks made in random order
+	Added       time.Time
+}
+
+// Title returns the bookmark's name, falling back to the archive name
+// for bookmarks that were never named.
+func (b *Bookmark) Title() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return filepath.Base(b.Path)
+}
+
+type SortKey int
+
+const (
+	SortByName SortKey = iota
+	SortByAdded
+	SortByArchive
+)
+
+// Bookmarks is the list of bookmarks, kept in the order the user sees
+// them in the menu.
+type Bookmarks struct {
+	Bookmarks []Bookmark
+	lastID    int64
+}
+
+func (bs *Bookmarks) Load(path string) error {
+	return loadJSON(path, bs)
+}
+
+func (bs *Bookmarks) Save(path string) error {
+	return saveJSON(path, bs)
+}
+
+func (bs *Bookmarks) newID() string {
+	id := time.Now().UnixNano()
+	if id <= bs.lastID {
+		id = bs.lastID + 1
+	}
+	bs.lastID = id
+	return strconv.FormatInt(id, 36)
+}
+
+// Add appends b to the list, assigning it a fresh ID, and returns the
+// stored copy.
+func (bs *Bookmarks) Add(b Bookmark) *Bookmark {
+	b.ID = bs.newID()
+	if b.Added.IsZero() {
+		b.Added = time.Now()
+	}
+	bs.Bookmarks = append(bs.Bookmarks, b)
+	return &bs.Bookmarks[len(bs.Bookmarks)-1]
+}
+
+func (bs *Bookmarks) index(id string) int {
+	for i := range bs.Bookmarks {
+		if bs.Bookmarks[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find returns the bookmark with the given ID, or nil.
+func (bs *Bookmarks) Find(id string) *Bookmark {
+	if i := bs.index(id); i >= 0 {
+		return &bs.Bookmarks[i]
+	}
+	return nil
+}
+
+// FindByName returns the first bookmark with the given name, or nil.
+func (bs *Bookmarks) FindByName(name string) *Bookmark {
+	for i := range bs.Bookmarks {
+		if bs.Bookmarks[i].Title() == name {
+			return &bs.Bookmarks[i]
+		}
+	}
+	return nil
+}
+
+// Remove deletes the bookmark with the given ID and returns it.
+func (bs *Bookmarks) Remove(id string) (Bookmark, bool) {
+	i := bs.index(id)
+	if i < 0 {
+		return Bookmark{}, false
+	}
+	b := bs.Bookmarks[i]
+	bs.Bookmarks = append(bs.Bookmarks[:i], bs.Bookmarks[i+1:]...)
+	return b, true
+}
+
+func (bs *Bookmarks) Rename(id, name string) bool {
+	b := bs.Find(id)
+	if b == nil {
+		return false
+	}
+	b.Name = strings.TrimSpace(name)
+	return true
+}
+
+func (bs *Bookmarks) SetNote(id, note string) bool {
+	b := bs.Find(id)
+	if b == nil {
+		return false
+	}
+	b.Note = note
+	return true
+}
+
+// Relink updates the path of every bookmark of the archive with the
+// given fingerprint, and returns how many were changed.
+func (bs *Bookmarks) Relink(fp, path string) int {
+	n := 0
+	for i := range bs.Bookmarks {
+		b := &bs.Bookmarks[i]
+		if b.Fingerprint == fp && b.Path != path {
+			b.Path = path
+			n++
+		}
+	}
+	return n
+}
+
+// Rekey gives the bookmarks of the archive at path with fingerprint fp
+// the fingerprint newFP, as when the archive has been changed in place,
+// and returns how many were changed. Copies of the archive elsewhere
+// keep theirs.
+func (bs *Bookmarks) Rekey(fp, path, newFP string) int {
+	n := 0
+	for i := range bs.Bookmarks {
+		b := &bs.Bookmarks[i]
+		if b.Fingerprint == fp && b.Path == path && fp != newFP {
+			b.Fingerprint = newFP
+			n++
+		}
+	}
+	return n
+}
+
+// Move shifts the bookmark with the given ID by delta positions.
+func (bs *Bookmarks) Move(id string, delta int) bool {
+	i := bs.index(id)
+	j := i + delta
+	if i < 0 || j < 0 || j >= len(bs.Bookmarks) {
+		return false
+	}
+	b := bs.Bookmarks[i]
+	copy(bs.Bookmarks[i:], bs.Bookmarks[i+1:])
+	copy(bs.Bookmarks[j+1:], bs.Bookmarks[j:len(bs.Bookmarks)-1])
+	bs.Bookmarks[j] = b
+	return true
+}
+
+// Sort reorders the bookmarks. The order is stable, so sorting by
+// archive keeps the bookmarks of each archive in page order.
+func (bs *Bookmarks) Sort(key SortKey) {
+	b := bs.Bookmarks
+	var less func(i, j int) bool
+	switch key {
+	case SortByName:
+		less = func(i, j int) bool { return strings.ToLower(b[i].Title()) < strings.ToLower(b[j].Title()) }
+	case SortByAdded:
+		less = func(i, j int) bool { return b[i].Added.Before(b[j].Added) }
+	case SortByArchive:
+		less = func(i, j int) bool {
+			if b[i].Path != b[j].Path {
+				return b[i].Path < b[j].Path
+			}
+			return b[i].Page < b[j].Page
+		}
+	default:
+		return
+	}
+	sort.SliceStable(b, less)
+}
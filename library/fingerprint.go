@@ -0,0 +1,162 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("Couldn't find the archive in the library.")
+)
+
+// Number of bytes hashed at each end of the file.
+const fingerprintChunk = 64 * 1024
+
+// Fingerprint identifies an archive by its content, so that it can be
+// found again after it has been renamed or moved. It hashes the size
+// of the file along with its first and last 64 KiB. For zip files, the
+// tail holds the central directory, which lists every entry with its
+// size and CRC. Directories opened as archives are identified by the
+// names and sizes of the files in them.
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return dirFingerprint(f)
+	}
+	size := fi.Size()
+
+	h := sha1.New()
+	binary.Write(h, binary.LittleEndian, size)
+
+	if _, err := io.CopyN(h, f, min64(size, fingerprintChunk)); err != nil {
+		return "", err
+	}
+
+	if size > fingerprintChunk {
+		off := max64(size-fingerprintChunk, fingerprintChunk)
+		if _, err := io.Copy(h, io.NewSectionReader(f, off, size-off)); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x-%d", h.Sum(nil), size), nil
+}
+
+func dirFingerprint(f *os.File) (string, error) {
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+
+	h := sha1.New()
+	var size int64
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", fi.Name(), fi.Size())
+		size += fi.Size()
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil), size), nil
+}
+
+// fingerprintSize extracts the file size from a fingerprint, allowing
+// most candidates to be skipped without reading them.
+func fingerprintSize(fp string) (int64, bool) {
+	i := strings.LastIndexByte(fp, '-')
+	if i < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(fp[i+1:], 10, 64)
+	return size, err == nil
+}
+
+// Locate searches the given directories recursively for a file with
+// one of the given extensions whose fingerprint is fp.
+func Locate(roots []string, fp string, extensions []string) (string, error) {
+	size, ok := fingerprintSize(fp)
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	found := errors.New("found")
+	var match string
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				// Unreadable directories shouldn't stop the search.
+				return nil
+			}
+			if fi.IsDir() || fi.Size() != size || !hasExtension(path, extensions) {
+				return nil
+			}
+			if cur, err := Fingerprint(path); err == nil && cur == fp {
+				match = path
+				return found
+			}
+			return nil
+		})
+		if err == found {
+			return match, nil
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package library
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocate(t *testing.T) {
+	dir := t.TempDir()
+
+	// Same size, different content: only the fingerprint tells them apart.
+	a := bytes.Repeat([]byte("a"), 3*fingerprintChunk)
+	b := bytes.Repeat([]byte("a"), 3*fingerprintChunk)
+	b[len(b)-1] = 'b'
+
+	oldPath := filepath.Join(dir, "old.cbz")
+	if err := os.WriteFile(oldPath, a, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := Fingerprint(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(dir, "series")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "decoy.cbz"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	newPath := filepath.Join(sub, "renamed.cbz")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Locate([]string{dir}, fp, []string{".cbz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != newPath {
+		t.Errorf("Locate = %q, want %q", got, newPath)
+	}
+
+	if _, err := Locate([]string{dir}, fp, []string{".zip"}); err != ErrNotFound {
+		t.Errorf("Locate with other extensions: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFingerprintDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"01.jpg", "02.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fp, err := Fingerprint(dir)
+	if err != nil || fp == "" {
+		t.Fatalf("Fingerprint = %q, %v", fp, err)
+	}
+	if again, _ := Fingerprint(dir); again != fp {
+		t.Errorf("fingerprint changed from %q to %q", fp, again)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "03.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Fingerprint(dir); other == fp {
+		t.Error("adding a page didn't change the fingerprint")
+	}
+}
+
+func TestCSVOrder(t *testing.T) {
+	e := &Export{Progress: map[string]Position{}}
+	for _, fp := range []string{"fb", "f0", "fa", "fc"} {
+		e.Progress[fp] = Position{Path: "/" + fp + ".cbz", Page: 1}
+	}
+
+	// Rows come out in the same order every time.
+	var first, again bytes.Buffer
+	if err := e.WriteCSV(&first); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again.Reset()
+		e.WriteCSV(&again)
+		if again.String() != first.String() {
+			t.Fatalf("CSV rows changed order:\n%s\n%s", first.String(), again.String())
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	rules := []Remap{{From: "/mnt/nas", To: "/home/x"}}
+	e := &Export{Bookmarks: []Bookmark{{Path: "/home/x/comics/a.cbz"}}}
+	e.Remap(Reverse(rules))
+	if got := e.Bookmarks[0].Path; got != "/mnt/nas/comics/a.cbz" {
+		t.Errorf("path remapped back = %q", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	var p, disk Progress
+	p.Set("a", Position{Page: 1, Updated: t1})
+	p.Set("b", Position{Page: 2, Updated: t0})
+	disk.Set("a", Position{Page: 10, Updated: t0})
+	disk.Set("b", Position{Page: 20, Updated: t1})
+	disk.Set("c", Position{Page: 30, Updated: t0})
+
+	p.Merge(&disk)
+	for fp, want := range map[string]uint{"a": 1, "b": 20, "c": 30} {
+		if pos, _ := p.Get(fp); pos.Page != want {
+			t.Errorf("%s: page %d, want %d", fp, pos.Page, want)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	var bs Bookmarks
+	var p Progress
+	bs.Add(Bookmark{Name: "edited", Path: "/a.cbz", Fingerprint: "old"})
+	bs.Add(Bookmark{Name: "copy", Path: "/b.cbz", Fingerprint: "old"})
+	p.Set("old", Position{Path: "/a.cbz", Page: 4})
+
+	if n := bs.Rekey("old", "/a.cbz", "new"); n != 1 {
+		t.Errorf("Rekey changed %d bookmarks, want 1", n)
+	}
+	if bs.Bookmarks[0].Fingerprint != "new" || bs.Bookmarks[1].Fingerprint != "old" {
+		t.Errorf("fingerprints after Rekey: %q, %q", bs.Bookmarks[0].Fingerprint, bs.Bookmarks[1].Fingerprint)
+	}
+
+	p.Rekey("old", "/b.cbz", "new")
+	if _, ok := p.Get("new"); ok {
+		t.Error("rekeyed the position of another path")
+	}
+	p.Rekey("old", "/a.cbz", "new")
+	if pos, ok := p.Get("new"); !ok || pos.Page != 4 {
+		t.Errorf("position after Rekey: %+v, %v", pos, ok)
+	}
+	if _, ok := p.Get("old"); ok {
+		t.Error("the old position is still there")
+	}
+}
+
+func TestBookmarksMove(t *testing.T) {
+	var bs Bookmarks
+	for _, name := range []string{"a", "b", "c", "d"} {
+		bs.Add(Bookmark{Name: name})
+	}
+
+	names := func() string {
+		s := ""
+		for _, b := range bs.Bookmarks {
+			s += b.Name
+		}
+		return s
+	}
+
+	bs.Move(bs.Bookmarks[3].ID, -2)
+	if got := names(); got != "adbc" {
+		t.Errorf("after moving d up by two: %s", got)
+	}
+	bs.Move(bs.Bookmarks[0].ID, 1)
+	if got := names(); got != "dabc" {
+		t.Errorf("after moving a down: %s", got)
+	}
+	if bs.Move(bs.Bookmarks[0].ID, -1) {
+		t.Error("moved the first bookmark up")
+	}
+}
+
+func TestImport(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	var bs Bookmarks
+	var p Progress
+	local := bs.Add(Bookmark{Name: "local", Path: "/home/x/comics/a.cbz", Fingerprint: "fa", Page: 3, Added: t0})
+	p.Set("fa", Position{Path: "/home/x/comics/a.cbz", Page: 5, Updated: t1})
+
+	e := &Export{
+		Bookmarks: []Bookmark{
+			{ID: local.ID, Name: "remote", Path: "/mnt/nas/comics/a.cbz", Fingerprint: "fa", Page: 3, Added: t1},
+			{ID: "other", Name: "new", Path: "/mnt/nas/comics/b.cbz", Page: 1, Added: t0},
+		},
+		Progress: map[string]Position{
+			"fa": {Path: "/mnt/nas/comics/a.cbz", Page: 9, Updated: t0},
+		},
+	}
+
+	// Round trip through CSV first.
+	var buf bytes.Buffer
+	if err := e.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	e, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Remap([]Remap{{From: "/mnt/nas", To: "/home/x"}})
+	if got := e.Bookmarks[1].Path; got != "/home/x/comics/b.cbz" {
+		t.Fatalf("remapped path = %q", got)
+	}
+
+	if n := e.Import(&bs, &p, LatestWins); n != 2 {
+		t.Errorf("LatestWins imported %d entries, want 2", n)
+	}
+	if len(bs.Bookmarks) != 2 || bs.Bookmarks[0].Name != "remote" {
+		t.Errorf("newer bookmark didn't replace the local one: %+v", bs.Bookmarks)
+	}
+	if pos, _ := p.Get("fa"); pos.Page != 5 {
+		t.Errorf("older position replaced the local one: %+v", pos)
+	}
+
+	if n := e.Import(&bs, &p, KeepBoth); n != 1 {
+		t.Errorf("KeepBoth imported %d entries, want 1", n)
+	}
+	if len(bs.Bookmarks) != 3 || bs.Bookmarks[2].Page != 9 {
+		t.Errorf("the other position wasn't kept as a bookmark: %+v", bs.Bookmarks)
+	}
+}
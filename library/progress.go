@@ -0,0 +1,85 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package library
+
+import (
+	"time"
+)
+
+// Position is where the user left off in an archive.
+type Position struct {
+	Path       string
+	Page       uint // 1-based
+	TotalPages uint
+	Updated    time.Time
+}
+
+// Progress holds the reading positions, keyed by archive fingerprint.
+type Progress struct {
+	Positions map[string]Position
+}
+
+func (p *Progress) Load(path string) error {
+	return loadJSON(path, p)
+}
+
+func (p *Progress) Save(path string) error {
+	return saveJSON(path, p)
+}
+
+func (p *Progress) Get(fp string) (Position, bool) {
+	pos, ok := p.Positions[fp]
+	return pos, ok
+}
+
+func (p *Progress) Set(fp string, pos Position) {
+	if p.Positions == nil {
+		p.Positions = make(map[string]Position)
+	}
+	if pos.Updated.IsZero() {
+		pos.Updated = time.Now()
+	}
+	p.Positions[fp] = pos
+}
+
+// Merge takes the positions of other that are newer than those in p,
+// or missing from it.
+func (p *Progress) Merge(other *Progress) {
+	for fp, pos := range other.Positions {
+		if cur, ok := p.Positions[fp]; !ok || pos.Updated.After(cur.Updated) {
+			p.Set(fp, pos)
+		}
+	}
+}
+
+// Rekey moves the position of the archive at path from fingerprint fp
+// to newFP, as when the archive has been changed in place.
+func (p *Progress) Rekey(fp, path, newFP string) {
+	pos, ok := p.Positions[fp]
+	if !ok || pos.Path != path || fp == newFP {
+		return
+	}
+	delete(p.Positions, fp)
+	p.Positions[newFP] = pos
+}
+
+// Relink updates the path of the archive with the given fingerprint.
+func (p *Progress) Relink(fp, path string) {
+	if pos, ok := p.Positions[fp]; ok {
+		pos.Path = path
+		p.Positions[fp] = pos
+	}
+}
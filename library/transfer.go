@@ -0,0 +1,281 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package library
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export is the portable form of bookmarks and reading progress, used
+// to move them between machines. Thumbnails are not exported.
+type Export struct {
+	Version   int
+	Bookmarks []Bookmark
+	Progress  map[string]Position
+}
+
+const exportVersion = 1
+
+// Conflict tells Import what to do with entries that exist on both sides.
+type Conflict int
+
+const (
+	// LatestWins keeps whichever side was modified last.
+	LatestWins Conflict = iota
+	// KeepBoth keeps the local entry and adds the imported one next to it.
+	KeepBoth
+)
+
+func NewExport(bs *Bookmarks, p *Progress) *Export {
+	e := &Export{
+		Version:   exportVersion,
+		Bookmarks: make([]Bookmark, len(bs.Bookmarks)),
+		Progress:  make(map[string]Position, len(p.Positions)),
+	}
+	for i, b := range bs.Bookmarks {
+		b.Thumbnail = ""
+		e.Bookmarks[i] = b
+	}
+	for fp, pos := range p.Positions {
+		e.Progress[fp] = pos
+	}
+	return e
+}
+
+func (e *Export) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func ReadJSON(r io.Reader) (*Export, error) {
+	e := new(Export)
+	if err := json.NewDecoder(r).Decode(e); err != nil {
+		return nil, err
+	}
+	if e.Version > exportVersion {
+		return nil, fmt.Errorf("Unsupported export version %d", e.Version)
+	}
+	return e, nil
+}
+
+var csvHeader = []string{"Kind", "ID", "Name", "Note", "Path", "Fingerprint", "Page", "TotalPages", "Time"}
+
+// WriteCSV writes one row per bookmark and per reading position. The
+// Kind column tells them apart. Positions are sorted by fingerprint, so
+// that exports of the same library can be diffed.
+func (e *Export) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+
+	for _, b := range e.Bookmarks {
+		cw.Write([]string{"bookmark", b.ID, b.Name, b.Note, b.Path, b.Fingerprint,
+			fmt.Sprint(b.Page), fmt.Sprint(b.TotalPages), b.Added.Format(time.RFC3339)})
+	}
+	fps := make([]string, 0, len(e.Progress))
+	for fp := range e.Progress {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	for _, fp := range fps {
+		pos := e.Progress[fp]
+		cw.Write([]string{"progress", "", "", "", pos.Path, fp,
+			fmt.Sprint(pos.Page), fmt.Sprint(pos.TotalPages), pos.Updated.Format(time.RFC3339)})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func ReadCSV(r io.Reader) (*Export, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || rows[0][0] != csvHeader[0] {
+		return nil, errors.New("Missing CSV header")
+	}
+
+	e := &Export{Version: exportVersion, Progress: make(map[string]Position)}
+	for i, row := range rows[1:] {
+		page, err1 := strconv.ParseUint(row[6], 10, 0)
+		total, err2 := strconv.ParseUint(row[7], 10, 0)
+		t, err3 := time.Parse(time.RFC3339, row[8])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("Malformed CSV row %d", i+2)
+		}
+
+		switch row[0] {
+		case "bookmark":
+			e.Bookmarks = append(e.Bookmarks, Bookmark{
+				ID: row[1], Name: row[2], Note: row[3], Path: row[4], Fingerprint: row[5],
+				Page: uint(page), TotalPages: uint(total), Added: t,
+			})
+		case "progress":
+			e.Progress[row[5]] = Position{Path: row[4], Page: uint(page), TotalPages: uint(total), Updated: t}
+		default:
+			return nil, fmt.Errorf("Unknown kind %q in CSV row %d", row[0], i+2)
+		}
+	}
+	return e, nil
+}
+
+// Remap translates the path prefix From to To, e.g. between the mount
+// points of the same network share on different machines.
+type Remap struct {
+	From, To string
+}
+
+// ParseRemap parses a rule of the form "from=to".
+func ParseRemap(s string) (Remap, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return Remap{}, fmt.Errorf("Invalid remapping rule %q, expected from=to", s)
+	}
+	return Remap{From: filepath.Clean(s[:i]), To: filepath.Clean(s[i+1:])}, nil
+}
+
+// applyRemaps returns path with the first matching rule applied. Only whole
+// path components match, so /mnt/nas doesn't affect /mnt/nas2.
+func applyRemaps(rules []Remap, path string) string {
+	for _, r := range rules {
+		if path == r.From {
+			return r.To
+		}
+		if strings.HasPrefix(path, r.From+string(filepath.Separator)) {
+			return r.To + path[len(r.From):]
+		}
+	}
+	return path
+}
+
+// Reverse returns the rules translating paths the other way, as when
+// exporting with the rules used for imports.
+func Reverse(rules []Remap) []Remap {
+	reversed := make([]Remap, len(rules))
+	for i, r := range rules {
+		reversed[i] = Remap{From: r.To, To: r.From}
+	}
+	return reversed
+}
+
+func (e *Export) Remap(rules []Remap) {
+	for i := range e.Bookmarks {
+		e.Bookmarks[i].Path = applyRemaps(rules, e.Bookmarks[i].Path)
+	}
+	for fp, pos := range e.Progress {
+		pos.Path = applyRemaps(rules, pos.Path)
+		e.Progress[fp] = pos
+	}
+}
+
+// sameBookmark reports whether a and b mark the same spot.
+func sameBookmark(a, b *Bookmark) bool {
+	if a.Page != b.Page {
+		return false
+	}
+	if a.Fingerprint != "" && b.Fingerprint != "" {
+		return a.Fingerprint == b.Fingerprint
+	}
+	return a.Path == b.Path
+}
+
+// Import merges e into bs and p, and returns the number of bookmarks
+// and positions that were added or changed.
+func (e *Export) Import(bs *Bookmarks, p *Progress, conflict Conflict) (n int) {
+	for _, b := range e.Bookmarks {
+		var local *Bookmark
+		if b.ID != "" {
+			local = bs.Find(b.ID)
+		}
+		if local == nil {
+			for i := range bs.Bookmarks {
+				if sameBookmark(&bs.Bookmarks[i], &b) {
+					local = &bs.Bookmarks[i]
+					break
+				}
+			}
+		}
+
+		switch {
+		case local == nil:
+			if b.ID == "" {
+				b.ID = bs.newID()
+			}
+			bs.Bookmarks = append(bs.Bookmarks, b)
+		case sameBookmark(local, &b) && local.Name == b.Name && local.Note == b.Note && local.Path == b.Path:
+			continue
+		case conflict == KeepBoth:
+			b.ID = bs.newID()
+			bs.Bookmarks = append(bs.Bookmarks, b)
+		case b.Added.After(local.Added):
+			b.ID = local.ID
+			b.Thumbnail = local.Thumbnail
+			*local = b
+		default:
+			continue
+		}
+		n++
+	}
+
+	for fp, pos := range e.Progress {
+		local, ok := p.Get(fp)
+		switch {
+		case !ok:
+			p.Set(fp, pos)
+		case local.Page == pos.Page && local.Path == pos.Path:
+			continue
+		case conflict == KeepBoth:
+			// There is only one position per archive, so the one
+			// that isn't kept is turned into a bookmark.
+			older := pos
+			if pos.Updated.After(local.Updated) {
+				p.Set(fp, pos)
+				older = local
+			}
+			bs.Add(Bookmark{
+				Name:        filepath.Base(older.Path) + " (last read)",
+				Path:        older.Path,
+				Fingerprint: fp,
+				Page:        older.Page,
+				TotalPages:  older.TotalPages,
+				Added:       older.Updated,
+			})
+		case pos.Updated.After(local.Updated):
+			p.Set(fp, pos)
+		default:
+			continue
+		}
+		n++
+	}
+
+	return n
+}
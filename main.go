@@ -21,7 +21,10 @@ import (
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
 	"github.com/salviati/gomics/imgdiff"
+	"github.com/salviati/gomics/library"
+	"github.com/salviati/gomics/shuffle"
 	"log"
 	"net/url"
 	"os"
@@ -35,15 +38,27 @@ import (
 type State struct {
 	Archive            archive.Archive
 	ArchivePos         int
+	ArchivePosR        int // page of PixbufR, past repeats being skipped
 	ArchivePath        string
 	ArchiveName        string
+	ArchiveFingerprint string
 	PixbufL, PixbufR   *gdk.Pixbuf
+	PageMemory         [2]*budget.Handle // of PixbufL and PixbufR
+	HashMemory         *budget.Handle    // of ImageHash and the scene hashes
 	GoToThumnailPixbuf *gdk.Pixbuf
 	DeltaW, DeltaH     int
 	Scale              float64
 	UserHome           string
 	ConfigPath         string
 	ImageHash          map[int]imgdiff.Hash
+	DirIndex           *dirIndex
+	PageOrder          *shuffle.Order // set in random mode
+	Travelling         bool           // set while going back or forward in the history
+	Converting         bool           // an archive is being converted to CBZ
+	Zoom               float64        // set by -zoom, used in the Original zoom mode
+	ConfigFile         string
+	ConfigBase         Config // as loaded, before the command line flags
+	ConfigOverride     Config // as set by the command line flags
 }
 
 func (gui *GUI) SetStatus(msg string) {
@@ -52,6 +67,7 @@ func (gui *GUI) SetStatus(msg string) {
 }
 
 func (gui *GUI) ResizeEvent() {
+	gui.startResize()
 	gui.Blit()
 	gui.StatusImage()
 }
@@ -65,26 +81,40 @@ func (gui *GUI) Close() {
 		return
 	}
 
+	gui.recordProgress()
+	gui.SaveProgress()
+
 	gui.State.Archive.Close()
+	gui.forgetArchive(gui.State.ArchivePath)
 
 	gui.State.Archive = nil
 	gui.State.ArchiveName = ""
 	gui.State.ArchivePath = ""
+	gui.State.ArchiveFingerprint = ""
 	gui.State.ArchivePos = 0
+	gui.State.ArchivePosR = 0
 
 	gui.State.ImageHash = nil
+	gui.Scenes.reset()
+	gui.State.HashMemory.Release()
+	gui.State.HashMemory = nil
 
-	gui.ImageL.Clear()
-	gui.ImageR.Clear()
+	gui.Anim.reset()
+	gui.clearPage(&gui.ViewL)
+	gui.clearPage(&gui.ViewR)
 	gui.State.PixbufL = nil
 	gui.State.PixbufR = nil
+	gui.holdPage(sideLeft, nil)
+	gui.holdPage(sideRight, nil)
 	gui.SetStatus("")
 	gui.MainWindow.SetTitle("Gomics")
-	gc()
 }
 
 func (gui *GUI) LoadArchive(uri string) {
-	// TODO(utkan): non-local (http:// or https://) stuff someday?
+	if archive.IsRemote(uri) {
+		gui.loadRemoteArchive(uri)
+		return
+	}
 
 	u, err := url.Parse(uri)
 	if err != nil {
@@ -106,6 +136,7 @@ func (gui *GUI) LoadArchive(uri string) {
 	}
 
 	if gui.Loaded() {
+		gui.remember()
 		gui.Close()
 	}
 
@@ -119,7 +150,28 @@ func (gui *GUI) LoadArchive(uri string) {
 		return
 	}
 
-	gui.setPage(0) // FIXME(utkan): this might fail.
+	if gui.State.ArchiveFingerprint, err = library.Fingerprint(path); err != nil {
+		log.Println(err)
+	}
+
+	page := 0
+	if gui.Config.Random {
+		gui.shufflePages()
+		page = gui.State.PageOrder.First()
+	}
+	gui.mergeProgress()
+	if pos, ok := gui.Progress.Get(gui.State.ArchiveFingerprint); ok && gui.Config.RememberPosition {
+		page = int(pos.Page) - 1
+		if page < 0 || page >= gui.State.Archive.Len() {
+			page = 0
+		}
+	}
+	if n, ok := fragmentPage(uri); ok && n <= gui.State.Archive.Len() {
+		page = n - 1
+	}
+
+	gui.setPage(page) // FIXME(utkan): this might fail.
+	gui.indexScenes()
 	os.Chdir(gui.State.ArchivePath)
 
 	u.Path = path
@@ -132,6 +184,46 @@ func (gui *GUI) LoadArchive(uri string) {
 	}
 }
 
+// loadRemoteArchive opens an archive over http or https. Remote
+// archives have no directory to navigate and no fingerprint, so they
+// can't be bookmarked across sessions by content.
+func (gui *GUI) loadRemoteArchive(uri string) {
+	if gui.Loaded() {
+		gui.remember()
+		gui.Close()
+	}
+
+	gui.State.ImageHash = make(map[int]imgdiff.Hash)
+
+	var err error
+	if gui.State.Archive, err = archive.NewArchive(uri); err != nil {
+		gui.ShowError("Failed to open " + archive.RemoteName(uri) + ": " + err.Error())
+		return
+	}
+
+	gui.State.ArchivePath = uri
+	gui.State.ArchiveName = archive.RemoteName(uri)
+
+	page := 0
+	if gui.Config.Random {
+		gui.shufflePages()
+		page = gui.State.PageOrder.First()
+	}
+	if n, ok := fragmentPage(uri); ok && n <= gui.State.Archive.Len() {
+		page = n - 1
+	}
+	gui.setPage(page)
+	gui.indexScenes()
+
+	// Don't leave passwords lying around in the recent files list.
+	if u, err := url.Parse(uri); err == nil && u.User != nil {
+		return
+	}
+	if !gui.RecentManager.AddItem(uri) {
+		log.Println("Failed to add", uri, "as a recent item")
+	}
+}
+
 func (gui *GUI) SetPage(n int) {
 	if !gui.Loaded() {
 		return
@@ -150,6 +242,12 @@ func (gui *GUI) SetPage(n int) {
 	}
 
 	gui.setPage(n)
+
+	// After setPage, so that the page stays up as long as its size
+	// calls for.
+	if !gui.Slideshow.advancing {
+		gui.pauseSlideshow()
+	}
 }
 
 func (gui *GUI) setPage(n int) {
@@ -158,6 +256,7 @@ func (gui *GUI) setPage(n int) {
 	}
 
 	gui.State.ArchivePos = n
+	gui.Anim.reset()
 
 	var err error
 	gui.State.PixbufL, err = gui.State.Archive.Load(n, gui.Config.EmbeddedOrientation)
@@ -167,18 +266,21 @@ func (gui *GUI) setPage(n int) {
 	}
 
 	gui.State.PixbufR = nil
-	if gui.Config.DoublePage && n+1 < gui.State.Archive.Len() {
-		gui.State.PixbufR, err = gui.State.Archive.Load(n+1, gui.Config.EmbeddedOrientation)
+	gui.State.ArchivePosR = gui.skipRepeats(n+1, 1)
+	if gui.Config.DoublePage && gui.State.ArchivePosR < gui.State.Archive.Len() {
+		gui.State.PixbufR, err = gui.State.Archive.Load(gui.State.ArchivePosR, gui.Config.EmbeddedOrientation)
 		if err != nil {
 			gui.ShowError(err.Error())
 			return
 		}
 	}
 
-	gc()
+	gui.holdPage(sideLeft, gui.State.PixbufL)
+	gui.holdPage(sideRight, gui.State.PixbufR)
 
 	gui.Blit()
 	gui.StatusImage()
+	gui.loadAnimations()
 
 	gui.scrollToTop()
 }
@@ -257,9 +359,17 @@ func (gui *GUI) scroll(int dx, int dy) {
 }
 */
 func (gui *GUI) Quit() {
+	gui.recordProgress()
+	gui.SaveProgress()
+
+	if gui.IPC != nil {
+		gui.IPC.Close()
+	}
+
 	gui.Config.WindowWidth, gui.Config.WindowHeight = gui.MainWindow.GetSize()
 
-	if err := gui.Config.Save(filepath.Join(gui.State.ConfigPath, ConfigFile)); err != nil {
+	config := gui.configToSave()
+	if err := config.Save(gui.State.ConfigFile); err != nil {
 		log.Println(err)
 	}
 	gtk.MainQuit()
@@ -285,11 +395,23 @@ func (gui *GUI) Init() {
 		log.Fatal(err)
 	}
 
-	if err := gui.Config.Load(filepath.Join(gui.State.ConfigPath, ConfigFile)); err != nil {
+	if err := os.MkdirAll(filepath.Join(gui.State.ConfigPath, ThumbnailDir), 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	gui.State.ConfigFile = filepath.Join(gui.State.ConfigPath, ConfigFile)
+	if *configFlag != "" {
+		gui.State.ConfigFile = *configFlag
+	}
+	if err := gui.Config.Load(gui.State.ConfigFile); err != nil {
 		if os.IsNotExist(err) == false {
 			log.Fatal(err)
 		}
 	}
+	gui.applyFlags()
+
+	gui.LoadBookmarks()
+	gui.LoadProgress()
 
 	gui.RecentManager, err = gtk.RecentManagerGetDefault()
 	if err != nil {
@@ -331,6 +453,9 @@ func (gui *GUI) SetEnlarge(enlarge bool) {
 
 func (gui *GUI) SetRandom(random bool) {
 	gui.Config.Random = random
+	if random {
+		gui.shufflePages()
+	}
 	gui.MenuItemRandom.SetActive(random)
 }
 
@@ -339,6 +464,12 @@ func (gui *GUI) SetSeamless(seamless bool) {
 	gui.MenuItemSeamless.SetActive(seamless)
 }
 
+func (gui *GUI) SetSkipDuplicatePages(skip bool) {
+	gui.Config.SkipDuplicatePages = skip
+	gui.MenuItemSkipDuplicates.SetActive(skip)
+	gui.refreshSpread()
+}
+
 func (gui *GUI) SetHFlip(hflip bool) {
 	gui.Config.HFlip = hflip
 	gui.Blit()
@@ -349,26 +480,6 @@ func (gui *GUI) SetVFlip(vflip bool) {
 	gui.Blit()
 }
 
-func (gui *GUI) SavePNG() {
-	if !gui.Loaded() {
-		return
-	}
-
-	base := filepath.Base(gui.State.ArchivePath)
-	if ext := filepath.Ext(base); len(ext) > 1 {
-		base = strings.TrimSuffix(base, ext)
-	}
-
-	pngBase := fmt.Sprintf("%s-%000d.png", base, gui.State.ArchivePos+1)
-	pngPath := filepath.Join(gui.State.ConfigPath, ImageDir, pngBase)
-	if err := gui.State.PixbufL.SavePNG(pngPath, 5); err != nil {
-		gui.ShowError(err.Error())
-		return
-	}
-
-	gui.SetStatus("Saved to " + pngBase)
-}
-
 func (gui *GUI) SetZoomMode(mode string) {
 	switch mode {
 	case "FitToWidth":
@@ -382,6 +493,7 @@ func (gui *GUI) SetZoomMode(mode string) {
 		mode = "Original"
 	}
 
+	gui.State.Zoom = 0
 	gui.Config.ZoomMode = mode
 	gui.Blit()
 	gui.StatusImage()
@@ -418,8 +530,8 @@ func (gui *GUI) SetSmartScroll(smartScroll bool) {
 
 func (gui *GUI) SetEmbeddedOrientation(embeddedOrientation bool) {
 	gui.Config.EmbeddedOrientation = embeddedOrientation
-	gui.Blit()
-	gui.StatusImage()
+	// The orientation is applied as the pages are loaded.
+	gui.setPage(gui.State.ArchivePos)
 }
 
 func (gui *GUI) fixFocus() {
@@ -430,8 +542,13 @@ var cpuprofile = flag.String("cpuprofile", "", "write cpu profile `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 
 func main() {
+	flag.Usage = commandsUsage
 	flag.Parse()
 
+	if flag.NArg() > 0 && runCommand(flag.Arg(0), flag.Args()[1:]) {
+		return
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -443,13 +560,20 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if err := checkFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if singleInstance() && forwardToRunning() {
+		return
+	}
+
 	gtk.Init(nil)
 	gui := new(GUI)
 	gui.Init()
-
-	if flag.NArg() > 0 {
-		gui.LoadArchive(flag.Arg(0))
-	}
+	gui.startIPC()
+	gui.openFromFlags()
 
 	gtk.Main()
 
@@ -0,0 +1,106 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/budget"
+	"html"
+	"log"
+	"runtime"
+)
+
+// Memory for decoded and scaled pages, thumbnails and hashes, in MiB,
+// unless configured otherwise. The command line tools use it as well.
+const defaultMemoryBudget = 256
+
+// A page hash, and what it takes to keep it in a map.
+const hashBytes = 16
+
+const memoryResponseCollect = 1
+
+// pixbufBytes returns the bytes of pixel data p holds.
+func pixbufBytes(p *gdk.Pixbuf) int64 {
+	if p == nil {
+		return 0
+	}
+	return int64(p.GetRowstride()) * int64(p.GetHeight())
+}
+
+func (gui *GUI) initMemory() {
+	gui.Memory = budget.New(defaultMemoryBudget << 20)
+	gui.SetMemoryBudget(gui.Config.MemoryBudget)
+
+	gui.MemoryDialog.AddButton("C_ollect Now", memoryResponseCollect)
+	gui.MemoryDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+	gui.MemoryDialog.SetDefaultResponse(gtk.RESPONSE_CLOSE)
+}
+
+func (gui *GUI) SetMemoryBudget(mib int) {
+	if mib <= 0 {
+		mib = defaultMemoryBudget
+	}
+	gui.Config.MemoryBudget = mib
+	gui.Memory.SetLimit(int64(mib) << 20)
+}
+
+// holdPage accounts for the page shown on a side, in place of the one
+// before.
+func (gui *GUI) holdPage(side int, p *gdk.Pixbuf) {
+	gui.State.PageMemory[side].Release()
+	gui.State.PageMemory[side] = nil
+	if p != nil {
+		gui.State.PageMemory[side] = gui.Memory.Hold(budget.Pages, pixbufBytes(p), nil)
+	}
+}
+
+// holdHashes accounts for the page hashes of the current archive.
+func (gui *GUI) holdHashes() {
+	size := int64(len(gui.State.ImageHash)+len(gui.Scenes.hashes)) * hashBytes
+	if gui.State.HashMemory == nil {
+		gui.State.HashMemory = gui.Memory.Hold(budget.Hashes, size, nil)
+		return
+	}
+	gui.State.HashMemory.Resize(size)
+}
+
+// RunMemoryDialog shows the memory held by kind, updated every second
+// while it's open.
+func (gui *GUI) RunMemoryDialog() {
+	update := func() {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		text := gui.Memory.Stats().String() + "\n\nGo heap: " + budget.Bytes(int64(ms.HeapAlloc))
+		gui.MemoryLabel.SetMarkup("<tt>" + html.EscapeString(text) + "</tt>")
+	}
+	update()
+	timer, err := glib.TimeoutAdd(1000, func() bool {
+		update()
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	defer glib.SourceRemove(timer)
+
+	for gtk.ResponseType(gui.MemoryDialog.Run()) == memoryResponseCollect {
+		gui.Memory.Collect()
+		update()
+	}
+	gui.MemoryDialog.Hide()
+}
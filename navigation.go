@@ -17,28 +17,111 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/history"
 	"github.com/salviati/gomics/imgdiff"
-	"math/rand"
+	"github.com/salviati/gomics/shuffle"
 	"os"
 	"path/filepath"
 	"reflect"
 )
 
-var (
-	ErrCurrentNotFound = errors.New("Coudln't find the current archive under current dir. Deleted, perhaps?")
-)
-
 func (gui *GUI) Loaded() bool {
 	return gui.State.Archive != nil && reflect.ValueOf(gui.State.Archive).IsNil() == false && gui.State.ArchivePath != ""
 }
 
-func (gui *GUI) RandomPage() {
+// shufflePages orders the pages of the current archive by
+// Config.ShuffleSeed. Each archive gets its own order, which stays the
+// same as long as the seed does.
+func (gui *GUI) shufflePages() {
 	if !gui.Loaded() {
+		gui.State.PageOrder = nil
+		return
+	}
+
+	if gui.Config.ShuffleSeed == 0 {
+		gui.Config.ShuffleSeed = shuffle.NewSeed()
+	}
+	key := gui.State.ArchiveFingerprint
+	if key == "" {
+		key = gui.State.ArchiveName
+	}
+	gui.State.PageOrder = shuffle.New(shuffle.Derive(gui.Config.ShuffleSeed, key), gui.State.Archive.Len())
+}
+
+// Reshuffle picks a new seed and starts over from the first page in
+// the new order.
+func (gui *GUI) Reshuffle() {
+	gui.Config.ShuffleSeed = shuffle.NewSeed()
+	gui.SetRandom(true)
+	if gui.State.PageOrder != nil {
+		gui.SetPage(gui.State.PageOrder.First())
+	}
+	gui.SetStatus(fmt.Sprintf("Shuffled with seed %d", gui.Config.ShuffleSeed))
+}
+
+func (gui *GUI) nextShuffledPage() {
+	next, ok := gui.State.PageOrder.Next(gui.State.ArchivePos)
+	for ok && gui.skippedPage(next) {
+		next, ok = gui.State.PageOrder.Next(next)
+	}
+	if ok {
+		gui.jumpToPage(next)
+		return
+	}
+	if gui.Config.Seamless {
+		gui.NextArchive()
+	}
+}
+
+func (gui *GUI) previousShuffledPage() {
+	prev, ok := gui.State.PageOrder.Prev(gui.State.ArchivePos)
+	for ok && gui.skippedPage(prev) {
+		prev, ok = gui.State.PageOrder.Prev(prev)
+	}
+	if ok {
+		gui.jumpToPage(prev)
 		return
 	}
+	if gui.Config.Seamless {
+		gui.PreviousArchive()
+	}
+}
+
+// archiveOrder returns the shuffled order of the archives in idx.
+// Adding or removing archives changes it.
+func (gui *GUI) archiveOrder(idx *dirIndex) *shuffle.Order {
+	return shuffle.New(shuffle.Derive(gui.Config.ShuffleSeed, idx.dir), len(idx.names))
+}
+
+// shuffledArchiveName is archiveNameRel for seamless shuffling, which
+// goes through the directory in random order too.
+func (gui *GUI) shuffledArchiveName(i int) (string, error) {
+	idx, which, found, err := gui.curArchive()
+	if err != nil {
+		return "", err
+	}
+	if len(idx.names) == 0 {
+		return "", errors.New("No archives in the directory")
+	}
 
-	gui.SetPage(rand.Int() % gui.State.Archive.Len())
+	order := gui.archiveOrder(idx)
+	ok := true
+	switch {
+	case !found && i > 0:
+		which = order.First()
+	case !found:
+		which = order.Last()
+	case i > 0:
+		which, ok = order.Next(which)
+	default:
+		which, ok = order.Prev(which)
+	}
+	if !ok {
+		return "", errors.New("No more archives in the directory")
+	}
+	return filepath.Join(idx.dir, idx.names[which]), nil
 }
 
 func (gui *GUI) PreviousPage() {
@@ -50,7 +133,7 @@ func (gui *GUI) PreviousPage() {
 	}
 
 	if gui.Config.Random {
-		gui.RandomPage()
+		gui.previousShuffledPage()
 		return
 	}
 
@@ -64,7 +147,7 @@ func (gui *GUI) PreviousPage() {
 		return
 	}
 
-	gui.SetPage(gui.State.ArchivePos - n)
+	gui.SetPage(gui.skipRepeats(gui.State.ArchivePos-n, -1))
 
 	if (gui.Config.DoublePage && gui.forceSinglePage()) && gui.State.Archive.Len()-gui.State.ArchivePos > 1 {
 		// FIXME
@@ -81,21 +164,57 @@ func (gui *GUI) NextPage() {
 	}
 
 	if gui.Config.Random {
-		gui.RandomPage()
+		gui.nextShuffledPage()
 		return
 	}
 
-	n := 1
-	if gui.Config.DoublePage && gui.forceSinglePage() == false && gui.State.Archive.Len() > gui.State.ArchivePos+2 {
-		n = 2
+	start := gui.State.ArchivePos + 1
+	if gui.Config.DoublePage && gui.forceSinglePage() == false && gui.State.Archive.Len() > gui.State.ArchivePosR+1 {
+		// Past the right page, which may be further on than the
+		// left one if repeats are skipped.
+		start = gui.State.ArchivePosR + 1
 	}
 
-	if gui.Config.Seamless && gui.State.Archive.Len()-gui.State.ArchivePos <= n {
-		gui.NextArchive()
-		return
+	next := gui.skipRepeats(start, 1)
+	if next >= gui.State.Archive.Len() {
+		if gui.Config.Seamless {
+			gui.NextArchive()
+			return
+		}
+		if next > start {
+			// Only repeats are left.
+			return
+		}
+	}
+
+	gui.SetPage(next)
+}
+
+// skippedPage reports whether page repeats an earlier one, and repeats
+// are being skipped.
+func (gui *GUI) skippedPage(page int) bool {
+	if !gui.Config.SkipDuplicatePages {
+		return false
+	}
+	_, ok := gui.Scenes.repeats[page]
+	return ok
+}
+
+// skipRepeats steps from page past the pages to skip. The result may
+// be out of range.
+func (gui *GUI) skipRepeats(page, step int) int {
+	for page >= 0 && page < gui.State.Archive.Len() && gui.skippedPage(page) {
+		page += step
 	}
+	return page
+}
 
-	gui.SetPage(gui.State.ArchivePos + n)
+// refreshSpread reloads the spread if its right page is now skipped, or
+// no longer is.
+func (gui *GUI) refreshSpread() {
+	if gui.Loaded() && gui.Config.DoublePage && gui.skipRepeats(gui.State.ArchivePos+1, 1) != gui.State.ArchivePosR {
+		gui.setPage(gui.State.ArchivePos)
+	}
 }
 
 func (gui *GUI) FirstPage() {
@@ -103,6 +222,10 @@ func (gui *GUI) FirstPage() {
 		return
 	}
 
+	if gui.Config.Random {
+		gui.SetPage(gui.State.PageOrder.First())
+		return
+	}
 	gui.SetPage(0)
 }
 
@@ -111,6 +234,11 @@ func (gui *GUI) LastPage() {
 		return
 	}
 
+	if gui.Config.Random {
+		gui.SetPage(gui.State.PageOrder.Last())
+		return
+	}
+
 	if gui.Config.DoublePage && gui.State.Archive.Len() >= 2 {
 		gui.SetPage(gui.State.Archive.Len() - 2)
 	}
@@ -128,19 +256,49 @@ func (gui *GUI) ImageHash(n int) (imgdiff.Hash, bool) {
 		return 0, false
 	}
 
-	return imgdiff.DHash(pixbuf), true
+	hash, err := hashPixbuf(gui.hasher(), pixbuf)
+	gui.Memory.Discard(pixbufBytes(pixbuf))
+	if err != nil {
+		gui.ShowError(err.Error())
+		return 0, false
+	}
+	gui.State.ImageHash[n] = hash
+	gui.holdHashes()
+	return hash, true
+}
+
+// hasher returns the hash used to tell scenes apart.
+func (gui *GUI) hasher() imgdiff.Hasher {
+	if h := imgdiff.Lookup(gui.Config.SceneHash); h != nil {
+		return h
+	}
+	return imgdiff.Difference
+}
 
+// SetSceneHash switches the scene detection algorithm, and indexes
+// the archive again.
+func (gui *GUI) SetSceneHash(name string) {
+	if name == gui.Config.SceneHash || imgdiff.Lookup(name) == nil {
+		return
+	}
+	gui.Config.SceneHash = name
+	if gui.Loaded() {
+		gui.State.ImageHash = make(map[int]imgdiff.Hash)
+		gui.indexScenes()
+		gui.holdHashes()
+	}
 }
 
 func (gui *GUI) NextScene() {
-	if !gui.Loaded() {
+	if !gui.Loaded() || gui.indexedNextScene() {
 		return
 	}
 
-	if gui.State.PixbufL == nil {
+	hash, ok := gui.ImageHash(gui.State.ArchivePos)
+	if !ok {
 		return
 	}
-	hash := imgdiff.DHash(gui.State.PixbufL)
+	hasher := gui.hasher()
 
 	dn := gui.Config.SceneScanSkip
 	if gui.State.Archive.Len()-1-gui.State.ArchivePos <= dn {
@@ -152,11 +310,11 @@ func (gui *GUI) NextScene() {
 		if !ok {
 			return
 		}
-		distance := float32(imgdiff.Distance(hash, h)) / 64
+		distance := float32(hasher.Distance(hash, h))
 
 		if distance > gui.Config.ImageDiffThres {
 			if dn == 1 || n == gui.State.ArchivePos+1 {
-				gui.setPage(n)
+				gui.jumpToPage(n)
 				return
 			}
 
@@ -166,9 +324,9 @@ func (gui *GUI) NextScene() {
 				if !ok {
 					return
 				}
-				d := float32(imgdiff.Distance(hash, h)) / 64
+				d := float32(hasher.Distance(hash, h))
 				if d <= gui.Config.ImageDiffThres {
-					gui.setPage(l + 1)
+					gui.jumpToPage(l + 1)
 					return
 				}
 			}
@@ -178,14 +336,15 @@ func (gui *GUI) NextScene() {
 }
 
 func (gui *GUI) PreviousScene() {
-	if !gui.Loaded() {
+	if !gui.Loaded() || gui.indexedPreviousScene() {
 		return
 	}
 
-	if gui.State.PixbufL == nil {
+	hash, ok := gui.ImageHash(gui.State.ArchivePos)
+	if !ok {
 		return
 	}
-	hash := imgdiff.DHash(gui.State.PixbufL)
+	hasher := gui.hasher()
 
 	dn := gui.Config.SceneScanSkip
 	if gui.State.ArchivePos <= dn {
@@ -197,11 +356,11 @@ func (gui *GUI) PreviousScene() {
 		if !ok {
 			return
 		}
-		distance := float32(imgdiff.Distance(hash, h)) / 64
+		distance := float32(hasher.Distance(hash, h))
 
 		if distance > gui.Config.ImageDiffThres {
 			if dn == 1 || n == gui.State.ArchivePos-1 {
-				gui.setPage(n)
+				gui.jumpToPage(n)
 				return
 			}
 
@@ -211,9 +370,9 @@ func (gui *GUI) PreviousScene() {
 				if !ok {
 					return
 				}
-				d := float32(imgdiff.Distance(hash, h)) / 64
+				d := float32(hasher.Distance(hash, h))
 				if d <= gui.Config.ImageDiffThres {
-					gui.setPage(l - 1)
+					gui.jumpToPage(l - 1)
 					return
 				}
 			}
@@ -245,9 +404,9 @@ func (gui *GUI) PreviousArchive() bool {
 	return true
 }
 
-// Find out the index of current archive in the directory.
-// We need to do this everytime, since filesystem is mutable.
-func (gui *GUI) curArchive() (which int, err error) {
+// Find out the index of current archive in the directory. If it was
+// removed, which is where it used to be, and found is false.
+func (gui *GUI) curArchive() (idx *dirIndex, which int, found bool, err error) {
 	dir, name := filepath.Split(gui.State.ArchivePath)
 	if dir == "" {
 		dir, err = os.Getwd()
@@ -255,58 +414,112 @@ func (gui *GUI) curArchive() (which int, err error) {
 			return
 		}
 	}
-	anames, err := archive.ListArchives(dir)
+
+	idx, err = gui.archiveIndex(filepath.Clean(dir))
 	if err != nil {
 		return
 	}
 
-	which = -1
-	for i := 0; i < len(anames); i++ {
-		if anames[i] == name {
-			which = i
-		}
-	}
-	if which == -1 {
-		return 0, ErrCurrentNotFound
-	}
+	which, found = idx.find(name)
 	return
 }
 
 // Assuming that current archive is the 0th one in the directory,
 // get the name of the ith archive.
-// TODO(utkan): Use inotify to avoid obtaining list from the scratch all the time.
 func (gui *GUI) archiveNameRel(i int) (newname string, err error) {
-	dir, _ := filepath.Split(gui.State.ArchivePath)
-	if dir == "" {
-		dir, err = os.Getwd()
-		if err != nil {
-			return
-		}
-	}
-	anames, err := archive.ListArchives(dir)
-	if err != nil {
-		return
+	if gui.Config.Random && gui.Config.Seamless {
+		return gui.shuffledArchiveName(i)
 	}
 
-	curarch, err := gui.curArchive()
+	idx, curarch, found, err := gui.curArchive()
 	if err != nil {
-		return "", nil
+		return
 	}
 
 	which := curarch + i
-	if which < 0 || which >= len(anames) {
+	if !found && i > 0 {
+		// curarch is already the archive after the removed one.
+		which--
+	}
+	if which < 0 || which >= len(idx.names) {
 		err = errors.New("No more archives in the directory")
 		return
 	}
 
-	newname = filepath.Join(dir, anames[which])
+	newname = filepath.Join(idx.dir, idx.names[which])
 	return
 }
 
 func (gui *GUI) SkipForward() {
-	gui.SetPage(gui.State.ArchivePos + gui.Config.NSkip)
+	gui.jumpToPage(gui.State.ArchivePos + gui.Config.NSkip)
 }
 
 func (gui *GUI) SkipBackward() {
-	gui.SetPage(gui.State.ArchivePos - gui.Config.NSkip)
+	gui.jumpToPage(gui.State.ArchivePos - gui.Config.NSkip)
+}
+
+// jumpToPage goes to page n, recording where we were in the history.
+func (gui *GUI) jumpToPage(n int) {
+	gui.remember()
+	gui.SetPage(n)
+}
+
+// remember records the current page in the history before a jump.
+// Plain page turns aren't recorded, and neither are the slideshow's.
+func (gui *GUI) remember() {
+	if !gui.Loaded() || gui.State.Travelling || gui.Slideshow.advancing {
+		return
+	}
+	gui.History.Push(gui.here())
+	gui.updateHistoryMenu()
+}
+
+func (gui *GUI) here() history.Entry {
+	if !gui.Loaded() {
+		return history.Entry{}
+	}
+	return history.Entry{Path: gui.State.ArchivePath, Page: gui.State.ArchivePos}
+}
+
+// Back and Forward keep the history as it was if the place can't be
+// visited, so that it isn't lost.
+func (gui *GUI) Back() {
+	saved := gui.History
+	if e, ok := gui.History.Back(gui.here()); ok && !gui.visit(e) {
+		gui.History = saved
+	}
+}
+
+func (gui *GUI) Forward() {
+	saved := gui.History
+	if e, ok := gui.History.Forward(gui.here()); ok && !gui.visit(e) {
+		gui.History = saved
+	}
+}
+
+// visit goes to e, and reports whether its archive could be opened.
+func (gui *GUI) visit(e history.Entry) bool {
+	gui.State.Travelling = true
+	defer func() { gui.State.Travelling = false }()
+
+	if gui.State.ArchivePath != e.Path {
+		if !archive.IsRemote(e.Path) {
+			if _, err := os.Stat(e.Path); err != nil {
+				gui.ShowError(err.Error())
+				return false
+			}
+		}
+		gui.LoadArchive(e.Path)
+		if !gui.Loaded() || gui.State.ArchivePath != e.Path {
+			return false
+		}
+	}
+	gui.SetPage(e.Page)
+	gui.updateHistoryMenu()
+	return true
+}
+
+func (gui *GUI) updateHistoryMenu() {
+	gui.MenuItemBack.SetSensitive(gui.History.CanBack())
+	gui.MenuItemForward.SetSensitive(gui.History.CanForward())
 }
@@ -0,0 +1,126 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+)
+
+type atomLink struct {
+	Rel      string `xml:"rel,attr"`
+	Href     string `xml:"href,attr"`
+	Type     string `xml:"type,attr"`
+	Title    string `xml:"title,attr"`
+	Count    int    `xml:"http://vaemendis.net/opds-pse/ns count,attr"`
+	LastRead int    `xml:"http://vaemendis.net/opds-pse/ns lastRead,attr"`
+}
+
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Summary string     `xml:"summary"`
+	Content string     `xml:"content"`
+	Links   []atomLink `xml:"link"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (l *atomLink) link(base *url.URL) Link {
+	rel := l.Rel
+	if rel == "" {
+		rel = "alternate"
+	}
+	return Link{
+		Rel:      rel,
+		Href:     resolve(base, l.Href),
+		Type:     l.Type,
+		Title:    l.Title,
+		Count:    l.Count,
+		LastRead: l.LastRead,
+	}
+}
+
+func atomLinks(links []atomLink, base *url.URL) []Link {
+	ls := make([]Link, len(links))
+	for i := range links {
+		ls[i] = links[i].link(base)
+	}
+	return ls
+}
+
+func parseAtom(data []byte, base *url.URL) (*Feed, error) {
+	var af atomFeed
+	if err := xml.Unmarshal(data, &af); err != nil {
+		return nil, err
+	}
+
+	f := &Feed{
+		ID:      af.ID,
+		Title:   strings.TrimSpace(af.Title),
+		Links:   atomLinks(af.Links, base),
+		Entries: make([]Entry, len(af.Entries)),
+	}
+	for i, ae := range af.Entries {
+		e := Entry{
+			ID:      ae.ID,
+			Title:   strings.TrimSpace(ae.Title),
+			Summary: strings.TrimSpace(ae.Summary),
+			Links:   atomLinks(ae.Links, base),
+		}
+		if e.Summary == "" {
+			e.Summary = strings.TrimSpace(ae.Content)
+		}
+		for _, a := range ae.Authors {
+			e.Authors = append(e.Authors, a.Name)
+		}
+		f.Entries[i] = e
+	}
+	return f, nil
+}
+
+type openSearch struct {
+	URLs []struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// parseOpenSearch returns the Atom search template of an OpenSearch
+// description.
+func parseOpenSearch(r io.Reader, base *url.URL) (string, error) {
+	var os openSearch
+	if err := xml.NewDecoder(r).Decode(&os); err != nil {
+		return "", err
+	}
+	for _, u := range os.URLs {
+		if strings.HasPrefix(u.Type, "application/atom+xml") {
+			return resolve(base, u.Template), nil
+		}
+	}
+	return "", ErrNoSearch
+}
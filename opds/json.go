@@ -0,0 +1,172 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package opds
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// stringList is a JSON value that may be a single string or an array of
+// them, such as the rel of an OPDS 2.0 link.
+type stringList []string
+
+func (s *stringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = stringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// contributors is a list of names given as a string, an object with a
+// name, or an array of either.
+type contributors []string
+
+func (c *contributors) UnmarshalJSON(data []byte) error {
+	var many []json.RawMessage
+	if err := json.Unmarshal(data, &many); err != nil {
+		many = []json.RawMessage{data}
+	}
+	for _, m := range many {
+		var name string
+		if err := json.Unmarshal(m, &name); err == nil {
+			*c = append(*c, name)
+			continue
+		}
+		var obj struct{ Name string }
+		if err := json.Unmarshal(m, &obj); err != nil {
+			return err
+		}
+		*c = append(*c, obj.Name)
+	}
+	return nil
+}
+
+type jsonLink struct {
+	Rel       stringList
+	Href      string
+	Type      string
+	Title     string
+	Templated bool
+	Width     int
+}
+
+type jsonPublication struct {
+	Metadata struct {
+		Identifier  string
+		Title       string
+		Author      contributors
+		Description string
+	}
+	Links  []jsonLink
+	Images []jsonLink
+}
+
+type jsonGroup struct {
+	Navigation   []jsonLink
+	Publications []jsonPublication
+}
+
+type jsonFeed struct {
+	Metadata struct {
+		Title string
+	}
+	Links []jsonLink
+	jsonGroup
+	Groups []jsonGroup
+}
+
+// jsonLinks converts OPDS 2.0 links, with one Link per relation.
+func jsonLinks(links []jsonLink, base *url.URL, defaultRel string) []Link {
+	var ls []Link
+	for _, l := range links {
+		rels := l.Rel
+		if len(rels) == 0 {
+			rels = stringList{defaultRel}
+		}
+		for _, rel := range rels {
+			ls = append(ls, Link{
+				Rel:       rel,
+				Href:      resolve(base, l.Href),
+				Type:      l.Type,
+				Title:     l.Title,
+				Templated: l.Templated,
+			})
+		}
+	}
+	return ls
+}
+
+func parseJSON(data []byte, base *url.URL) (*Feed, error) {
+	var jf jsonFeed
+	if err := json.Unmarshal(data, &jf); err != nil {
+		return nil, err
+	}
+
+	f := &Feed{
+		Title: jf.Metadata.Title,
+		Links: jsonLinks(jf.Links, base, ""),
+	}
+	if self := f.Link("self"); self != nil {
+		f.ID = self.Href
+	}
+
+	for _, g := range append([]jsonGroup{jf.jsonGroup}, jf.Groups...) {
+		for _, l := range g.Navigation {
+			if l.Type == "" {
+				l.Type = "application/opds+json"
+			}
+			f.Entries = append(f.Entries, Entry{
+				ID:    l.Href,
+				Title: l.Title,
+				Links: jsonLinks([]jsonLink{l}, base, "subsection"),
+			})
+		}
+		for _, p := range g.Publications {
+			e := Entry{
+				ID:      p.Metadata.Identifier,
+				Title:   p.Metadata.Title,
+				Authors: p.Metadata.Author,
+				Summary: p.Metadata.Description,
+				Links:   jsonLinks(p.Links, base, ""),
+			}
+			// Images are all covers of different sizes; the
+			// narrowest one makes the thumbnail.
+			thumb := -1
+			for i, img := range p.Images {
+				if len(p.Images) > 1 && img.Width > 0 && (thumb < 0 || img.Width < p.Images[thumb].Width) {
+					thumb = i
+				}
+			}
+			for i, img := range p.Images {
+				img.Rel = stringList{RelImage}
+				if i == thumb {
+					img.Rel = stringList{RelThumbnail}
+				}
+				e.Links = append(e.Links, jsonLinks([]jsonLink{img}, base, "")...)
+			}
+			f.Entries = append(f.Entries, e)
+		}
+	}
+	return f, nil
+}
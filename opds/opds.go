@@ -0,0 +1,294 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package opds is a client for OPDS 1.2 (Atom) and 2.0 (JSON) catalogs,
+// including the OPDS Page Streaming Extension.
+package opds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/salviati/gomics/httpfile"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Link relations we care about.
+const (
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	RelStream      = "http://vaemendis.net/opds-pse/stream"
+	RelSearch      = "search"
+	RelStart       = "start"
+	RelNext        = "next"
+	RelPrevious    = "previous"
+)
+
+var ErrNoSearch = errors.New("The catalog doesn't support searching.")
+
+type Link struct {
+	Rel       string
+	Href      string // absolute
+	Type      string
+	Title     string
+	Templated bool // OPDS 2.0 URI template
+
+	// Page streaming attributes.
+	Count    int
+	LastRead int
+}
+
+type Entry struct {
+	ID      string
+	Title   string
+	Authors []string
+	Summary string
+	Links   []Link
+}
+
+type Feed struct {
+	URL     string
+	ID      string
+	Title   string
+	Links   []Link
+	Entries []Entry
+}
+
+func findLink(links []Link, rel string) *Link {
+	for i := range links {
+		if links[i].Rel == rel {
+			return &links[i]
+		}
+	}
+	return nil
+}
+
+// Link returns the first link of the feed with the given relation, or nil.
+func (f *Feed) Link(rel string) *Link {
+	return findLink(f.Links, rel)
+}
+
+func isFeedType(t string) bool {
+	t = strings.ToLower(t)
+	if strings.Contains(t, "type=entry") {
+		return false
+	}
+	return strings.HasPrefix(t, "application/atom+xml") || strings.HasPrefix(t, "application/opds+json")
+}
+
+// Navigation returns the link to the feed the entry leads to, or nil if
+// the entry is a publication.
+func (e *Entry) Navigation() *Link {
+	for i := range e.Links {
+		l := &e.Links[i]
+		if isFeedType(l.Type) && !strings.HasPrefix(l.Rel, RelAcquisition) {
+			return l
+		}
+	}
+	return nil
+}
+
+var archiveTypes = []string{"application/zip", "application/x-cbz", "application/vnd.comicbook+zip"}
+
+// Acquisition returns the download link of the entry, preferring zip
+// files, or nil.
+func (e *Entry) Acquisition() *Link {
+	var first *Link
+	for i := range e.Links {
+		l := &e.Links[i]
+		if !strings.HasPrefix(l.Rel, RelAcquisition) {
+			continue
+		}
+		if first == nil {
+			first = l
+		}
+		t, _, _ := mime.ParseMediaType(l.Type)
+		for _, at := range archiveTypes {
+			if t == at {
+				return l
+			}
+		}
+	}
+	return first
+}
+
+// Stream returns the page streaming link of the entry, or nil.
+func (e *Entry) Stream() *Link {
+	if l := findLink(e.Links, RelStream); l != nil && l.Count > 0 {
+		return l
+	}
+	return nil
+}
+
+// Thumbnail returns the link to the cover thumbnail, falling back to
+// the full cover, or nil.
+func (e *Entry) Thumbnail() *Link {
+	if l := findLink(e.Links, RelThumbnail); l != nil {
+		return l
+	}
+	return findLink(e.Links, RelImage)
+}
+
+// PageURL returns the URL of the given 0-based page of a stream link.
+// Servers that support it scale the page down to maxWidth pixels.
+func (l *Link) PageURL(page, maxWidth int) string {
+	r := strings.NewReplacer("{pageNumber}", strconv.Itoa(page), "{maxWidth}", strconv.Itoa(maxWidth))
+	return r.Replace(l.Href)
+}
+
+// Client fetches catalogs. The zero value uses http.DefaultClient.
+// Credentials are taken from the user info of the URL, and carried over
+// to relative links.
+type Client struct {
+	HTTP *http.Client
+}
+
+const acceptTypes = "application/atom+xml;profile=opds-catalog, application/opds+json, application/atom+xml;q=0.9, application/json;q=0.8"
+
+func (c *Client) get(rawurl, accept string) (*http.Response, error) {
+	req, err := httpfile.NewRequest(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// Get downloads the resource at rawurl, e.g. a cover image.
+func (c *Client) Get(rawurl string) ([]byte, error) {
+	resp, err := c.get(rawurl, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Fetch downloads and parses the feed at rawurl.
+func (c *Client) Fetch(rawurl string) (*Feed, error) {
+	base, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(rawurl, acceptTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *Feed
+	t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasSuffix(t, "json"):
+		f, err = parseJSON(data, base)
+	case strings.HasSuffix(t, "xml"):
+		f, err = parseAtom(data, base)
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		f, err = parseJSON(data, base)
+	default:
+		f, err = parseAtom(data, base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.URL = rawurl
+	return f, nil
+}
+
+// Search runs a search in the catalog f belongs to. OPDS 1.2 catalogs
+// point to an OpenSearch description, OPDS 2.0 ones to a URI template.
+func (c *Client) Search(f *Feed, terms string) (*Feed, error) {
+	l := f.Link(RelSearch)
+	if l == nil {
+		return nil, ErrNoSearch
+	}
+
+	template := l.Href
+	if strings.HasPrefix(l.Type, "application/opensearchdescription+xml") {
+		resp, err := c.get(l.Href, l.Type)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		base, _ := url.Parse(l.Href)
+		if template, err = parseOpenSearch(resp.Body, base); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.Fetch(expandSearch(template, terms))
+}
+
+// expandSearch fills in the search terms of an OpenSearch or OPDS 2.0
+// URI template.
+func expandSearch(template, terms string) string {
+	q := url.QueryEscape(terms)
+	if i := strings.Index(template, "{?query}"); i >= 0 {
+		sep := "?"
+		if strings.Contains(template[:i], "?") {
+			sep = "&"
+		}
+		return template[:i] + sep + "query=" + q + template[i+len("{?query}"):]
+	}
+
+	s := strings.NewReplacer("{searchTerms}", q, "{query}", q).Replace(template)
+	// Drop the optional OpenSearch parameters we don't fill in.
+	return optionalParam.ReplaceAllString(s, "")
+}
+
+var optionalParam = regexp.MustCompile(`\{[^{}]*\?\}`)
+
+// resolve returns href relative to base. Braces of URI templates are
+// kept as they are.
+func resolve(base *url.URL, href string) string {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	s := base.ResolveReference(ref).String()
+	if strings.Contains(href, "{") {
+		s = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(s)
+	}
+	return s
+}
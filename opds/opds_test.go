@@ -0,0 +1,242 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package opds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const rootFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>root</id>
+  <title>Stub catalog</title>
+  <link rel="self" href="/opds/catalog" type="application/atom+xml;profile=opds-catalog;kind=navigation"/>
+  <link rel="search" href="search.xml" type="application/opensearchdescription+xml"/>
+  <entry>
+    <title>All series</title>
+    <id>series</id>
+    <link rel="subsection" href="series" type="application/atom+xml;profile=opds-catalog;kind=acquisition"/>
+  </entry>
+</feed>`
+
+const seriesFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:pse="http://vaemendis.net/opds-pse/ns">
+  <id>series</id>
+  <title>All series</title>
+  <link rel="next" href="series?page=2" type="application/atom+xml;profile=opds-catalog;kind=acquisition"/>
+  <entry>
+    <title>Issue 1</title>
+    <id>book-1</id>
+    <author><name>Someone</name></author>
+    <content type="text">The first one.</content>
+    <link rel="alternate" href="/opds/books/1/entry" type="application/atom+xml;type=entry;profile=opds-catalog"/>
+    <link rel="http://opds-spec.org/acquisition/open-access" href="/opds/books/1/file.pdf" type="application/pdf"/>
+    <link rel="http://opds-spec.org/acquisition" href="/opds/books/1/file" type="application/vnd.comicbook+zip"/>
+    <link rel="http://opds-spec.org/image" href="/opds/books/1/cover"/>
+    <link rel="http://opds-spec.org/image/thumbnail" href="/opds/books/1/thumb"/>
+    <link rel="http://vaemendis.net/opds-pse/stream" type="image/jpeg" pse:count="24" pse:lastRead="3"
+      href="/opds/books/1/pages/{pageNumber}?width={maxWidth}"/>
+  </entry>
+</feed>`
+
+const searchDescription = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <Url type="text/html" template="/web/search?q={searchTerms}"/>
+  <Url type="application/atom+xml;profile=opds-catalog" template="/opds/search?q={searchTerms}&amp;p={startPage?}"/>
+</OpenSearchDescription>`
+
+const jsonCatalog = `{
+  "metadata": {"title": "JSON catalog"},
+  "links": [
+    {"rel": "self", "href": "/opds2/catalog", "type": "application/opds+json"},
+    {"rel": "search", "href": "/opds2/search{?query}", "type": "application/opds+json", "templated": true}
+  ],
+  "navigation": [
+    {"href": "/opds2/new", "title": "New", "type": "application/opds+json"}
+  ],
+  "groups": [{
+    "metadata": {"title": "Featured"},
+    "publications": [{
+      "metadata": {"title": "Issue 2", "identifier": "book-2", "author": [{"name": "Someone"}, "Someone else"]},
+      "links": [{"rel": ["http://opds-spec.org/acquisition"], "href": "/opds2/books/2/file", "type": "application/zip"}],
+      "images": [
+        {"href": "/opds2/books/2/cover", "type": "image/jpeg", "width": 1200},
+        {"href": "/opds2/books/2/thumb", "type": "image/jpeg", "width": 300}
+      ]
+    }]
+  }]
+}`
+
+func stubServer(t *testing.T, queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		*queries = append(*queries, r.URL.RequestURI())
+
+		atom := "application/atom+xml;profile=opds-catalog"
+		var body, typ string
+		switch r.URL.Path {
+		case "/opds/catalog":
+			body, typ = rootFeed, atom
+		case "/opds/series", "/opds/search":
+			body, typ = seriesFeed, atom
+		case "/opds/search.xml":
+			body, typ = searchDescription, "application/opensearchdescription+xml"
+		case "/opds2/catalog", "/opds2/search":
+			body, typ = jsonCatalog, "application/opds+json"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", typ)
+		w.Write([]byte(body))
+	}))
+}
+
+func withAuth(rawurl string) string {
+	return strings.Replace(rawurl, "://", "://user:secret@", 1)
+}
+
+func TestAtom(t *testing.T) {
+	var queries []string
+	ts := stubServer(t, &queries)
+	defer ts.Close()
+	base := withAuth(ts.URL)
+
+	var c Client
+	root, err := c.Fetch(base + "/opds/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Title != "Stub catalog" || len(root.Entries) != 1 {
+		t.Fatalf("root = %+v", root)
+	}
+
+	nav := root.Entries[0].Navigation()
+	if nav == nil || nav.Href != base+"/opds/series" {
+		t.Fatalf("navigation link = %+v", nav)
+	}
+	if root.Entries[0].Acquisition() != nil {
+		t.Errorf("navigation entry has an acquisition link")
+	}
+
+	series, err := c.Fetch(nav.Href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := series.Link(RelNext); next == nil || next.Href != base+"/opds/series?page=2" {
+		t.Errorf("next = %+v", next)
+	}
+
+	book := &series.Entries[0]
+	if book.Navigation() != nil {
+		t.Errorf("publication has a navigation link: %+v", book.Navigation())
+	}
+	if book.Summary != "The first one." || len(book.Authors) != 1 || book.Authors[0] != "Someone" {
+		t.Errorf("book = %+v", book)
+	}
+	if a := book.Acquisition(); a == nil || a.Href != base+"/opds/books/1/file" {
+		t.Errorf("acquisition = %+v", a)
+	}
+	if th := book.Thumbnail(); th == nil || th.Href != base+"/opds/books/1/thumb" {
+		t.Errorf("thumbnail = %+v", th)
+	}
+
+	s := book.Stream()
+	if s == nil || s.Count != 24 || s.LastRead != 3 {
+		t.Fatalf("stream = %+v", s)
+	}
+	if got, want := s.PageURL(5, 800), base+"/opds/books/1/pages/5?width=800"; got != want {
+		t.Errorf("PageURL = %s, want %s", got, want)
+	}
+
+	queries = nil
+	found, err := c.Search(root, "spider man")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != "series" {
+		t.Errorf("search returned %+v", found)
+	}
+	if len(queries) != 2 || queries[1] != "/opds/search?q=spider+man&p=" {
+		t.Errorf("search requests = %q", queries)
+	}
+
+	if _, err := c.Search(series, "x"); err != ErrNoSearch {
+		t.Errorf("Search without a search link: %v", err)
+	}
+	if _, err := c.Fetch(ts.URL + "/opds/catalog"); err == nil {
+		t.Errorf("Fetch without credentials succeeded")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var queries []string
+	ts := stubServer(t, &queries)
+	defer ts.Close()
+	base := withAuth(ts.URL)
+
+	var c Client
+	f, err := c.Fetch(base + "/opds2/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "JSON catalog" || len(f.Entries) != 2 {
+		t.Fatalf("feed = %+v", f)
+	}
+
+	if nav := f.Entries[0].Navigation(); nav == nil || nav.Href != base+"/opds2/new" {
+		t.Errorf("navigation = %+v", nav)
+	}
+
+	book := &f.Entries[1]
+	if book.Title != "Issue 2" || len(book.Authors) != 2 || book.Authors[1] != "Someone else" {
+		t.Errorf("book = %+v", book)
+	}
+	if a := book.Acquisition(); a == nil || a.Href != base+"/opds2/books/2/file" {
+		t.Errorf("acquisition = %+v", a)
+	}
+	if th := book.Thumbnail(); th == nil || th.Href != base+"/opds2/books/2/thumb" {
+		t.Errorf("thumbnail = %+v", th)
+	}
+
+	queries = nil
+	if _, err := c.Search(f, "x-men"); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0] != "/opds2/search?query=x-men" {
+		t.Errorf("search requests = %q", queries)
+	}
+}
+
+func TestExpandSearch(t *testing.T) {
+	tests := []struct{ template, want string }{
+		{"/search?q={searchTerms}", "/search?q=a+b"},
+		{"/search?q={searchTerms}&n={count?}", "/search?q=a+b&n="},
+		{"/search{?query}", "/search?query=a+b"},
+		{"/search?lang=en{?query}", "/search?lang=en&query=a+b"},
+	}
+	for _, tt := range tests {
+		if got := expandSearch(tt.template, "a b"); got != tt.want {
+			t.Errorf("expandSearch(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
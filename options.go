@@ -0,0 +1,181 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Flags that override the configuration for one session. They are
+// never written back to the config file.
+var (
+	pageFlag       = flag.Int("page", 0, "open the archive at page `n`")
+	bookmarkFlag   = flag.String("bookmark", "", "open the bookmark called `name`")
+	doubleFlag     = flag.Bool("double", false, "show two pages side by side")
+	singleFlag     = flag.Bool("single", false, "show one page at a time")
+	mangaFlag      = flag.Bool("manga", false, "read right to left")
+	zoomFlag       = flag.String("zoom", "", "zoom `mode`: bestfit, width, height, original or a percentage such as 150%")
+	fullscreenFlag = flag.Bool("fullscreen", false, "start in fullscreen")
+	configFlag     = flag.String("config", "", "read the configuration from `file`")
+	slideshowFlag  = flag.Duration("slideshow", 0, "start a slideshow, turning the page every `interval` (such as 5s)")
+	loopFlag       = flag.Bool("loop", false, "start the slideshow over at the end")
+	seedFlag       = flag.Int64("seed", 0, "read in the random order given by `seed`")
+)
+
+var zoomModes = map[string]string{
+	"bestfit":  "BestFit",
+	"width":    "FitToWidth",
+	"height":   "FitToHeight",
+	"original": "Original",
+}
+
+// parseZoom returns the zoom mode for the -zoom flag, and the scale for
+// percentages.
+func parseZoom(s string) (mode string, scale float64, err error) {
+	if mode, ok := zoomModes[strings.ToLower(s)]; ok {
+		return mode, 0, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		if p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64); err == nil && p > 0 {
+			return "Original", p / 100, nil
+		}
+	}
+	return "", 0, fmt.Errorf("invalid zoom %q", s)
+}
+
+// checkFlags validates the session flags before the GUI starts.
+func checkFlags() error {
+	if *doubleFlag && *singleFlag {
+		return errors.New("-double and -single are mutually exclusive")
+	}
+	if *pageFlag < 0 {
+		return errors.New("-page must be positive")
+	}
+	if *slideshowFlag < 0 {
+		return errors.New("-slideshow must be positive")
+	}
+	if *zoomFlag != "" {
+		if _, _, err := parseZoom(*zoomFlag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFlags overrides the configuration with the session flags, and
+// remembers what was overridden so that it isn't saved.
+func (gui *GUI) applyFlags() {
+	base := gui.Config
+
+	if *doubleFlag {
+		gui.Config.DoublePage = true
+	}
+	if *singleFlag {
+		gui.Config.DoublePage = false
+	}
+	if *mangaFlag {
+		gui.Config.MangaMode = true
+	}
+	if *fullscreenFlag {
+		gui.Config.Fullscreen = true
+	}
+	if *zoomFlag != "" {
+		gui.Config.ZoomMode, _, _ = parseZoom(*zoomFlag)
+	}
+	if *slideshowFlag > 0 {
+		gui.Config.SlideshowDelay = slideshowFlag.Seconds()
+	}
+	if *loopFlag {
+		gui.Config.SlideshowLoop = true
+	}
+	if *seedFlag != 0 {
+		gui.Config.Random = true
+		gui.Config.ShuffleSeed = *seedFlag
+	}
+
+	gui.State.ConfigBase = base
+	gui.State.ConfigOverride = gui.Config
+}
+
+// configToSave returns the configuration with the values set by the
+// session flags put back, unless the user has changed them since.
+func (gui *GUI) configToSave() Config {
+	c := gui.Config
+	cur := reflect.ValueOf(&c).Elem()
+	base := reflect.ValueOf(gui.State.ConfigBase)
+	override := reflect.ValueOf(gui.State.ConfigOverride)
+
+	for i := 0; i < cur.NumField(); i++ {
+		b, o, f := base.Field(i).Interface(), override.Field(i).Interface(), cur.Field(i)
+		if !reflect.DeepEqual(b, o) && reflect.DeepEqual(f.Interface(), o) {
+			f.Set(base.Field(i))
+		}
+	}
+	return c
+}
+
+// openFromFlags opens what the command line asks for, once the GUI is
+// up.
+func (gui *GUI) openFromFlags() {
+	if *zoomFlag != "" {
+		_, gui.State.Zoom, _ = parseZoom(*zoomFlag)
+	}
+
+	if *slideshowFlag > 0 {
+		defer gui.StartSlideshow()
+	}
+
+	if *bookmarkFlag != "" {
+		b := gui.Bookmarks.FindByName(*bookmarkFlag)
+		if b == nil {
+			gui.ShowError("No bookmark called " + *bookmarkFlag)
+			log.Println("No bookmark called", *bookmarkFlag)
+			return
+		}
+		gui.JumpToBookmark(b)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		return
+	}
+	gui.LoadArchive(flag.Arg(0))
+	if *pageFlag > 0 {
+		gui.SetPage(*pageFlag - 1)
+	}
+}
+
+// fragmentPage returns the 1-based page given in the fragment of uri,
+// as in file:///comic.cbz#page=12.
+func fragmentPage(uri string) (int, bool) {
+	i := strings.LastIndex(uri, "#")
+	if i < 0 {
+		return 0, false
+	}
+	v, err := url.ParseQuery(uri[i+1:])
+	if err != nil {
+		return 0, false
+	}
+	page, err := strconv.Atoi(v.Get("page"))
+	return page, err == nil && page > 0
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// #cgo pkg-config: gdk-pixbuf-2.0
+// #include <stdlib.h>
+// #include <gdk-pixbuf/gdk-pixbuf.h>
+import "C"
+
+import (
+	"errors"
+	"github.com/gotk3/gotk3/gdk"
+	"unsafe"
+)
+
+// savePixbuf saves p to path in one of the formats gdk-pixbuf can
+// write, such as "png", "jpeg", or "webp" if its loader is installed,
+// with options such as "quality". gotk3 only saves PNG and JPEG.
+func savePixbuf(p *gdk.Pixbuf, path, format string, options map[string]string) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	cformat := C.CString(format)
+	defer C.free(unsafe.Pointer(cformat))
+
+	keys := make([]*C.char, 0, len(options)+1)
+	values := make([]*C.char, 0, len(options)+1)
+	for k, v := range options {
+		ck, cv := C.CString(k), C.CString(v)
+		defer C.free(unsafe.Pointer(ck))
+		defer C.free(unsafe.Pointer(cv))
+		keys = append(keys, ck)
+		values = append(values, cv)
+	}
+	keys = append(keys, nil)
+	values = append(values, nil)
+
+	var gerr *C.GError
+	pixbuf := (*C.GdkPixbuf)(unsafe.Pointer(p.GObject))
+	if C.gdk_pixbuf_savev(pixbuf, cpath, cformat, &keys[0], &values[0], &gerr) == 0 {
+		defer C.g_error_free(gerr)
+		return errors.New(C.GoString((*C.char)(gerr.message)))
+	}
+	return nil
+}
+
+// scalePixbuf renders the part of src, scaled by scaleX and scaleY and
+// moved by offsetX and offsetY, that falls on dest. gotk3 only wraps
+// gdk_pixbuf_scale_simple, which scales the whole of src.
+func scalePixbuf(src, dest *gdk.Pixbuf, offsetX, offsetY, scaleX, scaleY float64, interp gdk.InterpType) {
+	C.gdk_pixbuf_scale(
+		(*C.GdkPixbuf)(unsafe.Pointer(src.GObject)),
+		(*C.GdkPixbuf)(unsafe.Pointer(dest.GObject)),
+		0, 0, C.int(dest.GetWidth()), C.int(dest.GetHeight()),
+		C.double(offsetX), C.double(offsetY), C.double(scaleX), C.double(scaleY),
+		C.GdkInterpType(interp))
+}
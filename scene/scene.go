@@ -0,0 +1,123 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package scene groups the pages of an archive into scenes, runs of
+// similar images as found in CG sets, and caches the page hashes the
+// scenes are computed from.
+package scene
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scene is the run of pages [Start, End).
+type Scene struct {
+	Start, End int
+}
+
+func (s Scene) Len() int {
+	return s.End - s.Start
+}
+
+// Split divides n pages into scenes. A scene starts at every page that
+// differs from the one before it by more than thres, as measured by
+// diff, which returns 0 for identical pages and 1 for unrelated ones.
+func Split(n int, diff func(i, j int) float64, thres float64) []Scene {
+	var scenes []Scene
+	start := 0
+	for i := 1; i < n; i++ {
+		if diff(i-1, i) > thres {
+			scenes = append(scenes, Scene{start, i})
+			start = i
+		}
+	}
+	if n > 0 {
+		scenes = append(scenes, Scene{start, n})
+	}
+	return scenes
+}
+
+// Find returns the index of the scene holding page, or -1.
+func Find(scenes []Scene, page int) int {
+	i := sort.Search(len(scenes), func(i int) bool { return scenes[i].End > page })
+	if i == len(scenes) || scenes[i].Start > page {
+		return -1
+	}
+	return i
+}
+
+// Index holds the hash of every page of an archive.
+type Index struct {
+	Hash   string // the algorithm, so that stale indexes can be told apart
+	Hashes []uint64
+}
+
+var ErrBadFingerprint = errors.New("scene: invalid fingerprint")
+
+// Cache stores indexes in Dir, one file per archive, named after its
+// fingerprint.
+type Cache struct {
+	Dir string
+}
+
+func (c Cache) path(fingerprint string) (string, error) {
+	if fingerprint == "" || strings.ContainsAny(fingerprint, `/\.`) {
+		return "", ErrBadFingerprint
+	}
+	return filepath.Join(c.Dir, fingerprint), nil
+}
+
+// Load returns the index of the archive with the given fingerprint.
+// Errors satisfy os.IsNotExist if it hasn't been saved yet.
+func (c Cache) Load(fingerprint string) (*Index, error) {
+	path, err := c.path(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+func (c Cache) Save(fingerprint string, idx *Index) error {
+	path, err := c.path(fingerprint)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package scene
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	// Pages 0-2, 3 and 4-5 look alike.
+	look := []int{0, 0, 0, 1, 2, 2}
+	diff := func(i, j int) float64 {
+		if look[i] == look[j] {
+			return 0.1
+		}
+		return 0.9
+	}
+
+	got := Split(len(look), diff, 0.4)
+	want := []Scene{{0, 3}, {3, 4}, {4, 6}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for page, scene := range []int{0, 0, 0, 1, 2, 2} {
+		if i := Find(got, page); i != scene {
+			t.Errorf("Find(%d) = %d, want %d", page, i, scene)
+		}
+	}
+	if Find(got, 6) != -1 {
+		t.Error("Find accepted a page out of range")
+	}
+
+	if s := Split(0, diff, 0.4); len(s) != 0 {
+		t.Errorf("got %v for no pages", s)
+	}
+	if s := Split(1, diff, 0.4); !reflect.DeepEqual(s, []Scene{{0, 1}}) {
+		t.Errorf("got %v for one page", s)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := Cache{Dir: t.TempDir() + "/scenes"}
+	fp := "0123abcd-42"
+
+	if _, err := c.Load(fp); !os.IsNotExist(err) {
+		t.Fatalf("Load before Save: %v", err)
+	}
+
+	idx := &Index{Hash: "dhash", Hashes: []uint64{1, 2, 1 << 63}}
+	if err := c.Save(fp, idx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Load(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, idx) {
+		t.Errorf("got %v, want %v", got, idx)
+	}
+
+	if err := c.Save("../escape", idx); err != ErrBadFingerprint {
+		t.Errorf("Save with a path as fingerprint: %v", err)
+	}
+}
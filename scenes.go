@@ -0,0 +1,454 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/dupes"
+	"github.com/salviati/gomics/imgdiff"
+	"github.com/salviati/gomics/scene"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Columns of the scene list.
+const (
+	sceneColumnThumbnail = iota
+	sceneColumnMarkup
+	sceneColumnPage
+)
+
+const sceneThumbnailSize = 96
+
+// Pages this close to an earlier page count as repeats of it. It's
+// far tighter than ImageDiffThres, which would take the variations of
+// a CG for repeats.
+const duplicatePageDistance = 2.0 / 64
+
+// Names of the imgdiff hashers in the preferences.
+var sceneHashLabels = map[string]string{
+	"dhash": "Difference hash",
+	"ahash": "Average hash",
+	"phash": "Perceptual hash (DCT)",
+	"whash": "Wavelet hash",
+	"color": "Colour histogram",
+}
+
+// Cached indexes record the hash they were built with under these
+// names. The difference hash changed since indexes were first cached
+// as "dhash", so those are built again.
+var sceneIndexHashNames = map[string]string{
+	"dhash": "dhash2",
+}
+
+func sceneIndexHashName(h imgdiff.Hasher) string {
+	if name, ok := sceneIndexHashNames[h.Name()]; ok {
+		return name
+	}
+	return h.Name()
+}
+
+var errIndexStopped = errors.New("indexing stopped")
+
+// sceneIndex holds the page hashes of the current archive. They're
+// computed in the background once per archive, and cached on disk by
+// fingerprint.
+type sceneIndex struct {
+	hashes      []imgdiff.Hash // nil until the archive is indexed
+	repeats     map[int]int    // repeated pages to the ones they repeat
+	done, total int            // indexing progress
+	gen         int
+	stop        chan struct{} // closed when gen changes
+	thumbnails  map[int]*gdk.Pixbuf
+	memory      []*budget.Handle // of the thumbnails
+	store       *gtk.ListStore
+	open        bool // the scene list is showing
+}
+
+// reset stops indexing and forgets the current archive.
+func (si *sceneIndex) reset() (int, chan struct{}) {
+	if si.stop != nil {
+		close(si.stop)
+	}
+	si.gen++
+	si.stop = make(chan struct{})
+	si.hashes = nil
+	si.repeats = nil
+	si.done, si.total = 0, 0
+	for _, h := range si.memory {
+		h.Release()
+	}
+	si.memory = nil
+	si.thumbnails = make(map[int]*gdk.Pixbuf)
+	return si.gen, si.stop
+}
+
+func (gui *GUI) sceneCache() scene.Cache {
+	return scene.Cache{Dir: filepath.Join(gui.State.ConfigPath, SceneDir)}
+}
+
+// indexScenes starts hashing the pages of the archive just loaded.
+// Remote archives aren't indexed, as that would download all of them.
+func (gui *GUI) indexScenes() {
+	gen, stop := gui.Scenes.reset()
+	if gui.Scenes.open {
+		gui.showScenes()
+	}
+	if !gui.Loaded() || gui.State.ArchiveFingerprint == "" {
+		return
+	}
+
+	cache := gui.sceneCache()
+	fp := gui.State.ArchiveFingerprint
+	n := gui.State.Archive.Len()
+	hasher := gui.hasher()
+	idx, err := cache.Load(fp)
+	if err == nil && idx.Hash == sceneIndexHashName(hasher) && len(idx.Hashes) == n {
+		hashes := make([]imgdiff.Hash, n)
+		for i, h := range idx.Hashes {
+			hashes[i] = imgdiff.Hash(h)
+		}
+		gui.setSceneHashes(hashes)
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+
+	path, orientation := gui.State.ArchivePath, gui.Config.EmbeddedOrientation
+	gui.Scenes.total = n
+	go func() {
+		hashes, err := hashPages(path, hasher, orientation, gui.Memory, stop, func(done int) {
+			glib.IdleAdd(func() {
+				if gen == gui.Scenes.gen {
+					gui.Scenes.done = done
+					gui.updateScenesStatus()
+				}
+			})
+		})
+		if err != nil {
+			if err != errIndexStopped {
+				log.Println(path+":", err)
+			}
+			return
+		}
+
+		idx := &scene.Index{Hash: sceneIndexHashName(hasher), Hashes: make([]uint64, len(hashes))}
+		for i, h := range hashes {
+			idx.Hashes[i] = uint64(h)
+		}
+		if err := cache.Save(fp, idx); err != nil {
+			log.Println(err)
+		}
+
+		glib.IdleAdd(func() {
+			if gen == gui.Scenes.gen {
+				gui.setSceneHashes(hashes)
+			}
+		})
+	}()
+}
+
+// hashPages hashes every page of the archive at path. It opens the
+// archive on its own so as not to get in the way of the viewer.
+func hashPages(path string, hasher imgdiff.Hasher, orientation bool, mem *budget.Manager, stop chan struct{}, progress func(int)) ([]imgdiff.Hash, error) {
+	ar, err := archive.NewArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	hashes := make([]imgdiff.Hash, ar.Len())
+	for i := range hashes {
+		select {
+		case <-stop:
+			return nil, errIndexStopped
+		default:
+		}
+
+		// A broken page ends up in a scene of its own.
+		pixbuf, err := ar.Load(i, orientation)
+		if err == nil {
+			hashes[i], err = hashPixbuf(hasher, pixbuf)
+			mem.Discard(pixbufBytes(pixbuf))
+		}
+		if err != nil {
+			log.Println(path+":", err)
+		}
+		progress(i + 1)
+	}
+	return hashes, nil
+}
+
+func (gui *GUI) setSceneHashes(hashes []imgdiff.Hash) {
+	gui.Scenes.hashes = hashes
+	for i, h := range hashes {
+		gui.State.ImageHash[i] = h
+	}
+	gui.holdHashes()
+	gui.Scenes.repeats = make(map[int]int)
+	for _, p := range dupes.Pages(hashes, gui.hasher(), duplicatePageDistance) {
+		gui.Scenes.repeats[p.Page] = p.Original
+	}
+	gui.refreshSpread()
+	if gui.Scenes.open {
+		gui.showScenes()
+	}
+}
+
+// sceneList returns the scenes of the current archive, or nil if it
+// hasn't been indexed yet.
+func (gui *GUI) sceneList() []scene.Scene {
+	hashes := gui.Scenes.hashes
+	if hashes == nil {
+		return nil
+	}
+	hasher := gui.hasher()
+	diff := func(i, j int) float64 {
+		return hasher.Distance(hashes[i], hashes[j])
+	}
+	return scene.Split(len(hashes), diff, float64(gui.Config.ImageDiffThres))
+}
+
+// indexedNextScene jumps to the next scene using the index, and
+// reports whether there was one to use.
+func (gui *GUI) indexedNextScene() bool {
+	scenes := gui.sceneList()
+	if scenes == nil {
+		return false
+	}
+	if i := scene.Find(scenes, gui.State.ArchivePos); i >= 0 && i+1 < len(scenes) {
+		gui.jumpToPage(scenes[i+1].Start)
+	}
+	return true
+}
+
+// indexedPreviousScene goes to the start of the current scene, or of
+// the one before if already there.
+func (gui *GUI) indexedPreviousScene() bool {
+	scenes := gui.sceneList()
+	if scenes == nil {
+		return false
+	}
+	i := scene.Find(scenes, gui.State.ArchivePos)
+	if i >= 0 && scenes[i].Start == gui.State.ArchivePos {
+		i--
+	}
+	if i >= 0 {
+		gui.jumpToPage(scenes[i].Start)
+	}
+	return true
+}
+
+func (gui *GUI) initScenesDialog() {
+	gui.ScenesDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+	gui.ScenesDialog.AddButton("_Go", gtk.RESPONSE_ACCEPT)
+	gui.ScenesDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
+	store, err := gtk.ListStoreNew(gdk.PixbufGetType(), glib.TYPE_STRING, glib.TYPE_INT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.Scenes.store = store
+	gui.ScenesTreeView.SetModel(store)
+
+	pixbufRenderer, err := gtk.CellRendererPixbufNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err := gtk.TreeViewColumnNewWithAttribute("", pixbufRenderer, "pixbuf", sceneColumnThumbnail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.ScenesTreeView.AppendColumn(column)
+
+	textRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatal(err)
+	}
+	column, err = gtk.TreeViewColumnNewWithAttribute("", textRenderer, "markup", sceneColumnMarkup)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gui.ScenesTreeView.AppendColumn(column)
+
+	gui.ScenesTreeView.Connect("row-activated", func() {
+		gui.ScenesDialog.Response(gtk.RESPONSE_ACCEPT)
+	})
+}
+
+func (gui *GUI) RunScenesDialog() {
+	if !gui.Loaded() {
+		return
+	}
+
+	gui.Scenes.open = true
+	gui.showScenes()
+	res := gtk.ResponseType(gui.ScenesDialog.Run())
+	gui.ScenesDialog.Hide()
+	gui.Scenes.open = false
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	if page, ok := gui.selectedScene(); ok {
+		gui.jumpToPage(page)
+	}
+}
+
+// showScenes fills the scene list, and starts loading the thumbnails
+// that are missing.
+func (gui *GUI) showScenes() {
+	store := gui.Scenes.store
+	store.Clear()
+	gui.updateScenesStatus()
+
+	scenes := gui.sceneList()
+	if scenes == nil {
+		return
+	}
+
+	current := scene.Find(scenes, gui.State.ArchivePos)
+	var missing []int
+	for i, s := range scenes {
+		markup := fmt.Sprintf("<b>Scene %d</b>\nPage %d", i+1, s.Start+1)
+		if s.Len() > 1 {
+			markup = fmt.Sprintf("<b>Scene %d</b>\nPages %d-%d", i+1, s.Start+1, s.End)
+		}
+		iter := store.Append()
+		store.Set(iter, []int{sceneColumnMarkup, sceneColumnPage}, []interface{}{markup, s.Start})
+		if thumbnail, ok := gui.Scenes.thumbnails[s.Start]; ok {
+			store.SetValue(iter, sceneColumnThumbnail, thumbnail)
+		} else {
+			missing = append(missing, s.Start)
+		}
+
+		if i == current {
+			if sel, err := gui.ScenesTreeView.GetSelection(); err == nil {
+				sel.SelectIter(iter)
+			}
+		}
+	}
+
+	if len(missing) > 0 && gui.Loaded() {
+		gui.loadSceneThumbnails(missing)
+	}
+}
+
+func (gui *GUI) updateScenesStatus() {
+	si := &gui.Scenes
+	switch {
+	case si.hashes != nil:
+		gui.ScenesStatusLabel.SetText(fmt.Sprintf("%d scenes", len(gui.sceneList())))
+	case si.total > 0:
+		gui.ScenesStatusLabel.SetText(fmt.Sprintf("Looking for scenes: page %d of %d", si.done, si.total))
+	default:
+		gui.ScenesStatusLabel.SetText("Scenes aren't available for this archive")
+	}
+}
+
+// loadSceneThumbnails loads the first page of each scene in the
+// background.
+func (gui *GUI) loadSceneThumbnails(pages []int) {
+	gen, stop := gui.Scenes.gen, gui.Scenes.stop
+	path, orientation := gui.State.ArchivePath, gui.Config.EmbeddedOrientation
+	interp := interpolations[gui.Config.Interpolation]
+	mem := gui.Memory
+
+	go func() {
+		ar, err := archive.NewArchive(path)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ar.Close()
+
+		for _, page := range pages {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			pixbuf, err := ar.Load(page, orientation)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), sceneThumbnailSize, sceneThumbnailSize)
+			thumbnail, err := pixbuf.ScaleSimple(w, h, interp)
+			mem.Discard(pixbufBytes(pixbuf))
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			page := page
+			glib.IdleAdd(func() {
+				if gen == gui.Scenes.gen {
+					gui.setSceneThumbnail(page, thumbnail)
+				}
+			})
+		}
+	}()
+}
+
+// setSceneThumbnail shows the thumbnail of a scene, and keeps it for
+// when the list is shown again if there's memory for it.
+func (gui *GUI) setSceneThumbnail(page int, thumbnail *gdk.Pixbuf) {
+	gui.Scenes.thumbnails[page] = thumbnail
+	gui.Scenes.memory = append(gui.Scenes.memory, gui.Memory.Hold(budget.Thumbnails, pixbufBytes(thumbnail), func() {
+		delete(gui.Scenes.thumbnails, page)
+	}))
+
+	store := gui.Scenes.store
+	iter, ok := store.GetIterFirst()
+	for ok {
+		if v, err := store.GetValue(iter, sceneColumnPage); err == nil {
+			if p, err := v.GoValue(); err == nil && p.(int) == page {
+				store.SetValue(iter, sceneColumnThumbnail, thumbnail)
+				return
+			}
+		}
+		ok = store.IterNext(iter)
+	}
+}
+
+func (gui *GUI) selectedScene() (int, bool) {
+	sel, err := gui.ScenesTreeView.GetSelection()
+	if err != nil {
+		return 0, false
+	}
+	_, iter, ok := sel.GetSelected()
+	if !ok {
+		return 0, false
+	}
+	v, err := gui.Scenes.store.GetValue(iter, sceneColumnPage)
+	if err != nil {
+		return 0, false
+	}
+	page, err := v.GoValue()
+	if err != nil {
+		return 0, false
+	}
+	return page.(int), true
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/salviati/gomics/archive"
+	"github.com/salviati/gomics/server"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringsFlag collects the values of a repeated flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+var (
+	serveAddr     string
+	serveRoots    stringsFlag
+	serveUser     string
+	servePassword string
+	serveReadOnly bool
+)
+
+func serveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&serveAddr, "addr", ":8080", "listen on `address`")
+	fs.Var(&serveRoots, "root", "serve the archives under `dir` (repeatable; default: the library roots)")
+	fs.StringVar(&serveUser, "user", "", "require basic authentication as `name`")
+	fs.StringVar(&servePassword, "password", "", "the password for -user (default: $GOMICS_PASSWORD)")
+	fs.BoolVar(&serveReadOnly, "readonly", false, "don't let readers change the reading progress")
+}
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	configPath, err := userConfigPath()
+	if err != nil {
+		return err
+	}
+
+	roots := []string(serveRoots)
+	if len(roots) == 0 {
+		var config Config
+		if err := config.Load(filepath.Join(configPath, ConfigFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		roots = config.LibraryRoots
+	}
+	if len(roots) == 0 {
+		return errors.New("no library roots configured, use -root")
+	}
+
+	password := servePassword
+	if password == "" {
+		password = os.Getenv("GOMICS_PASSWORD")
+	}
+	if serveUser != "" && password == "" {
+		return errors.New("-user needs a password")
+	}
+
+	index, err := Asset("reader.html")
+	if err != nil {
+		return err
+	}
+
+	s := server.New(server.Options{
+		Roots:      roots,
+		Extensions: archive.ArchiveExtensions,
+		Open: func(path string) (server.Book, error) {
+			return archive.NewArchive(path)
+		},
+		Index:         index,
+		User:          serveUser,
+		Password:      password,
+		ReadOnly:      serveReadOnly,
+		ProgressPath:  filepath.Join(configPath, ProgressFile),
+		BookmarksPath: filepath.Join(configPath, BookmarksFile),
+	})
+	defer s.Close()
+
+	fmt.Printf("Serving %s on %s\n", strings.Join(roots, ", "), serveAddr)
+	return http.ListenAndServe(serveAddr, s)
+}
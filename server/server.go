@@ -0,0 +1,569 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package server serves a library of archives over HTTP, with a JSON
+// API and a web reader for browsers.
+//
+// The API, where archives are identified by the IDs returned by the
+// archive list and pages are numbered from 1:
+//
+//	GET  /api/archives                    list the archives
+//	GET  /api/pages?archive=ID            list the pages of an archive
+//	GET  /api/page?archive=ID&page=N      the image of a page
+//	GET  /api/thumbnail?archive=ID&page=N a thumbnail of a page (default: 1)
+//	GET  /api/progress?archive=ID         the reading position
+//	POST /api/progress?archive=ID         set it, from {"Page": N}
+//	GET  /api/bookmarks                   list the bookmarks
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/salviati/gomics/library"
+	"github.com/salviati/gomics/natsort"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Book is an open archive. archive.Archive implements it.
+type Book interface {
+	Len() int
+	Name(i int) (string, error)
+	Open(i int) (io.ReadCloser, error)
+	Close() error
+}
+
+type Options struct {
+	Roots      []string // directories holding the library
+	Extensions []string // of the archives to list, such as ".cbz"
+	Open       func(path string) (Book, error)
+
+	// Index is the page served at /, normally the web reader.
+	Index []byte
+
+	// If User is set, clients must log in with basic authentication.
+	User     string
+	Password string
+
+	// ReadOnly rejects requests that change the reading progress.
+	ReadOnly bool
+
+	ProgressPath  string
+	BookmarksPath string
+}
+
+// How many archives are kept open between requests.
+const maxOpenBooks = 8
+
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu     sync.Mutex
+	books  map[string]*openBook
+	fps    map[string]fingerprint // by archive path
+	thumbs *thumbnailCache
+
+	progressMu sync.Mutex
+}
+
+type openBook struct {
+	Book
+	mu     sync.Mutex // held while the book is in use
+	used   time.Time
+	closed bool
+}
+
+// An Archive is an entry of the archive list.
+type Archive struct {
+	ID   string
+	Name string
+	Dir  string // relative to its root, with forward slashes
+}
+
+type pageList struct {
+	Name  string
+	Pages []string
+}
+
+var errBadID = errors.New("invalid archive ID")
+
+func New(opts Options) *Server {
+	roots := make([]string, len(opts.Roots))
+	for i, root := range opts.Roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		roots[i] = root
+	}
+	opts.Roots = roots
+
+	s := &Server{
+		opts:   opts,
+		mux:    http.NewServeMux(),
+		books:  make(map[string]*openBook),
+		fps:    make(map[string]fingerprint),
+		thumbs: newThumbnailCache(),
+	}
+	s.mux.HandleFunc("/", s.serveIndex)
+	s.mux.HandleFunc("/api/archives", s.serveArchives)
+	s.mux.HandleFunc("/api/pages", s.servePages)
+	s.mux.HandleFunc("/api/page", s.servePage)
+	s.mux.HandleFunc("/api/thumbnail", s.serveThumbnail)
+	s.mux.HandleFunc("/api/progress", s.serveProgress)
+	s.mux.HandleFunc("/api/bookmarks", s.serveBookmarks)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.User != "" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gomics"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.opts.User)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.opts.Password)) == 1
+	return ok && userOK && passwordOK
+}
+
+// Close closes the archives kept open.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	books := s.books
+	s.books = make(map[string]*openBook)
+	s.mu.Unlock()
+
+	for _, b := range books {
+		b.mu.Lock()
+		b.closed = true
+		b.Close()
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case err == errBadID, os.IsNotExist(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(s.opts.Index)
+}
+
+func (s *Server) hasExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range s.opts.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Archives lists the archives under the roots, sorted naturally within
+// each root.
+func (s *Server) Archives() ([]Archive, error) {
+	var list []Archive
+	for i, root := range s.opts.Roots {
+		var ids []string
+		err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				log.Println(err)
+				return nil
+			}
+			if fi.IsDir() && p != root && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if fi.IsDir() || !s.hasExtension(p) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return nil
+			}
+			ids = append(ids, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		natsort.Strings(ids)
+		for _, rel := range ids {
+			dir := path.Dir(rel)
+			if dir == "." {
+				dir = ""
+			}
+			list = append(list, Archive{ID: strconv.Itoa(i) + "/" + rel, Name: path.Base(rel), Dir: dir})
+		}
+	}
+	return list, nil
+}
+
+// resolve returns the path of the archive with the given ID, making
+// sure that it is inside the library.
+func (s *Server) resolve(id string) (string, error) {
+	i := strings.Index(id, "/")
+	if i < 0 {
+		return "", errBadID
+	}
+	n, err := strconv.Atoi(id[:i])
+	if err != nil || n < 0 || n >= len(s.opts.Roots) {
+		return "", errBadID
+	}
+	rel := path.Clean("/" + id[i+1:])[1:]
+	if rel == "" || rel != id[i+1:] || !s.hasExtension(rel) {
+		return "", errBadID
+	}
+	return filepath.Join(s.opts.Roots[n], filepath.FromSlash(rel)), nil
+}
+
+// archiveID is the inverse of resolve. It returns "" for archives that
+// aren't in the library.
+func (s *Server) archiveID(p string) string {
+	for i, root := range s.opts.Roots {
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return strconv.Itoa(i) + "/" + filepath.ToSlash(rel)
+	}
+	return ""
+}
+
+// book returns the archive with the given ID, locked. The caller must
+// call release when done with it. Archives are opened without holding
+// s.mu, so that a slow open doesn't hold up requests for other books.
+func (s *Server) book(id string) (*openBook, string, error) {
+	p, err := s.resolve(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		s.mu.Lock()
+		b, ok := s.books[p]
+		s.mu.Unlock()
+
+		var victim *openBook
+		if !ok {
+			book, err := s.opts.Open(p)
+			if err != nil {
+				return nil, "", err
+			}
+
+			s.mu.Lock()
+			if b, ok = s.books[p]; ok {
+				// Opened by another request in the meantime.
+				victim = &openBook{Book: book}
+			} else {
+				b = &openBook{Book: book, used: time.Now()}
+				s.books[p] = b
+				victim = s.evict()
+			}
+			s.mu.Unlock()
+		}
+
+		if victim != nil {
+			victim.mu.Lock()
+			victim.closed = true
+			victim.Close()
+			victim.mu.Unlock()
+		}
+
+		b.mu.Lock()
+		if !b.closed {
+			b.used = time.Now()
+			return b, p, nil
+		}
+		// Evicted in the meantime.
+		b.mu.Unlock()
+	}
+}
+
+func (b *openBook) release() {
+	b.mu.Unlock()
+}
+
+// evict removes the least recently used book from the cache if it is
+// full, and returns it to be closed. s.mu must be held.
+func (s *Server) evict() *openBook {
+	if len(s.books) <= maxOpenBooks {
+		return nil
+	}
+	var oldest string
+	for p, b := range s.books {
+		if oldest == "" || b.used.Before(s.books[oldest].used) {
+			oldest = p
+		}
+	}
+	b := s.books[oldest]
+	delete(s.books, oldest)
+	return b
+}
+
+// pageArg returns the 0-based index of the page given in the request.
+func pageArg(r *http.Request, b Book, def int) (int, error) {
+	n := def
+	if v := r.FormValue("page"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			return 0, errors.New("invalid page number")
+		}
+	}
+	if n < 1 || n > b.Len() {
+		return 0, errors.New("page out of range")
+	}
+	return n - 1, nil
+}
+
+func (s *Server) serveArchives(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Archives()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if list == nil {
+		list = []Archive{}
+	}
+	writeJSON(w, list)
+}
+
+func (s *Server) servePages(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("archive")
+	b, _, err := s.book(id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer b.release()
+
+	list := pageList{Name: path.Base(id), Pages: make([]string, b.Len())}
+	for i := range list.Pages {
+		if list.Pages[i], err = b.Name(i); err != nil {
+			httpError(w, err)
+			return
+		}
+	}
+	writeJSON(w, list)
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	b, _, err := s.book(r.FormValue("archive"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer b.release()
+
+	i, err := pageArg(r, b, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := b.Name(i)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	rc, err := b.Open(i)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	// Without a known extension, the content type is sniffed from the
+	// first bytes written.
+	if t := mime.TypeByExtension(strings.ToLower(path.Ext(name))); t != "" {
+		w.Header().Set("Content-Type", t)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	io.Copy(w, rc)
+}
+
+func (s *Server) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("archive")
+	b, _, err := s.book(id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	i, err := pageArg(r, b, 1)
+	if err != nil {
+		b.release()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := id + "\x00" + strconv.Itoa(i)
+	data, ok := s.thumbs.get(key)
+	if !ok {
+		data, err = thumbnail(b, i)
+		if err != nil {
+			b.release()
+			httpError(w, err)
+			return
+		}
+		s.thumbs.put(key, data)
+	}
+	b.release()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(data)
+}
+
+// fingerprint returns the fingerprint of the archive at p, computing
+// it only once.
+// fingerprint is the fingerprint of an archive, as long as it keeps the
+// size and modification time it had when it was computed.
+type fingerprint struct {
+	fp      string
+	size    int64
+	modTime time.Time
+}
+
+func (s *Server) fingerprint(p string) (string, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	cached, ok := s.fps[p]
+	s.mu.Unlock()
+	if ok && cached.size == fi.Size() && cached.modTime.Equal(fi.ModTime()) {
+		return cached.fp, nil
+	}
+
+	fp, err := library.Fingerprint(p)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.fps[p] = fingerprint{fp: fp, size: fi.Size(), modTime: fi.ModTime()}
+	s.mu.Unlock()
+	return fp, nil
+}
+
+func (s *Server) serveProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && s.opts.ReadOnly {
+		http.Error(w, "The server is read-only", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, p, err := s.book(r.FormValue("archive"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	total := b.Len()
+	b.release()
+
+	fp, err := s.fingerprint(p)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	// The GUI may be running too, so the file is read again for every
+	// request rather than kept in memory.
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+
+	var progress library.Progress
+	if err := progress.Load(s.opts.ProgressPath); err != nil && !os.IsNotExist(err) {
+		httpError(w, err)
+		return
+	}
+
+	if r.Method == "GET" {
+		pos, _ := progress.Get(fp)
+		writeJSON(w, pos)
+		return
+	}
+
+	var req struct{ Page uint }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Page < 1 || int(req.Page) > total {
+		http.Error(w, "invalid page", http.StatusBadRequest)
+		return
+	}
+	pos := library.Position{Path: p, Page: req.Page, TotalPages: uint(total), Updated: time.Now()}
+	progress.Set(fp, pos)
+	if err := progress.Save(s.opts.ProgressPath); err != nil {
+		httpError(w, err)
+		return
+	}
+	writeJSON(w, pos)
+}
+
+// bookmark is a bookmark as listed by the API, with the ID of its
+// archive if it is in the library.
+type bookmark struct {
+	library.Bookmark
+	Archive string `json:",omitempty"`
+}
+
+func (s *Server) serveBookmarks(w http.ResponseWriter, r *http.Request) {
+	var bs library.Bookmarks
+	if err := bs.Load(s.opts.BookmarksPath); err != nil && !os.IsNotExist(err) {
+		httpError(w, err)
+		return
+	}
+
+	list := make([]bookmark, len(bs.Bookmarks))
+	for i, b := range bs.Bookmarks {
+		b.Thumbnail = ""
+		list[i] = bookmark{Bookmark: b, Archive: s.archiveID(b.Path)}
+	}
+	writeJSON(w, list)
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/salviati/gomics/library"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipBook is a minimal Book for the tests. Pages are kept in the order
+// they were written.
+type zipBook struct {
+	f     *os.File
+	files []*zip.File
+}
+
+func openZip(path string) (Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &zipBook{f: f, files: zr.File}, nil
+}
+
+func (b *zipBook) Len() int                          { return len(b.files) }
+func (b *zipBook) Name(i int) (string, error)        { return b.files[i].Name, nil }
+func (b *zipBook) Open(i int) (io.ReadCloser, error) { return b.files[i].Open() }
+func (b *zipBook) Close() error                      { return b.f.Close() }
+
+func testPNG(t *testing.T, w, h int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeZip(t *testing.T, path string, pages map[string][]byte, order []string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for _, name := range order {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(pages[name])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+type testServer struct {
+	*httptest.Server
+	t    *testing.T
+	dir  string
+	page []byte
+}
+
+func newTestServer(t *testing.T, opts Options) *testServer {
+	dir, err := os.MkdirTemp("", "gomics-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "library")
+
+	page := testPNG(t, 600, 300, color.RGBA{255, 0, 0, 255})
+	pages := map[string][]byte{"01.png": page, "02.png": testPNG(t, 10, 10, color.White)}
+	for _, name := range []string{"b/issue 10.cbz", "b/issue 2.cbz", "a.cbz"} {
+		writeZip(t, filepath.Join(root, name), pages, []string{"01.png", "02.png"})
+	}
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("not an archive"), 0644)
+
+	opts.Roots = []string{root}
+	opts.Extensions = []string{".cbz"}
+	opts.Open = openZip
+	opts.Index = []byte("<html>reader</html>")
+	opts.ProgressPath = filepath.Join(dir, "progress")
+	opts.BookmarksPath = filepath.Join(dir, "bookmarks")
+
+	s := New(opts)
+	ts := &testServer{Server: httptest.NewServer(s), t: t, dir: dir, page: page}
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+		os.RemoveAll(dir)
+	})
+	return ts
+}
+
+func (ts *testServer) do(method, path string, body string, v interface{}) int {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	req.SetBasicAuth("user", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	switch v := v.(type) {
+	case nil:
+	case *[]byte:
+		*v = data
+	default:
+		if resp.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(data, v); err != nil {
+				ts.t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+	}
+	return resp.StatusCode
+}
+
+func query(id string, args ...string) string {
+	s := "?archive=" + url.QueryEscape(id)
+	for _, a := range args {
+		s += "&" + a
+	}
+	return s
+}
+
+func TestServer(t *testing.T) {
+	ts := newTestServer(t, Options{})
+
+	var index []byte
+	if code := ts.do("GET", "/", "", &index); code != http.StatusOK || string(index) != "<html>reader</html>" {
+		t.Errorf("GET / = %d %q", code, index)
+	}
+
+	var archives []Archive
+	ts.do("GET", "/api/archives", "", &archives)
+	var ids []string
+	for _, a := range archives {
+		ids = append(ids, a.ID)
+	}
+	if got, want := strings.Join(ids, ","), "0/a.cbz,0/b/issue 2.cbz,0/b/issue 10.cbz"; got != want {
+		t.Fatalf("archives = %s, want %s", got, want)
+	}
+	if archives[1].Dir != "b" || archives[1].Name != "issue 2.cbz" {
+		t.Errorf("archive = %+v", archives[1])
+	}
+
+	id := archives[1].ID
+	var pages pageList
+	ts.do("GET", "/api/pages"+query(id), "", &pages)
+	if len(pages.Pages) != 2 || pages.Pages[0] != "01.png" {
+		t.Errorf("pages = %+v", pages)
+	}
+
+	var page []byte
+	if code := ts.do("GET", "/api/page"+query(id, "page=1"), "", &page); code != http.StatusOK || !bytes.Equal(page, ts.page) {
+		t.Errorf("GET page 1 = %d, %d bytes", code, len(page))
+	}
+	if code := ts.do("GET", "/api/page"+query(id, "page=3"), "", nil); code != http.StatusBadRequest {
+		t.Errorf("GET page 3 = %d", code)
+	}
+
+	var thumb []byte
+	ts.do("GET", "/api/thumbnail"+query(id), "", &thumb)
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || format != "jpeg" || cfg.Width != thumbnailSize || cfg.Height != thumbnailSize/2 {
+		t.Errorf("thumbnail: %v %s %dx%d", err, format, cfg.Width, cfg.Height)
+	}
+
+	var pos library.Position
+	if code := ts.do("POST", "/api/progress"+query(id), `{"Page": 2}`, &pos); code != http.StatusOK {
+		t.Fatalf("POST progress = %d", code)
+	}
+	pos = library.Position{}
+	ts.do("GET", "/api/progress"+query(id), "", &pos)
+	if pos.Page != 2 || pos.TotalPages != 2 {
+		t.Errorf("progress = %+v", pos)
+	}
+	var p library.Progress
+	if err := p.Load(filepath.Join(ts.dir, "progress")); err != nil || len(p.Positions) != 1 {
+		t.Errorf("saved progress: %v %+v", err, p)
+	}
+	if code := ts.do("POST", "/api/progress"+query(id), `{"Page": 3}`, nil); code != http.StatusBadRequest {
+		t.Errorf("POST out of range page = %d", code)
+	}
+}
+
+func TestServerAccess(t *testing.T) {
+	ts := newTestServer(t, Options{User: "user", Password: "secret", ReadOnly: true})
+
+	resp, err := http.Get(ts.URL + "/api/archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without credentials = %d", resp.StatusCode)
+	}
+
+	if code := ts.do("POST", "/api/progress"+query("0/a.cbz"), `{"Page": 1}`, nil); code != http.StatusForbidden {
+		t.Errorf("POST progress on a read-only server = %d", code)
+	}
+	if code := ts.do("GET", "/api/progress"+query("0/a.cbz"), "", nil); code != http.StatusOK {
+		t.Errorf("GET progress on a read-only server = %d", code)
+	}
+
+	for _, id := range []string{"0/../library/a.cbz", "0//a.cbz", "1/a.cbz", "0/notes.txt", "a.cbz", "0/b/../a.cbz"} {
+		if code := ts.do("GET", "/api/pages"+query(id), "", nil); code != http.StatusNotFound {
+			t.Errorf("GET pages of %q = %d", id, code)
+		}
+	}
+}
+
+func TestBookCache(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	s := ts.Config.Handler.(*Server)
+
+	var ids []string
+	for i := 0; i < maxOpenBooks+3; i++ {
+		name := filepath.Join("more", string(rune('a'+i))+".cbz")
+		writeZip(t, filepath.Join(s.opts.Roots[0], name), map[string][]byte{"1.png": ts.page}, []string{"1.png"})
+		ids = append(ids, "0/"+filepath.ToSlash(name))
+	}
+	for _, id := range ids {
+		if code := ts.do("GET", "/api/pages"+query(id), "", nil); code != http.StatusOK {
+			t.Fatalf("GET pages of %s = %d", id, code)
+		}
+	}
+	if n := len(s.books); n != maxOpenBooks {
+		t.Errorf("%d books open, want %d", n, maxOpenBooks)
+	}
+}
+
+// TestSlowOpen checks that a book that is slow to open doesn't hold up
+// requests for other books.
+func TestSlowOpen(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	s := ts.Config.Handler.(*Server)
+
+	opening, proceed := make(chan struct{}), make(chan struct{})
+	s.opts.Open = func(path string) (Book, error) {
+		if filepath.Base(path) == "a.cbz" {
+			close(opening)
+			<-proceed
+		}
+		return openZip(path)
+	}
+
+	slow := make(chan int)
+	go func() {
+		slow <- ts.do("GET", "/api/pages"+query("0/a.cbz"), "", nil)
+	}()
+	<-opening
+
+	fast := make(chan int)
+	go func() {
+		fast <- ts.do("GET", "/api/pages"+query("0/b/issue 2.cbz"), "", nil)
+	}()
+	select {
+	case code := <-fast:
+		if code != http.StatusOK {
+			t.Errorf("GET pages of another book = %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a slow open held up another book")
+	}
+
+	close(proceed)
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("GET pages of the slow book = %d", code)
+	}
+}
+
+func TestFingerprintChanged(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	s := ts.Config.Handler.(*Server)
+	p := filepath.Join(s.opts.Roots[0], "a.cbz")
+
+	fp, err := s.fingerprint(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, p, map[string][]byte{"1.png": ts.page}, []string{"1.png"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(p, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.fingerprint(p); err != nil || changed == fp {
+		t.Errorf("fingerprint of a rewritten archive: %q, %v", changed, err)
+	}
+}
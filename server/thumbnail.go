@@ -0,0 +1,121 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"sync"
+)
+
+const (
+	thumbnailSize    = 240
+	thumbnailQuality = 80
+
+	maxThumbnails = 1024
+)
+
+// thumbnail returns page i of b, scaled down to fit thumbnailSize and
+// encoded as JPEG.
+func thumbnail(b Book, i int) ([]byte, error) {
+	rc, err := b.Open(i)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	img, _, err := image.Decode(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, shrink(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shrink scales img down to fit in a size×size box, averaging the
+// pixels that fall into each pixel of the result.
+func shrink(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= size && sh <= size {
+		return img
+	}
+
+	w, h := size, sh*size/sw
+	if sh > sw {
+		w, h = sw*size/sh, size
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+(y+1)*sh/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*sw/w, b.Min.X+(x+1)*sw/w
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+cr, g+cg, bl+cb, a+ca
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// thumbnailCache keeps encoded thumbnails in memory. It is simply
+// emptied when it fills up.
+type thumbnailCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newThumbnailCache() *thumbnailCache {
+	return &thumbnailCache{data: make(map[string][]byte)}
+}
+
+func (c *thumbnailCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.data[key]
+	return data, ok
+}
+
+func (c *thumbnailCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.data) >= maxThumbnails {
+		c.data = make(map[string][]byte)
+	}
+	c.data[key] = data
+}
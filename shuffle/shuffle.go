@@ -0,0 +1,106 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package shuffle provides reproducible random orderings, so that a
+// shuffled archive reads the same way every time for a given seed.
+package shuffle
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// Order is a permutation of the items 0..n-1.
+type Order struct {
+	Seed int64
+	perm []int // position -> item
+	pos  []int // item -> position
+}
+
+func New(seed int64, n int) *Order {
+	o := &Order{
+		Seed: seed,
+		perm: rand.New(rand.NewSource(seed)).Perm(n),
+		pos:  make([]int, n),
+	}
+	for i, item := range o.perm {
+		o.pos[item] = i
+	}
+	return o
+}
+
+// NewSeed returns a seed for a fresh ordering. It's never 0, which
+// callers can use to mean "no seed yet".
+func NewSeed() int64 {
+	for {
+		if s := rand.New(rand.NewSource(time.Now().UnixNano())).Int63(); s != 0 {
+			return s
+		}
+	}
+}
+
+// Derive returns the seed for the ordering identified by key, so that
+// every archive gets its own order out of a single seed.
+func Derive(seed int64, key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return seed ^ int64(h.Sum64())
+}
+
+func (o *Order) Len() int {
+	return len(o.perm)
+}
+
+// At returns the item at position i.
+func (o *Order) At(i int) int {
+	return o.perm[i]
+}
+
+// Position returns the position of item, or -1 if it's out of range.
+func (o *Order) Position(item int) int {
+	if item < 0 || item >= len(o.pos) {
+		return -1
+	}
+	return o.pos[item]
+}
+
+func (o *Order) First() int {
+	return o.perm[0]
+}
+
+func (o *Order) Last() int {
+	return o.perm[len(o.perm)-1]
+}
+
+// Next returns the item that comes after item, and false if item is
+// the last one.
+func (o *Order) Next(item int) (int, bool) {
+	i := o.Position(item)
+	if i < 0 || i+1 >= len(o.perm) {
+		return 0, false
+	}
+	return o.perm[i+1], true
+}
+
+// Prev returns the item that comes before item, and false if item is
+// the first one.
+func (o *Order) Prev(item int) (int, bool) {
+	i := o.Position(item)
+	if i <= 0 {
+		return 0, false
+	}
+	return o.perm[i-1], true
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package shuffle
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	const n = 50
+	o := New(42, n)
+
+	var seen []int
+	for i := 0; i < o.Len(); i++ {
+		item := o.At(i)
+		if o.Position(item) != i {
+			t.Fatalf("Position(%d) = %d, want %d", item, o.Position(item), i)
+		}
+		seen = append(seen, item)
+	}
+	sort.Ints(seen)
+	for i := range seen {
+		if seen[i] != i {
+			t.Fatalf("not a permutation: %v", seen)
+		}
+	}
+
+	if !reflect.DeepEqual(o.perm, New(42, n).perm) {
+		t.Error("same seed gave a different order")
+	}
+	if reflect.DeepEqual(o.perm, New(43, n).perm) {
+		t.Error("different seeds gave the same order")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	o := New(7, 10)
+
+	var forward []int
+	for item, ok := o.First(), true; ok; item, ok = o.Next(item) {
+		forward = append(forward, item)
+	}
+	if !reflect.DeepEqual(forward, o.perm) {
+		t.Errorf("walking forward gave %v, want %v", forward, o.perm)
+	}
+
+	var backward []int
+	for item, ok := o.Last(), true; ok; item, ok = o.Prev(item) {
+		backward = append([]int{item}, backward...)
+	}
+	if !reflect.DeepEqual(backward, o.perm) {
+		t.Errorf("walking backward gave %v, want %v", backward, o.perm)
+	}
+
+	if _, ok := o.Next(10); ok {
+		t.Error("Next accepted an item out of range")
+	}
+	if o.Position(-1) != -1 {
+		t.Error("Position accepted an item out of range")
+	}
+}
+
+func TestDerive(t *testing.T) {
+	if Derive(1, "a.cbz") == Derive(1, "b.cbz") {
+		t.Error("archives share a seed")
+	}
+	if Derive(1, "a.cbz") != Derive(1, "a.cbz") {
+		t.Error("Derive isn't deterministic")
+	}
+	if NewSeed() == 0 {
+		t.Error("NewSeed returned 0")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Pages are assumed to be this much taller than wide; taller ones
+	// stay up longer when SlideshowScaleTall is set.
+	slideshowPageAspect = 1.5
+	slideshowMaxScale   = 4
+)
+
+type slideshow struct {
+	running   bool
+	advancing bool // set while the slideshow itself turns the page
+	timer     glib.SourceHandle
+	gen       int // invalidates timers that fire after a restart
+}
+
+// StartSlideshow advances the page every Config.SlideshowDelay
+// seconds, until StopSlideshow is called.
+func (gui *GUI) StartSlideshow() {
+	if gui.Slideshow.running {
+		return
+	}
+	gui.Slideshow.running = true
+	gui.MenuItemSlideshow.SetActive(true)
+	gui.SetStatus("Slideshow")
+	gui.scheduleSlide()
+}
+
+func (gui *GUI) StopSlideshow() {
+	if !gui.Slideshow.running {
+		return
+	}
+	gui.Slideshow.running = false
+	gui.Slideshow.gen++
+	glib.SourceRemove(gui.Slideshow.timer)
+	gui.MenuItemSlideshow.SetActive(false)
+}
+
+func (gui *GUI) ToggleSlideshow() {
+	if gui.Slideshow.running {
+		gui.StopSlideshow()
+		gui.SetStatus("Slideshow stopped")
+	} else {
+		gui.StartSlideshow()
+	}
+}
+
+// pauseSlideshow is called when the user turns the page, scrolls or
+// presses a key, so that the slideshow doesn't fight the reader. The
+// timer starts over, and the slideshow goes on once the page has been
+// left alone for as long as it stays up.
+func (gui *GUI) pauseSlideshow() {
+	if !gui.Slideshow.running {
+		return
+	}
+	gui.Slideshow.gen++
+	glib.SourceRemove(gui.Slideshow.timer)
+	gui.scheduleSlide()
+}
+
+func (gui *GUI) scheduleSlide() {
+	gen := gui.Slideshow.gen
+	delay := time.Duration(gui.slideDwell() * float64(time.Second))
+	h, err := glib.TimeoutAdd(uint(delay/time.Millisecond), func() bool {
+		if gen == gui.Slideshow.gen && gui.Slideshow.running {
+			gui.nextSlide()
+		}
+		return false
+	})
+	if err != nil {
+		log.Println(err)
+		gui.StopSlideshow()
+		return
+	}
+	gui.Slideshow.timer = h
+}
+
+// slideDwell returns how long the current page stays up, in seconds.
+func (gui *GUI) slideDwell() float64 {
+	delay := gui.Config.SlideshowDelay
+	if delay <= 0 {
+		delay = 1
+	}
+	if !gui.Config.SlideshowScaleTall || gui.State.PixbufL == nil {
+		return delay
+	}
+
+	// Pages side by side are as tall as the taller of the two.
+	w, h := gui.State.PixbufL.GetWidth(), gui.State.PixbufL.GetHeight()
+	if r := gui.State.PixbufR; r != nil {
+		w += r.GetWidth()
+		if r.GetHeight() > h {
+			h = r.GetHeight()
+		}
+		w /= 2
+	}
+	if w <= 0 {
+		return delay
+	}
+
+	scale := float64(h) / float64(w) / slideshowPageAspect
+	if scale < 1 {
+		scale = 1
+	}
+	if scale > slideshowMaxScale {
+		scale = slideshowMaxScale
+	}
+	return delay * scale
+}
+
+// nextSlide turns the page, starting over or stopping at the end.
+// Random and Seamless are honored by NextPage.
+func (gui *GUI) nextSlide() {
+	gui.Slideshow.advancing = true
+	defer func() { gui.Slideshow.advancing = false }()
+
+	path, pos := gui.State.ArchivePath, gui.State.ArchivePos
+	gui.NextPage()
+
+	if gui.State.ArchivePath == path && gui.State.ArchivePos == pos {
+		if !gui.Config.SlideshowLoop || !gui.rewindSlideshow() {
+			gui.StopSlideshow()
+			gui.SetStatus("Slideshow finished")
+			return
+		}
+	}
+	gui.scheduleSlide()
+}
+
+// rewindSlideshow goes back to the first page, or to the first archive
+// of the directory in seamless mode.
+func (gui *GUI) rewindSlideshow() bool {
+	if !gui.Loaded() {
+		return false
+	}
+	if gui.Config.Seamless {
+		if idx, _, _, err := gui.curArchive(); err == nil && len(idx.names) > 0 {
+			first := 0
+			if gui.Config.Random {
+				first = gui.archiveOrder(idx).First()
+			}
+			gui.LoadArchive(filepath.Join(idx.dir, idx.names[first]))
+			if !gui.Loaded() {
+				return false
+			}
+		}
+	}
+	gui.FirstPage()
+	return true
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tile works out which tiles of a scaled image are in view, and
+// which level of a mipmap pyramid to scale them from, and keeps the
+// tiles that were drawn within a memory budget.
+package tile
+
+import (
+	"github.com/salviati/gomics/budget"
+	"image"
+)
+
+// Size is the width and height of a tile, in pixels of the scaled
+// image. Tiles on the right and bottom edges are smaller.
+const Size = 256
+
+// Level returns the level of the pyramid to scale from at scale, where
+// level k is the image halved k times: the smallest level that's still
+// at least as large as the result, so that it's only ever scaled down.
+func Level(scale float64) int {
+	k := 0
+	for scale > 0 && scale <= 0.5 {
+		scale *= 2
+		k++
+	}
+	return k
+}
+
+// LevelSize returns the size of level k of an image of size w x h.
+func LevelSize(w, h, k int) (int, int) {
+	for ; k > 0; k-- {
+		w, h = (w+1)/2, (h+1)/2
+	}
+	return w, h
+}
+
+// Visible returns the tiles of an image of size, as scaled, that
+// intersect r, by column and row.
+func Visible(r image.Rectangle, size image.Point) []image.Point {
+	r = r.Intersect(image.Rectangle{Max: size})
+	if r.Empty() {
+		return nil
+	}
+	var tiles []image.Point
+	for y := r.Min.Y / Size; y <= (r.Max.Y-1)/Size; y++ {
+		for x := r.Min.X / Size; x <= (r.Max.X-1)/Size; x++ {
+			tiles = append(tiles, image.Pt(x, y))
+		}
+	}
+	return tiles
+}
+
+// Bounds returns the pixels of the scaled image, of size, that tile t
+// covers.
+func Bounds(t image.Point, size image.Point) image.Rectangle {
+	r := image.Rect(t.X*Size, t.Y*Size, (t.X+1)*Size, (t.Y+1)*Size)
+	return r.Intersect(image.Rectangle{Max: size})
+}
+
+// Key identifies a tile of an image at a scale. Image is any value
+// that can be a map key, and tells apart everything that changes how
+// the image looks.
+type Key struct {
+	Image interface{}
+	Scale float64
+	Tile  image.Point
+}
+
+type cached struct {
+	value interface{}
+	mem   *budget.Handle
+}
+
+// Cache keeps tiles for as long as the memory budget allows, as scaled
+// images.
+type Cache struct {
+	m     *budget.Manager
+	tiles map[Key]*cached
+}
+
+func NewCache(m *budget.Manager) *Cache {
+	return &Cache{m: m, tiles: make(map[Key]*cached)}
+}
+
+func (c *Cache) Get(k Key) (interface{}, bool) {
+	t, ok := c.tiles[k]
+	if !ok {
+		return nil, false
+	}
+	t.mem.Touch()
+	return t.value, true
+}
+
+// Put adds a tile of size bytes.
+func (c *Cache) Put(k Key, v interface{}, size int) {
+	if t, ok := c.tiles[k]; ok {
+		t.mem.Release()
+	}
+	t := &cached{value: v}
+	c.tiles[k] = t
+	t.mem = c.m.Hold(budget.Scaled, int64(size), func() {
+		if c.tiles[k] == t {
+			delete(c.tiles, k)
+		}
+	})
+}
+
+// Drop drops the tiles of the images drop returns true for.
+func (c *Cache) Drop(drop func(image interface{}) bool) {
+	for k, t := range c.tiles {
+		if drop(k.Image) {
+			t.mem.Release()
+			delete(c.tiles, k)
+		}
+	}
+}
+
+// Len returns the number of tiles in the cache.
+func (c *Cache) Len() int { return len(c.tiles) }
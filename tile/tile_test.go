@@ -0,0 +1,97 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tile
+
+import (
+	"github.com/salviati/gomics/budget"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	for _, c := range []struct {
+		scale float64
+		want  int
+	}{
+		{2, 0}, {1, 0}, {0.75, 0}, {0.51, 0}, {0.5, 1}, {0.3, 1}, {0.25, 2}, {0.1, 3}, {0, 0},
+	} {
+		if got := Level(c.scale); got != c.want {
+			t.Errorf("Level(%v) = %d, want %d", c.scale, got, c.want)
+		}
+	}
+	if w, h := LevelSize(1001, 10, 2); w != 251 || h != 3 {
+		t.Errorf("LevelSize(1001, 10, 2) = %d, %d, want 251, 3", w, h)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	size := image.Pt(600, 300)
+	for _, c := range []struct {
+		r    image.Rectangle
+		want []image.Point
+	}{
+		{image.Rect(0, 0, 256, 256), []image.Point{{0, 0}}},
+		{image.Rect(250, 250, 520, 400), []image.Point{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}, {2, 1}}},
+		{image.Rect(-50, -50, 10, 10), []image.Point{{0, 0}}},
+		{image.Rect(600, 0, 900, 100), nil},
+	} {
+		if got := Visible(c.r, size); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Visible(%v) = %v, want %v", c.r, got, c.want)
+		}
+	}
+	if got, want := Bounds(image.Pt(2, 1), size), image.Rect(512, 256, 600, 300); got != want {
+		t.Errorf("Bounds = %v, want %v", got, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	m := budget.New(300)
+	c := NewCache(m)
+	key := func(img, x int) Key { return Key{Image: img, Scale: 1, Tile: image.Pt(x, 0)} }
+
+	c.Put(key(1, 0), "a", 100)
+	c.Put(key(1, 1), "b", 100)
+	c.Put(key(2, 0), "c", 100)
+	if _, ok := c.Get(key(1, 0)); !ok {
+		t.Fatal("a was dropped early")
+	}
+
+	// b is the least recently used now.
+	c.Put(key(2, 1), "d", 100)
+	if _, ok := c.Get(key(1, 1)); ok {
+		t.Error("b wasn't dropped")
+	}
+	if held := m.Stats().Held[budget.Scaled]; c.Len() != 3 || held != 300 {
+		t.Errorf("Len, held = %d, %d, want 3, 300", c.Len(), held)
+	}
+
+	c.Put(key(2, 1), "e", 50)
+	if v, _ := c.Get(key(2, 1)); v != "e" || m.Stats().Held[budget.Scaled] != 250 {
+		t.Errorf("replaced tile = %v, with %d bytes held", v, m.Stats().Held[budget.Scaled])
+	}
+
+	c.Drop(func(image interface{}) bool { return image == 2 })
+	if held := m.Stats().Held[budget.Scaled]; c.Len() != 1 || held != 100 {
+		t.Errorf("after Drop: Len, held = %d, %d, want 1, 100", c.Len(), held)
+	}
+
+	// A tile larger than the budget doesn't stay.
+	c.Put(key(3, 0), "big", 1000)
+	if _, ok := c.Get(key(3, 0)); ok || c.Len() != 0 {
+		t.Errorf("big tile kept, Len %d", c.Len())
+	}
+}
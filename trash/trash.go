@@ -0,0 +1,203 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package trash moves files to the desktop trash, following the
+// FreeDesktop.org trash specification, so that they can be restored
+// from the file manager.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrOtherDevice = errors.New("trash: the file is on another filesystem than the trash")
+
+// Dir returns the trash of the current user.
+func Dir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
+		return filepath.Join(d, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Move moves path to the trash returned by Locate.
+func Move(path string) error {
+	dir, err := Locate(path)
+	if err != nil {
+		return err
+	}
+	return MoveTo(dir, path, time.Now())
+}
+
+// Locate returns the trash path would be moved to: the trash of the
+// current user if path is on the same filesystem, or else a trash at
+// the top directory of the filesystem of path, created if need be.
+func Locate(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	home, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	dev, ok := device(fi)
+	if !ok {
+		return home, nil
+	}
+	// The trash of the user may not exist yet; its closest existing
+	// parent is where it would be created.
+	for d := home; ; d = filepath.Dir(d) {
+		if fi, err := os.Stat(d); err == nil {
+			if hdev, ok := device(fi); !ok || hdev == dev {
+				return home, nil
+			}
+			break
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	return topTrash(topDir(filepath.Dir(path), dev))
+}
+
+// topDir returns the top directory of the filesystem dir is on, which
+// is the device dev.
+func topDir(dir string, dev uint64) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		fi, err := os.Stat(parent)
+		if err != nil {
+			return dir
+		}
+		if pdev, ok := device(fi); !ok || pdev != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// topTrash returns the trash of the current user in the top directory
+// top: $top/.Trash/$uid if $top/.Trash is a sticky directory shared by
+// all users, or else $top/.Trash-$uid.
+func topTrash(top string) (string, error) {
+	uid := strconv.Itoa(os.Getuid())
+
+	shared := filepath.Join(top, ".Trash")
+	if fi, err := os.Lstat(shared); err == nil && fi.IsDir() && fi.Mode()&os.ModeSticky != 0 {
+		if dir, err := privateDir(filepath.Join(shared, uid)); err == nil {
+			return dir, nil
+		}
+	}
+	return privateDir(filepath.Join(top, ".Trash-"+uid))
+}
+
+// privateDir creates dir if it doesn't exist, and checks that it's a
+// directory rather than a link to somewhere else.
+func privateDir(dir string) (string, error) {
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("trash: %s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// MoveTo moves path to the trash in dir, recording that it was deleted
+// at the given time.
+func MoveTo(dir, path string, deleted time.Time) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+
+	files, info := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	for _, d := range []string{files, info} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return err
+		}
+	}
+
+	trashinfo := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: path}).EscapedPath(), deleted.Format("2006-01-02T15:04:05"))
+
+	// The info file is created first and exclusively, which reserves
+	// the name in files/.
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+		infoPath := filepath.Join(info, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(trashinfo)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			if _, serr := os.Lstat(filepath.Join(files, name)); serr == nil {
+				// Left behind by something else.
+				os.Remove(infoPath)
+				continue
+			}
+			err = os.Rename(path, filepath.Join(files, name))
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			if le, ok := err.(*os.LinkError); ok && le.Err == syscall.EXDEV {
+				return ErrOtherDevice
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMoveTo(t *testing.T) {
+	dir := t.TempDir()
+	trash := filepath.Join(dir, "Trash")
+	deleted := time.Date(2018, 3, 4, 5, 6, 7, 0, time.Local)
+
+	var paths []string
+	for i := 0; i < 2; i++ {
+		// Two files of the same name, from different directories.
+		sub := filepath.Join(dir, "dir "+string(rune('a'+i)))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(sub, "ch 1.cbz")
+		if err := os.WriteFile(p, []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := MoveTo(trash, p, deleted); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s is still there", p)
+		}
+		paths = append(paths, p)
+	}
+
+	for i, name := range []string{"ch 1.cbz", "ch 1.2.cbz"} {
+		data, err := os.ReadFile(filepath.Join(trash, "files", name))
+		if err != nil || len(data) != 1 || data[0] != byte(i) {
+			t.Errorf("files/%s: %v %v", name, data, err)
+		}
+		info, err := os.ReadFile(filepath.Join(trash, "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "[Trash Info]\nPath=" + strings.Replace(paths[i], " ", "%20", -1) + "\nDeletionDate=2018-03-04T05:06:07\n"
+		if string(info) != want {
+			t.Errorf("info/%s.trashinfo is\n%s\nwant\n%s", name, info, want)
+		}
+	}
+
+	if err := MoveTo(trash, filepath.Join(dir, "missing.cbz"), deleted); !os.IsNotExist(err) {
+		t.Errorf("moving a missing file: %v", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	if d, err := Dir(); err != nil || d != "/data/Trash" {
+		t.Errorf("Dir() = %q, %v", d, err)
+	}
+}
+
+func TestTopTrash(t *testing.T) {
+	uid := strconv.Itoa(os.Getuid())
+
+	top := t.TempDir()
+	if d, err := topTrash(top); err != nil || d != filepath.Join(top, ".Trash-"+uid) {
+		t.Errorf("without .Trash: %q, %v", d, err)
+	}
+
+	// .Trash is only shared if it's sticky.
+	shared := filepath.Join(top, ".Trash")
+	if err := os.Mkdir(shared, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := topTrash(top); err != nil || d != filepath.Join(top, ".Trash-"+uid) {
+		t.Errorf("with a .Trash that isn't sticky: %q, %v", d, err)
+	}
+	if err := os.Chmod(shared, 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := topTrash(top); err != nil || d != filepath.Join(shared, uid) {
+		t.Errorf("with a sticky .Trash: %q, %v", d, err)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	p := filepath.Join(dir, "a.cbz")
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// On the filesystem of the trash of the user, which doesn't exist
+	// yet.
+	if d, err := Locate(p); err != nil || d != filepath.Join(dir, "data", "Trash") {
+		t.Errorf("Locate(%q) = %q, %v", p, d, err)
+	}
+}
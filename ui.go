@@ -13,7 +13,7 @@
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <http://www.gnu.org/licenses/>.
 
-//go:generate go-bindata about.jpg icon.png gomics.glade
+//go:generate go-bindata about.jpg icon.png gomics.glade reader.html
 
 package main
 
@@ -21,9 +21,17 @@ import (
 	"fmt"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/history"
+	"github.com/salviati/gomics/imgdiff"
+	"github.com/salviati/gomics/ipc"
+	"github.com/salviati/gomics/library"
+	"github.com/salviati/gomics/tile"
 	"log"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 )
 
 type GUI struct {
@@ -33,15 +41,58 @@ type GUI struct {
 	ScrolledWindow                 *gtk.ScrolledWindow    `build:"ScrolledWindow"`
 	Viewport                       *gtk.Viewport          `build:"Viewport"`
 	ImageBox                       *gtk.Box               `build:"ImageBox"`
-	ImageL                         *gtk.Image             `build:"ImageL"`
-	ImageR                         *gtk.Image             `build:"ImageR"`
+	ImageL                         *gtk.DrawingArea       `build:"ImageL"`
+	ImageR                         *gtk.DrawingArea       `build:"ImageR"`
 	Statusbar                      *gtk.Statusbar         `build:"Statusbar"`
 	AboutDialog                    *gtk.AboutDialog       `build:"AboutDialog"`
 	MenuItemAbout                  *gtk.MenuItem          `build:"MenuItemAbout"`
+	MenuItemMemoryUsage            *gtk.MenuItem          `build:"MenuItemMemoryUsage"`
 	MenuItemOpen                   *gtk.MenuItem          `build:"MenuItemOpen"`
+	MenuItemOpenURL                *gtk.MenuItem          `build:"MenuItemOpenURL"`
+	OpenURLDialog                  *gtk.Dialog            `build:"OpenURLDialog"`
+	OpenURLEntry                   *gtk.Entry             `build:"OpenURLEntry"`
+	MenuItemCatalog                *gtk.MenuItem          `build:"MenuItemCatalog"`
+	CatalogDialog                  *gtk.Dialog            `build:"CatalogDialog"`
+	CatalogBackButton              *gtk.Button            `build:"CatalogBackButton"`
+	CatalogURLEntry                *gtk.Entry             `build:"CatalogURLEntry"`
+	CatalogSearchEntry             *gtk.SearchEntry       `build:"CatalogSearchEntry"`
+	CatalogTreeView                *gtk.TreeView          `build:"CatalogTreeView"`
+	MenuItemFindDuplicates         *gtk.MenuItem          `build:"MenuItemFindDuplicates"`
+	MenuItemConvert                *gtk.MenuItem          `build:"MenuItemConvert"`
+	ConvertDialog                  *gtk.Dialog            `build:"ConvertDialog"`
+	ConvertLabel                   *gtk.Label             `build:"ConvertLabel"`
+	ConvertWidthSpinButton         *gtk.SpinButton        `build:"ConvertWidthSpinButton"`
+	ConvertQualitySpinButton       *gtk.SpinButton        `build:"ConvertQualitySpinButton"`
+	ConvertReplaceCheckButton      *gtk.CheckButton       `build:"ConvertReplaceCheckButton"`
+	DupesFolderDialog              *gtk.FileChooserDialog `build:"DupesFolderDialog"`
+	DupesDialog                    *gtk.Dialog            `build:"DupesDialog"`
+	DupesTreeView                  *gtk.TreeView          `build:"DupesTreeView"`
+	DupesPreviewBox                *gtk.Box               `build:"DupesPreviewBox"`
+	DupesStatusLabel               *gtk.Label             `build:"DupesStatusLabel"`
+	CatalogStatusLabel             *gtk.Label             `build:"CatalogStatusLabel"`
+	CatalogPreviousButton          *gtk.Button            `build:"CatalogPreviousButton"`
+	CatalogNextButton              *gtk.Button            `build:"CatalogNextButton"`
 	MenuItemClose                  *gtk.MenuItem          `build:"MenuItemClose"`
 	MenuItemQuit                   *gtk.MenuItem          `build:"MenuItemQuit"`
-	MenuItemSaveImage              *gtk.MenuItem          `build:"MenuItemSaveImage"`
+	MenuItemExport                 *gtk.MenuItem          `build:"MenuItemExport"`
+	MenuItemEditPages              *gtk.MenuItem          `build:"MenuItemEditPages"`
+	EditDialog                     *gtk.Dialog            `build:"EditDialog"`
+	EditIconView                   *gtk.IconView          `build:"EditIconView"`
+	EditInsertButton               *gtk.Button            `build:"EditInsertButton"`
+	EditDeleteButton               *gtk.Button            `build:"EditDeleteButton"`
+	EditStatusLabel                *gtk.Label             `build:"EditStatusLabel"`
+	EditInsertDialog               *gtk.FileChooserDialog `build:"EditInsertDialog"`
+	MenuItemCopyImage              *gtk.MenuItem          `build:"MenuItemCopyImage"`
+	ExportDialog                   *gtk.Dialog            `build:"ExportDialog"`
+	ExportPageRadioButton          *gtk.RadioButton       `build:"ExportPageRadioButton"`
+	ExportSpreadRadioButton        *gtk.RadioButton       `build:"ExportSpreadRadioButton"`
+	ExportRangeRadioButton         *gtk.RadioButton       `build:"ExportRangeRadioButton"`
+	ExportRangeEntry               *gtk.Entry             `build:"ExportRangeEntry"`
+	ExportFormatComboBoxText       *gtk.ComboBoxText      `build:"ExportFormatComboBoxText"`
+	ExportQualityLabel             *gtk.Label             `build:"ExportQualityLabel"`
+	ExportQualitySpinButton        *gtk.SpinButton        `build:"ExportQualitySpinButton"`
+	ExportFolderChooserButton      *gtk.FileChooserButton `build:"ExportFolderChooserButton"`
+	ExportTemplateEntry            *gtk.Entry             `build:"ExportTemplateEntry"`
 	FileChooserDialogArchive       *gtk.FileChooserDialog `build:"FileChooserDialogArchive"`
 	Toolbar                        *gtk.Toolbar           `build:"Toolbar"`
 	ButtonNextPage                 *gtk.ToolButton        `build:"ButtonNextPage"`
@@ -67,12 +118,24 @@ type GUI struct {
 	MenuItemFullscreen             *gtk.CheckMenuItem     `build:"MenuItemFullscreen"`
 	MenuItemSeamless               *gtk.CheckMenuItem     `build:"MenuItemSeamless"`
 	MenuItemRandom                 *gtk.CheckMenuItem     `build:"MenuItemRandom"`
+	MenuItemSkipDuplicates         *gtk.CheckMenuItem     `build:"MenuItemSkipDuplicates"`
+	MenuItemReshuffle              *gtk.MenuItem          `build:"MenuItemReshuffle"`
+	MenuItemSlideshow              *gtk.CheckMenuItem     `build:"MenuItemSlideshow"`
+	MenuItemPlayAnimations         *gtk.CheckMenuItem     `build:"MenuItemPlayAnimations"`
+	MenuItemNextFrame              *gtk.MenuItem          `build:"MenuItemNextFrame"`
+	MenuItemPreviousFrame          *gtk.MenuItem          `build:"MenuItemPreviousFrame"`
 	MenuItemPreferences            *gtk.MenuItem          `build:"MenuItemPreferences"`
 	MenuItemHFlip                  *gtk.CheckMenuItem     `build:"MenuItemHFlip"`
 	MenuItemVFlip                  *gtk.CheckMenuItem     `build:"MenuItemVFlip"`
 	MenuItemMangaMode              *gtk.CheckMenuItem     `build:"MenuItemMangaMode"`
 	MenuItemDoublePage             *gtk.CheckMenuItem     `build:"MenuItemDoublePage"`
 	MenuItemGoTo                   *gtk.MenuItem          `build:"MenuItemGoTo"`
+	MenuItemScenes                 *gtk.MenuItem          `build:"MenuItemScenes"`
+	ScenesDialog                   *gtk.Dialog            `build:"ScenesDialog"`
+	ScenesTreeView                 *gtk.TreeView          `build:"ScenesTreeView"`
+	ScenesStatusLabel              *gtk.Label             `build:"ScenesStatusLabel"`
+	MenuItemBack                   *gtk.MenuItem          `build:"MenuItemBack"`
+	MenuItemForward                *gtk.MenuItem          `build:"MenuItemForward"`
 	GoToThumbnailImage             *gtk.Image             `build:"GoToThumbnailImage"`
 	MenuItemBestFit                *gtk.RadioMenuItem     `build:"MenuItemBestFit"`
 	MenuItemOriginal               *gtk.RadioMenuItem     `build:"MenuItemOriginal"`
@@ -81,17 +144,55 @@ type GUI struct {
 	PreferencesDialog              *gtk.Dialog            `build:"PreferencesDialog"`
 	PagesToSkipSpinButton          *gtk.SpinButton        `build:"PagesToSkipSpinButton"`
 	GoToDialog                     *gtk.Dialog            `build:"GoToDialog"`
+	MemoryDialog                   *gtk.Dialog            `build:"MemoryDialog"`
+	MemoryLabel                    *gtk.Label             `build:"MemoryLabel"`
+	MemoryBudgetSpinButton         *gtk.SpinButton        `build:"MemoryBudgetSpinButton"`
 	GoToSpinButton                 *gtk.SpinButton        `build:"GoToSpinButton"`
 	GoToScrollbar                  *gtk.Scrollbar         `build:"GoToScrollbar"`
 	InterpolationComboBoxText      *gtk.ComboBoxText      `build:"InterpolationComboBoxText"`
 	OneWideCheckButton             *gtk.CheckButton       `build:"OneWideCheckButton"`
 	SmartScrollCheckButton         *gtk.CheckButton       `build:"SmartScrollCheckButton"`
 	EmbeddedOrientationCheckButton *gtk.CheckButton       `build:"EmbeddedOrientationCheckButton"`
+	RememberPositionCheckButton    *gtk.CheckButton       `build:"RememberPositionCheckButton"`
+	SingleInstanceCheckButton      *gtk.CheckButton       `build:"SingleInstanceCheckButton"`
+	SlideshowDelaySpinButton       *gtk.SpinButton        `build:"SlideshowDelaySpinButton"`
+	SlideshowLoopCheckButton       *gtk.CheckButton       `build:"SlideshowLoopCheckButton"`
+	SlideshowScaleTallCheckButton  *gtk.CheckButton       `build:"SlideshowScaleTallCheckButton"`
+	SceneHashComboBoxText          *gtk.ComboBoxText      `build:"SceneHashComboBoxText"`
+	LibraryRootsEntry              *gtk.Entry             `build:"LibraryRootsEntry"`
+	PathRemapsEntry                *gtk.Entry             `build:"PathRemapsEntry"`
 	AddBookmarkMenuItem            *gtk.MenuItem          `build:"AddBookmarkMenuItem"`
 	MenuBookmarks                  *gtk.Menu              `build:"MenuBookmarks"`
+	MenuItemManageBookmarks        *gtk.MenuItem          `build:"MenuItemManageBookmarks"`
+	MenuItemImportBookmarks        *gtk.MenuItem          `build:"MenuItemImportBookmarks"`
+	MenuItemExportBookmarks        *gtk.MenuItem          `build:"MenuItemExportBookmarks"`
+	ImportBookmarksDialog          *gtk.FileChooserDialog `build:"ImportBookmarksDialog"`
+	ExportBookmarksDialog          *gtk.FileChooserDialog `build:"ExportBookmarksDialog"`
+	BookmarksDialog                *gtk.Dialog            `build:"BookmarksDialog"`
+	BookmarksTreeView              *gtk.TreeView          `build:"BookmarksTreeView"`
+	BookmarksJumpButton            *gtk.Button            `build:"BookmarksJumpButton"`
+	BookmarksDeleteButton          *gtk.Button            `build:"BookmarksDeleteButton"`
+	BookmarksMoveUpButton          *gtk.Button            `build:"BookmarksMoveUpButton"`
+	BookmarksMoveDownButton        *gtk.Button            `build:"BookmarksMoveDownButton"`
+	BookmarksSortComboBoxText      *gtk.ComboBoxText      `build:"BookmarksSortComboBoxText"`
+	BookmarksListStore             *gtk.ListStore
 	RecentChooserMenu              *gtk.RecentChooserMenu `build:"RecentChooserMenu"`
 	Config                         Config
 	State                          State
+	Bookmarks                      library.Bookmarks
+	Progress                       library.Progress
+	History                        history.History
+	Catalog                        catalogBrowser
+	Scenes                         sceneIndex
+	Dupes                          dupesReport
+	Edit                           pageEditor
+	Slideshow                      slideshow
+	Anim                           animations
+	ViewL, ViewR                   pageView
+	Tiles                          *tile.Cache
+	Resizing                       resizing
+	Memory                         *budget.Manager
+	IPC                            *ipc.Server
 	RecentManager                  *gtk.RecentManager
 }
 
@@ -163,15 +264,36 @@ func (gui *GUI) initUI() {
 	gui.FileChooserDialogArchive.AddButton("_Open", gtk.RESPONSE_ACCEPT)
 	gui.FileChooserDialogArchive.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
 
+	gui.ImportBookmarksDialog.AddButton("_Import", gtk.RESPONSE_ACCEPT)
+	gui.ImportBookmarksDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	gui.ExportBookmarksDialog.AddButton("_Export", gtk.RESPONSE_ACCEPT)
+	gui.ExportBookmarksDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+
+	gui.OpenURLDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	gui.OpenURLDialog.AddButton("_Open", gtk.RESPONSE_ACCEPT)
+	gui.OpenURLDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+
 	gui.PreferencesDialog.AddButton("_OK", gtk.RESPONSE_ACCEPT)
 
 	gui.GoToDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
 	gui.GoToDialog.AddButton("_Go", gtk.RESPONSE_ACCEPT)
 	//gui.GoToDialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
 
+	gui.initMemory()
+	gui.initPageViews()
+	gui.initBookmarksDialog()
+	gui.initCatalogDialog()
+	gui.initScenesDialog()
+	gui.initDupesDialog()
+	gui.initConvertDialog()
+	gui.initExportDialog()
+	gui.initEditDialog()
+
 	gui.syncUI()
 
 	// Connect signals
+	gui.MenuItemMemoryUsage.Connect("activate", gui.RunMemoryDialog)
+
 	gui.MenuItemAbout.Connect("activate", func() {
 		gui.AboutDialog.Run()
 		gui.AboutDialog.Hide()
@@ -186,7 +308,24 @@ func (gui *GUI) initUI() {
 		}
 	})
 
-	gui.MenuItemSaveImage.Connect("activate", gui.SavePNG)
+	gui.MenuItemOpenURL.Connect("activate", func() {
+		res := gtk.ResponseType(gui.OpenURLDialog.Run())
+		gui.OpenURLDialog.Hide()
+		if res != gtk.RESPONSE_ACCEPT {
+			return
+		}
+		if uri, err := gui.OpenURLEntry.GetText(); err == nil {
+			gui.LoadArchive(strings.TrimSpace(uri))
+		}
+	})
+
+	gui.MenuItemCatalog.Connect("activate", gui.RunCatalogDialog)
+	gui.MenuItemFindDuplicates.Connect("activate", gui.FindDuplicates)
+
+	gui.MenuItemExport.Connect("activate", gui.RunExportDialog)
+	gui.MenuItemCopyImage.Connect("activate", gui.CopyImage)
+	gui.MenuItemEditPages.Connect("activate", gui.RunEditDialog)
+	gui.MenuItemConvert.Connect("activate", gui.RunConvertDialog)
 
 	gui.MenuItemQuit.Connect("activate", gui.Quit)
 	gui.MenuItemClose.Connect("activate", gui.Close)
@@ -243,6 +382,32 @@ func (gui *GUI) initUI() {
 		gui.SetRandom(gui.MenuItemRandom.GetActive())
 	})
 
+	gui.MenuItemReshuffle.Connect("activate", gui.Reshuffle)
+
+	gui.MenuItemSkipDuplicates.Connect("toggled", func() {
+		gui.SetSkipDuplicatePages(gui.MenuItemSkipDuplicates.GetActive())
+	})
+
+	gui.MenuItemPlayAnimations.Connect("toggled", func() {
+		gui.SetPlayAnimations(gui.MenuItemPlayAnimations.GetActive())
+	})
+
+	gui.MenuItemNextFrame.Connect("activate", func() {
+		gui.StepFrame(1)
+	})
+
+	gui.MenuItemPreviousFrame.Connect("activate", func() {
+		gui.StepFrame(-1)
+	})
+
+	gui.MenuItemSlideshow.Connect("toggled", func() {
+		if gui.MenuItemSlideshow.GetActive() {
+			gui.StartSlideshow()
+		} else {
+			gui.StopSlideshow()
+		}
+	})
+
 	gui.MenuItemHFlip.Connect("toggled", func() {
 		gui.SetHFlip(gui.MenuItemHFlip.GetActive())
 	})
@@ -291,6 +456,11 @@ func (gui *GUI) initUI() {
 		}
 	})
 
+	gui.MenuItemScenes.Connect("activate", gui.RunScenesDialog)
+
+	gui.MenuItemBack.Connect("activate", gui.Back)
+	gui.MenuItemForward.Connect("activate", gui.Forward)
+
 	gui.MenuItemGoTo.Connect("activate", func() {
 		gui.RunGoToDialog()
 	})
@@ -336,15 +506,71 @@ func (gui *GUI) initUI() {
 		gui.SetEmbeddedOrientation(gui.EmbeddedOrientationCheckButton.GetActive())
 	})
 
+	gui.SingleInstanceCheckButton.Connect("toggled", func() {
+		gui.Config.SingleInstance = gui.SingleInstanceCheckButton.GetActive()
+	})
+
+	gui.SlideshowDelaySpinButton.SetRange(1, 600)
+	gui.SlideshowDelaySpinButton.SetIncrements(1, 10)
+	gui.SlideshowDelaySpinButton.Connect("value-changed", func() {
+		gui.Config.SlideshowDelay = gui.SlideshowDelaySpinButton.GetValue()
+	})
+
+	gui.SlideshowLoopCheckButton.Connect("toggled", func() {
+		gui.Config.SlideshowLoop = gui.SlideshowLoopCheckButton.GetActive()
+	})
+
+	gui.SlideshowScaleTallCheckButton.Connect("toggled", func() {
+		gui.Config.SlideshowScaleTall = gui.SlideshowScaleTallCheckButton.GetActive()
+	})
+
+	gui.MemoryBudgetSpinButton.SetRange(32, 16384)
+	gui.MemoryBudgetSpinButton.SetIncrements(32, 256)
+	gui.MemoryBudgetSpinButton.Connect("value-changed", func() {
+		gui.SetMemoryBudget(int(gui.MemoryBudgetSpinButton.GetValue()))
+	})
+
+	for _, h := range imgdiff.Hashers {
+		gui.SceneHashComboBoxText.Append(h.Name(), sceneHashLabels[h.Name()])
+	}
+	gui.SceneHashComboBoxText.Connect("changed", func() {
+		gui.SetSceneHash(gui.SceneHashComboBoxText.GetActiveID())
+	})
+
+	gui.RememberPositionCheckButton.Connect("toggled", func() {
+		gui.Config.RememberPosition = gui.RememberPositionCheckButton.GetActive()
+	})
+
+	gui.LibraryRootsEntry.Connect("changed", func() {
+		text, err := gui.LibraryRootsEntry.GetText()
+		if err != nil {
+			return
+		}
+		gui.Config.LibraryRoots = filepath.SplitList(text)
+	})
+
+	gui.PathRemapsEntry.Connect("changed", func() {
+		text, err := gui.PathRemapsEntry.GetText()
+		if err != nil {
+			return
+		}
+		gui.Config.PathRemaps = filepath.SplitList(text)
+	})
+
 	gui.AddBookmarkMenuItem.Connect("activate", func() {
 		gui.AddBookmark()
 	})
 
+	gui.MenuItemManageBookmarks.Connect("activate", gui.RunBookmarksDialog)
+	gui.MenuItemImportBookmarks.Connect("activate", gui.ImportBookmarks)
+	gui.MenuItemExportBookmarks.Connect("activate", gui.ExportBookmarks)
+
 	gui.ScrolledWindow.SetEvents(gui.ScrolledWindow.GetEvents() | int(gdk.BUTTON_PRESS_MASK))
 
 	gui.ScrolledWindow.Connect("scroll-event", func(w *gtk.ScrolledWindow, e *gdk.Event) {
 		se := &gdk.EventScroll{e}
 
+		gui.pauseSlideshow()
 		gui.Scroll(se.DeltaX(), se.DeltaY())
 	})
 
@@ -359,6 +585,10 @@ func (gui *GUI) initUI() {
 			gui.PreviousPage()
 		case 2:
 			gui.NextArchive()
+		case 8:
+			gui.Back()
+		case 9:
+			gui.Forward()
 		}
 		return true
 	})
@@ -368,6 +598,12 @@ func (gui *GUI) initUI() {
 
 		shift := ke.State()&uint(gdk.GDK_SHIFT_MASK) != 0
 		ctrl := ke.State()&uint(gdk.GDK_CONTROL_MASK) != 0
+		if ke.State()&uint(gdk.GDK_MOD1_MASK) != 0 {
+			// Alt + left/right are Back and Forward, handled by
+			// the menu accelerators.
+			return
+		}
+		gui.pauseSlideshow()
 
 		switch ke.KeyVal() {
 		case gdk.KEY_Down:
@@ -406,6 +642,7 @@ func (gui *GUI) initUI() {
 	})
 
 	gui.RebuildBookmarksMenu()
+	gui.updateHistoryMenu()
 
 	gui.MainWindow.SetDefaultSize(gui.Config.WindowWidth, gui.Config.WindowHeight)
 	gui.MainWindow.ShowAll()
@@ -435,15 +672,15 @@ func (gui *GUI) goToDialogLoadSetThumbnail() {
 	w, h := fit(pixbuf.GetWidth(), pixbuf.GetHeight(), 128, 128)
 
 	scaled, err := pixbuf.ScaleSimple(w, h, interpolations[gui.Config.Interpolation])
+	gui.Memory.Discard(pixbufBytes(pixbuf))
 	if err != nil {
 		gui.ShowError(err.Error())
 		return
 	}
 
+	gui.Memory.Discard(pixbufBytes(gui.State.GoToThumnailPixbuf))
 	gui.State.GoToThumnailPixbuf = scaled
 	gui.GoToThumbnailImage.SetFromPixbuf(scaled)
-
-	gc()
 }
 
 func (gui *GUI) syncUI() {
@@ -454,6 +691,8 @@ func (gui *GUI) syncUI() {
 	gui.MenuItemVFlip.SetActive(gui.Config.VFlip)
 	gui.MenuItemRandom.SetActive(gui.Config.Random)
 	gui.MenuItemSeamless.SetActive(gui.Config.Seamless)
+	gui.MenuItemSkipDuplicates.SetActive(gui.Config.SkipDuplicatePages)
+	gui.SetPlayAnimations(true)
 	gui.MenuItemDoublePage.SetActive(gui.Config.DoublePage)
 	gui.MenuItemMangaMode.SetActive(gui.Config.MangaMode)
 
@@ -471,6 +710,15 @@ func (gui *GUI) syncUI() {
 	gui.InterpolationComboBoxText.SetActive(gui.Config.Interpolation)
 	gui.OneWideCheckButton.SetActive(gui.Config.OneWide)
 	gui.EmbeddedOrientationCheckButton.SetActive(gui.Config.EmbeddedOrientation)
+	gui.RememberPositionCheckButton.SetActive(gui.Config.RememberPosition)
+	gui.SingleInstanceCheckButton.SetActive(gui.Config.SingleInstance)
+	gui.SlideshowDelaySpinButton.SetValue(gui.Config.SlideshowDelay)
+	gui.MemoryBudgetSpinButton.SetValue(float64(gui.Config.MemoryBudget))
+	gui.SlideshowLoopCheckButton.SetActive(gui.Config.SlideshowLoop)
+	gui.SlideshowScaleTallCheckButton.SetActive(gui.Config.SlideshowScaleTall)
+	gui.SceneHashComboBoxText.SetActiveID(gui.hasher().Name())
+	gui.LibraryRootsEntry.SetText(strings.Join(gui.Config.LibraryRoots, string(filepath.ListSeparator)))
+	gui.PathRemapsEntry.SetText(strings.Join(gui.Config.PathRemaps, string(filepath.ListSeparator)))
 }
 
 func (gui *GUI) RunGoToDialog() {
@@ -491,10 +739,10 @@ func (gui *GUI) RunGoToDialog() {
 	res := gtk.ResponseType(gui.GoToDialog.Run())
 	gui.GoToDialog.Hide()
 	if res == gtk.RESPONSE_ACCEPT {
-		gui.SetPage(int(gui.GoToSpinButton.GetValue()) - 1)
+		gui.jumpToPage(int(gui.GoToSpinButton.GetValue()) - 1)
 
 		gui.GoToThumbnailImage.Clear()
+		gui.Memory.Discard(pixbufBytes(gui.State.GoToThumnailPixbuf))
 		gui.State.GoToThumnailPixbuf = nil
-		gc()
 	}
 }
@@ -19,9 +19,14 @@ import (
 	"bytes"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/salviati/gomics/archive"
-	"runtime"
+	"github.com/salviati/gomics/imgdiff"
+	"image"
 )
 
+// Pages are shrunk to fit this before hashing, which is plenty for
+// the grids the hashes are computed on.
+const hashImageSize = 128
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -66,10 +71,41 @@ func fit(sw, sh, fw, fh int) (int, int) {
 	return int(nw), int(nh)
 }
 
-func gc() {
-	// TODO do some checks?
-	runtime.GC()
-	runtime.GC()
+// pixbufImage copies the pixels of p into an image.Image.
+func pixbufImage(p *gdk.Pixbuf) *image.NRGBA {
+	w, h := p.GetWidth(), p.GetHeight()
+	nchan, rowstride := p.GetNChannels(), p.GetRowstride()
+	data := p.GetPixels()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		src := data[y*rowstride:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			s, d := src[x*nchan:], dst[4*x:]
+			if nchan < 3 {
+				d[0], d[1], d[2], d[3] = s[0], s[0], s[0], 255
+				continue
+			}
+			d[0], d[1], d[2], d[3] = s[0], s[1], s[2], 255
+			if nchan == 4 {
+				d[3] = s[3]
+			}
+		}
+	}
+	return img
+}
+
+func hashPixbuf(h imgdiff.Hasher, p *gdk.Pixbuf) (imgdiff.Hash, error) {
+	w, hh := p.GetWidth(), p.GetHeight()
+	if w > hashImageSize || hh > hashImageSize {
+		w, hh = fit(w, hh, hashImageSize, hashImageSize)
+		var err error
+		if p, err = p.ScaleSimple(max(w, 1), max(hh, 1), gdk.INTERP_TILES); err != nil {
+			return 0, err
+		}
+	}
+	return h.Hash(pixbufImage(p)), nil
 }
 
 func mustLoadPixbuf(data []byte) *gdk.Pixbuf {
@@ -0,0 +1,264 @@
+// Copyright (c) 2013-2018 Utkan Güngördü <utkan@freeconsole.org>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/salviati/gomics/budget"
+	"github.com/salviati/gomics/tile"
+	"image"
+	"log"
+	"math"
+	"time"
+)
+
+// resizeSettle is how long the window has to keep its size before the
+// pages are drawn again with the interpolation set in the preferences.
+const resizeSettle = 200 * time.Millisecond
+
+// pageKey tells apart the ways a page can be drawn, so that its tiles
+// can be found again when the page is back in view.
+type pageKey struct {
+	archive     string
+	page        int
+	frame       int
+	orientation bool
+	hflip       bool
+	vflip       bool
+	interp      gdk.InterpType
+}
+
+// resizing tracks a resize of the window in progress, during which the
+// pages are scaled with the fastest interpolation.
+type resizing struct {
+	active bool
+	timer  glib.SourceHandle
+}
+
+// pageView draws a page at a scale, a tile at a time and only the
+// tiles in view, so that tall strips and large scans don't have to be
+// scaled whole on every zoom and resize.
+type pageView struct {
+	area   *gtk.DrawingArea
+	src    *gdk.Pixbuf // as passed to blit
+	key    pageKey
+	levels []*gdk.Pixbuf // src flipped, then halved again and again
+	scale  float64
+	flip   *budget.Handle // of levels[0], if it's a flipped copy
+	halves *budget.Handle // of the levels past the first
+}
+
+func (gui *GUI) initPageViews() {
+	gui.Tiles = tile.NewCache(gui.Memory)
+	gui.ViewL.area = gui.ImageL
+	gui.ViewR.area = gui.ImageR
+
+	gui.ImageL.Connect("draw", func(_ *gtk.DrawingArea, cr *cairo.Context) {
+		gui.drawPage(&gui.ViewL, cr)
+	})
+	gui.ImageR.Connect("draw", func(_ *gtk.DrawingArea, cr *cairo.Context) {
+		gui.drawPage(&gui.ViewR, cr)
+	})
+}
+
+// pageKey returns the key of page side of the spread as it would be
+// drawn now.
+func (gui *GUI) pageKey(side int) pageKey {
+	k := pageKey{
+		archive:     gui.State.ArchivePath,
+		page:        gui.State.ArchivePos,
+		orientation: gui.Config.EmbeddedOrientation,
+		hflip:       gui.Config.HFlip,
+		vflip:       gui.Config.VFlip,
+		interp:      gui.interp(),
+	}
+	if side == sideRight {
+		k.page = gui.State.ArchivePosR
+	}
+	if a := gui.Anim.pages[side]; a != nil {
+		k.frame = a.frame
+	}
+	return k
+}
+
+// interp returns the interpolation to scale the pages with.
+func (gui *GUI) interp() gdk.InterpType {
+	if gui.Resizing.active {
+		return gdk.INTERP_NEAREST
+	}
+	return interpolations[gui.Config.Interpolation]
+}
+
+// startResize has the pages drawn fast while the window is resized,
+// and well once it has kept its size for resizeSettle.
+func (gui *GUI) startResize() {
+	if gui.Resizing.timer != 0 {
+		glib.SourceRemove(gui.Resizing.timer)
+	}
+	timer, err := glib.TimeoutAdd(uint(resizeSettle/time.Millisecond), func() bool {
+		gui.Resizing.active = false
+		gui.Resizing.timer = 0
+		gui.Blit()
+		return false
+	})
+	if err != nil {
+		log.Println(err)
+		gui.Resizing.active, gui.Resizing.timer = false, 0
+		return
+	}
+	gui.Resizing.active, gui.Resizing.timer = true, timer
+}
+
+// forgetArchive drops the tiles of the pages of an archive, as it may
+// be opened again with other pages at the same path.
+func (gui *GUI) forgetArchive(path string) {
+	gui.Tiles.Drop(func(image interface{}) bool {
+		return image.(pageKey).archive == path
+	})
+}
+
+// size returns the size of the page as scaled.
+func (v *pageView) size() image.Point {
+	w, h := v.src.GetWidth(), v.src.GetHeight()
+	return image.Pt(int(float64(w)*v.scale), int(float64(h)*v.scale))
+}
+
+// level returns level k of the pyramid, building the levels up to it
+// if need be, or the smallest one there is. The page is flipped only
+// once a tile of it is missing, and the levels past the first are
+// dropped together when memory runs short.
+func (gui *GUI) level(v *pageView, k int) (*gdk.Pixbuf, error) {
+	if len(v.levels) == 0 {
+		flipped, err := gui.flipped(v.src)
+		if err != nil {
+			return nil, err
+		}
+		v.levels = []*gdk.Pixbuf{flipped}
+		if flipped != v.src {
+			v.flip = gui.Memory.Hold(budget.Pages, pixbufBytes(flipped), nil)
+		}
+	}
+
+	n := len(v.levels)
+	for len(v.levels) <= k {
+		last := v.levels[len(v.levels)-1]
+		w, h := tile.LevelSize(last.GetWidth(), last.GetHeight(), 1)
+		if w == last.GetWidth() && h == last.GetHeight() {
+			break
+		}
+		p, err := last.ScaleSimple(w, h, gdk.INTERP_BILINEAR)
+		if err != nil {
+			log.Println(err)
+			break
+		}
+		v.levels = append(v.levels, p)
+	}
+	level := v.levels[min(k, len(v.levels)-1)]
+
+	var size int64
+	for _, p := range v.levels[n:] {
+		size += pixbufBytes(p)
+	}
+	switch {
+	case v.halves != nil:
+		v.halves.Grow(size)
+		v.halves.Touch()
+	case size > 0:
+		v.halves = gui.Memory.Hold(budget.Scaled, size, func() {
+			v.levels = v.levels[:1]
+			v.halves = nil
+		})
+	}
+	return level, nil
+}
+
+// blit shows pixbuf in v at scale. The tiles already scaled for key are
+// drawn from the cache, so the page is flipped and scaled again only
+// if it's drawn differently than it was last time.
+func (gui *GUI) blit(v *pageView, pixbuf *gdk.Pixbuf, key pageKey, scale float64) {
+	if pixbuf != v.src || key != v.key {
+		gui.clearPage(v)
+		v.src, v.key = pixbuf, key
+	}
+
+	v.scale = scale
+	size := v.size()
+	v.area.SetSizeRequest(size.X, size.Y)
+	v.area.QueueDraw()
+}
+
+func (gui *GUI) clearPage(v *pageView) {
+	v.flip.Release()
+	v.halves.Release()
+	v.src = nil
+	v.levels = nil
+	v.flip, v.halves = nil, nil
+	v.area.SetSizeRequest(0, 0)
+	v.area.QueueDraw()
+}
+
+// drawPage draws the tiles of the page that need drawing, centered in
+// the area, as the page of a spread may be shorter than the other.
+func (gui *GUI) drawPage(v *pageView, cr *cairo.Context) {
+	if v.src == nil {
+		return
+	}
+	size := v.size()
+	alloc := v.area.GetAllocation()
+	offset := image.Pt(max(alloc.GetWidth()-size.X, 0)/2, max(alloc.GetHeight()-size.Y, 0)/2)
+
+	x1, y1, x2, y2 := cr.ClipExtents()
+	clip := image.Rect(int(math.Floor(x1)), int(math.Floor(y1)), int(math.Ceil(x2)), int(math.Ceil(y2)))
+	for _, t := range tile.Visible(clip.Sub(offset), size) {
+		p, err := gui.pageTile(v, t)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		at := tile.Bounds(t, size).Min.Add(offset)
+		gdk.CairoSetSourcePixBuf(cr, p, float64(at.X), float64(at.Y))
+		cr.Paint()
+	}
+}
+
+// pageTile returns tile t of the page at its current scale, scaled
+// from the level of the pyramid closest in size.
+func (gui *GUI) pageTile(v *pageView, t image.Point) (*gdk.Pixbuf, error) {
+	key := tile.Key{Image: v.key, Scale: v.scale, Tile: t}
+	if p, ok := gui.Tiles.Get(key); ok {
+		return p.(*gdk.Pixbuf), nil
+	}
+
+	level, err := gui.level(v, tile.Level(v.scale))
+	if err != nil {
+		return nil, err
+	}
+	size := v.size()
+	r := tile.Bounds(t, size)
+	p, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, level.GetHasAlpha(), 8, r.Dx(), r.Dy())
+	if err != nil {
+		return nil, err
+	}
+	scaleX := float64(size.X) / float64(level.GetWidth())
+	scaleY := float64(size.Y) / float64(level.GetHeight())
+	scalePixbuf(level, p, -float64(r.Min.X), -float64(r.Min.Y), scaleX, scaleY, v.key.interp)
+
+	gui.Tiles.Put(key, p, p.GetRowstride()*r.Dy())
+	return p, nil
+}